@@ -0,0 +1,150 @@
+// Command etcdbundle exports etcd prefixes to a portable bundle and imports them into another cluster.
+//
+//	etcdbundle export -prefix /microservices -prefix /archetypes -o config.yaml
+//	etcdbundle import -i config.yaml -mode skip -dry-run
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Jorrit05/GoLib"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type prefixFlags []string
+
+func (p *prefixFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *prefixFlags) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(os.Args[2:])
+	case "import":
+		err = importBundle(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "etcdbundle %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: etcdbundle export|import [flags]")
+	os.Exit(2)
+}
+
+func connect(endpoints string) (*clientv3.Client, error) {
+	return clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+}
+
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	endpoints := flags.String("endpoints", "etcd1:2379,etcd2:2379,etcd3:2379", "comma separated etcd endpoints")
+	output := flags.String("o", "-", "output file, - for stdout")
+	format := flags.String("format", "", "yaml or json, derived from the output file extension by default")
+	source := flags.String("source", "", "name of the environment the bundle is exported from")
+	var prefixes prefixFlags
+	flags.Var(&prefixes, "prefix", "prefix to export, can be repeated (default /microservices)")
+	flags.Parse(args)
+
+	if len(prefixes) == 0 {
+		prefixes = prefixFlags{"/microservices"}
+	}
+	if *format == "" {
+		*format = "yaml"
+		if filepath.Ext(*output) == ".json" {
+			*format = "json"
+		}
+	}
+
+	cli, err := connect(*endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	bundle, err := GoLib.ExportEtcd(cli, prefixes, *source)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return GoLib.WriteEtcdBundle(w, bundle, GoLib.BundleFormat(*format))
+}
+
+func importBundle(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	endpoints := flags.String("endpoints", "etcd1:2379,etcd2:2379,etcd3:2379", "comma separated etcd endpoints")
+	input := flags.String("i", "-", "bundle file, - for stdin")
+	mode := flags.String("mode", string(GoLib.ConflictOverwrite), "what to do with existing keys: overwrite, skip or fail")
+	dryRun := flags.Bool("dry-run", false, "only print the changes that would be made")
+	flags.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	bundle, err := GoLib.ReadEtcdBundle(r)
+	if err != nil {
+		return err
+	}
+
+	cli, err := connect(*endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	opts := []GoLib.ImportOption{GoLib.ImportConflictMode(GoLib.ConflictMode(*mode))}
+	if *dryRun {
+		opts = append(opts, GoLib.ImportDryRun())
+	}
+
+	report, err := GoLib.ImportEtcd(cli, bundle, opts...)
+	if report != nil {
+		fmt.Print(report)
+		fmt.Printf("%d created, %d updated, %d skipped, %d unchanged\n",
+			report.Count(GoLib.ImportCreate), report.Count(GoLib.ImportUpdate),
+			report.Count(GoLib.ImportSkip), report.Count(GoLib.ImportUnchanged))
+	}
+	return err
+}
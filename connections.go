@@ -2,7 +2,6 @@ package GoLib
 
 import (
 	"context"
-	"log"
 	"os"
 	"time"
 
@@ -0,0 +1,144 @@
+package GoLib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+func (c *ShellCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		args, err := SplitCommand(command)
+		*c = args
+		return err
+	}
+
+	var args []string
+	if err := unmarshal(&args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+func (t *HealthcheckTest) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var command string
+	if err := unmarshal(&command); err == nil {
+		*t = HealthcheckTest{"CMD-SHELL", command}
+		return nil
+	}
+
+	var test []string
+	if err := unmarshal(&test); err != nil {
+		return err
+	}
+	*t = test
+	return nil
+}
+
+// SplitCommand splits a command line into arguments on whitespace, keeping quoted strings together.
+// Within single quotes everything is literal, within double quotes and outside of quotes a backslash
+// escapes the next character.
+func SplitCommand(command string) ([]string, error) {
+	args := []string{}
+	var current strings.Builder
+	inArg, quote, escaped := false, rune(0), false
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command %q", command)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// applyContainerOptions sets the command, user, hostname, labels and healthcheck of the container.
+// Like compose, the entrypoint replaces the ENTRYPOINT and the command the CMD of the image.
+func applyContainerOptions(containerSpec *swarm.ContainerSpec, options ContainerOptions) error {
+	containerSpec.Labels = options.Labels
+	containerSpec.Command = options.Entrypoint
+	containerSpec.Args = options.Command
+	containerSpec.User = options.User
+	containerSpec.Dir = options.WorkingDir
+	containerSpec.Hostname = options.Hostname
+
+	if options.Healthcheck != nil {
+		healthcheck, err := convertHealthcheck(*options.Healthcheck)
+		if err != nil {
+			return fmt.Errorf("invalid healthcheck: %w", err)
+		}
+		containerSpec.Healthcheck = healthcheck
+	}
+
+	return nil
+}
+
+func convertHealthcheck(healthcheck Healthcheck) (*container.HealthConfig, error) {
+	if healthcheck.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+
+	result := &container.HealthConfig{Test: healthcheck.Test}
+	if len(result.Test) > 0 {
+		switch result.Test[0] {
+		case "CMD", "CMD-SHELL", "NONE":
+		default:
+			return nil, fmt.Errorf("test must start with CMD, CMD-SHELL or NONE, got %q", result.Test[0])
+		}
+	}
+
+	for _, duration := range []struct {
+		value  string
+		target *time.Duration
+	}{
+		{healthcheck.Interval, &result.Interval},
+		{healthcheck.Timeout, &result.Timeout},
+		{healthcheck.StartPeriod, &result.StartPeriod},
+	} {
+		parsed, err := parseOptionalDuration(duration.value)
+		if err != nil {
+			return nil, err
+		}
+		if parsed != nil {
+			*duration.target = *parsed
+		}
+	}
+
+	if healthcheck.Retries != nil {
+		result.Retries = int(*healthcheck.Retries)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package GoLib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSplitCommand(t *testing.T) {
+	testCases := map[string][]string{
+		"":                            {},
+		"serve":                       {"serve"},
+		"  serve --port 80 ":          {"serve", "--port", "80"},
+		`sh -c "echo hello world"`:    {"sh", "-c", "echo hello world"},
+		`echo 'a "quoted" $HOME'`:     {"echo", `a "quoted" $HOME`},
+		`echo hello\ world ""`:        {"echo", "hello world", ""},
+		`echo "escaped \"quote\" \\"`: {"echo", `escaped "quote" \`},
+	}
+
+	for command, expected := range testCases {
+		t.Run(command, func(t *testing.T) {
+			args, err := SplitCommand(command)
+			require.NoError(t, err)
+			assert.Equal(t, expected, args)
+		})
+	}
+
+	for _, command := range []string{`echo "open`, `echo 'open`, `echo \`} {
+		_, err := SplitCommand(command)
+		assert.Error(t, err, command)
+	}
+}
+
+func TestConvertHealthcheck(t *testing.T) {
+	retries := uint64(3)
+	healthcheck, err := convertHealthcheck(Healthcheck{
+		Test:        HealthcheckTest{"CMD", "curl", "-f", "http://localhost"},
+		Interval:    "30s",
+		Timeout:     "5s",
+		StartPeriod: "1m",
+		Retries:     &retries,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &container.HealthConfig{
+		Test:        []string{"CMD", "curl", "-f", "http://localhost"},
+		Interval:    30 * time.Second,
+		Timeout:     5 * time.Second,
+		StartPeriod: time.Minute,
+		Retries:     3,
+	}, healthcheck)
+
+	healthcheck, err = convertHealthcheck(Healthcheck{Test: HealthcheckTest{"CMD"}, Disable: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"NONE"}, healthcheck.Test)
+
+	_, err = convertHealthcheck(Healthcheck{Test: HealthcheckTest{"curl", "-f", "http://localhost"}})
+	assert.Error(t, err)
+
+	_, err = convertHealthcheck(Healthcheck{Test: HealthcheckTest{"CMD", "true"}, Interval: "often"})
+	assert.Error(t, err)
+}
+
+func TestCreateServiceSpecFromPayloadContainerOptions(t *testing.T) {
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName: "query_service",
+		Tag:       "1.0",
+		Deploy:    Deploy{Labels: map[string]string{"owner": "team"}},
+		ContainerOptions: ContainerOptions{
+			Labels:      map[string]string{"component": "query"},
+			Entrypoint:  ShellCommand{"/bin/query"},
+			Command:     ShellCommand{"--port", "80"},
+			User:        "1000:1000",
+			WorkingDir:  "/app",
+			Hostname:    "query",
+			Healthcheck: &Healthcheck{Test: HealthcheckTest{"CMD-SHELL", "curl -f localhost"}},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"owner": "team", ManagedByLabel: ManagedByValue}, spec.Labels)
+
+	containerSpec := spec.TaskTemplate.ContainerSpec
+	assert.Equal(t, map[string]string{"component": "query"}, containerSpec.Labels)
+	assert.Equal(t, []string{"/bin/query"}, containerSpec.Command)
+	assert.Equal(t, []string{"--port", "80"}, containerSpec.Args)
+	assert.Equal(t, "1000:1000", containerSpec.User)
+	assert.Equal(t, "/app", containerSpec.Dir)
+	assert.Equal(t, "query", containerSpec.Hostname)
+	assert.Equal(t, []string{"CMD-SHELL", "curl -f localhost"}, containerSpec.Healthcheck.Test)
+
+	_, err = CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName:        "query_service",
+		ContainerOptions: ContainerOptions{Healthcheck: &Healthcheck{Test: HealthcheckTest{"curl"}}},
+	}, nil)
+	assert.Error(t, err)
+}
+
+func TestUnmarshalStackFileContainerOptions(t *testing.T) {
+	data := `
+services:
+  query:
+    image: query_service:1.0
+    command: serve --port "8 0"
+    entrypoint: ["/bin/query"]
+    user: nobody
+    working_dir: /app
+    labels:
+      component: query
+    healthcheck:
+      test: curl -f localhost
+      interval: 10s
+      retries: 2
+    deploy:
+      labels:
+        owner: team
+`
+	stack := MicroServiceData{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &stack))
+
+	query := stack.Services["query"]
+	retries := uint64(2)
+	assert.Equal(t, ContainerOptions{
+		Labels:     Labels{"component": "query"},
+		Command:    ShellCommand{"serve", "--port", "8 0"},
+		Entrypoint: ShellCommand{"/bin/query"},
+		User:       "nobody",
+		WorkingDir: "/app",
+		Healthcheck: &Healthcheck{
+			Test:     HealthcheckTest{"CMD-SHELL", "curl -f localhost"},
+			Interval: "10s",
+			Retries:  &retries,
+		},
+	}, query.ContainerOptions)
+	assert.Equal(t, Labels{"owner": "team"}, query.Deploy.Labels)
+}
@@ -0,0 +1,274 @@
+package GoLib
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-units"
+)
+
+// applyDeploy translates the compose deploy section into the mode, placement, resources,
+// restart policy, update and rollback config and endpoint mode of spec. Unset values keep the
+// Swarm defaults.
+func applyDeploy(spec *swarm.ServiceSpec, deploy Deploy) error {
+	mode, err := convertServiceMode(deploy)
+	if err != nil {
+		return err
+	}
+	spec.Mode = mode
+
+	placement, err := convertPlacement(deploy.Placement)
+	if err != nil {
+		return fmt.Errorf("invalid placement: %w", err)
+	}
+	if placement != nil && placement.MaxReplicas > 0 && mode.Global != nil {
+		return fmt.Errorf("max_replicas_per_node can not be used in global mode")
+	}
+	spec.TaskTemplate.Placement = placement
+
+	limits, err := parseResource(deploy.Resources.Limits)
+	if err != nil {
+		return fmt.Errorf("invalid resource limits: %w", err)
+	}
+	if len(limits.GenericResources) > 0 {
+		return fmt.Errorf("invalid resource limits: generic_resources can only be reserved")
+	}
+	reservations, err := parseResource(deploy.Resources.Reservations)
+	if err != nil {
+		return fmt.Errorf("invalid resource reservations: %w", err)
+	}
+	if limits.MemoryBytes != 0 || limits.NanoCPUs != 0 || reservations.MemoryBytes != 0 || reservations.NanoCPUs != 0 || len(reservations.GenericResources) > 0 {
+		spec.TaskTemplate.Resources = &swarm.ResourceRequirements{
+			Limits: &swarm.Limit{
+				NanoCPUs:    limits.NanoCPUs,
+				MemoryBytes: limits.MemoryBytes,
+			},
+			Reservations: &reservations,
+		}
+	}
+
+	if deploy.RestartPolicy != nil {
+		restartPolicy, err := convertRestartPolicy(*deploy.RestartPolicy)
+		if err != nil {
+			return fmt.Errorf("invalid restart_policy: %w", err)
+		}
+		spec.TaskTemplate.RestartPolicy = restartPolicy
+	}
+
+	if deploy.UpdateConfig != nil {
+		updateConfig, err := convertUpdateConfig(*deploy.UpdateConfig)
+		if err != nil {
+			return fmt.Errorf("invalid update_config: %w", err)
+		}
+		spec.UpdateConfig = updateConfig
+	}
+
+	if deploy.RollbackConfig != nil {
+		rollbackConfig, err := convertRollbackConfig(*deploy.RollbackConfig)
+		if err != nil {
+			return fmt.Errorf("invalid rollback_config: %w", err)
+		}
+		spec.RollbackConfig = rollbackConfig
+	}
+
+	if deploy.EndpointMode != "" {
+		if spec.EndpointSpec == nil {
+			spec.EndpointSpec = &swarm.EndpointSpec{}
+		}
+		if err := applyEndpointMode(spec.EndpointSpec, deploy.EndpointMode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// convertServiceMode returns the replicated mode with the number of replicas, 1 when not set, or
+// the global mode. Global services run a task on every node, so they can not have replicas.
+func convertServiceMode(deploy Deploy) (swarm.ServiceMode, error) {
+	switch deploy.Mode {
+	case "", "replicated":
+		replicas := deploy.GetReplicas()
+		return swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}}, nil
+	case "global":
+		if deploy.Replicas != nil {
+			return swarm.ServiceMode{}, fmt.Errorf("replicas can not be set in global mode")
+		}
+		return swarm.ServiceMode{Global: &swarm.GlobalService{}}, nil
+	default:
+		return swarm.ServiceMode{}, fmt.Errorf("unknown mode %q, expected replicated or global", deploy.Mode)
+	}
+}
+
+// convertPlacement returns nil when there is nothing to place.
+func convertPlacement(placement Placement) (*swarm.Placement, error) {
+	if len(placement.Constraints) == 0 && len(placement.Preferences) == 0 && placement.MaxReplicas == 0 {
+		return nil, nil
+	}
+
+	result := &swarm.Placement{
+		Constraints: placement.Constraints,
+		MaxReplicas: placement.MaxReplicas,
+	}
+	for _, preference := range placement.Preferences {
+		if preference.Spread == "" {
+			return nil, fmt.Errorf("preference without spread")
+		}
+		result.Preferences = append(result.Preferences, swarm.PlacementPreference{
+			Spread: &swarm.SpreadOver{SpreadDescriptor: preference.Spread},
+		})
+	}
+	return result, nil
+}
+
+// applyEndpointMode sets how other services reach the tasks, through a virtual IP or DNS round
+// robin. Swarm can only publish ports in ingress mode behind a virtual IP.
+func applyEndpointMode(endpoint *swarm.EndpointSpec, mode string) error {
+	switch swarm.ResolutionMode(mode) {
+	case swarm.ResolutionModeVIP:
+	case swarm.ResolutionModeDNSRR:
+		for _, port := range endpoint.Ports {
+			if port.PublishMode != swarm.PortConfigPublishModeHost {
+				return fmt.Errorf("endpoint_mode dnsrr can not be used with port %d published in ingress mode", port.PublishedPort)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown endpoint_mode %q, expected vip or dnsrr", mode)
+	}
+	endpoint.Mode = swarm.ResolutionMode(mode)
+	return nil
+}
+
+func parseResource(resource Resource) (swarm.Resources, error) {
+	result := swarm.Resources{}
+
+	if resource.Memory != "" {
+		memory, err := ParseMemory(resource.Memory)
+		if err != nil {
+			return result, err
+		}
+		result.MemoryBytes = memory
+	}
+
+	if resource.Cpus != "" {
+		cpus, err := strconv.ParseFloat(resource.Cpus, 64)
+		if err != nil || cpus < 0 {
+			return result, fmt.Errorf("invalid cpus %q", resource.Cpus)
+		}
+		result.NanoCPUs = int64(cpus * 1e9)
+	}
+
+	for _, generic := range resource.GenericResources {
+		spec := generic.DiscreteResourceSpec
+		if spec == nil {
+			return result, fmt.Errorf("generic resource without discrete_resource_spec")
+		}
+		if spec.Kind == "" || spec.Value < 0 {
+			return result, fmt.Errorf("invalid generic resource %s=%d", spec.Kind, spec.Value)
+		}
+		result.GenericResources = append(result.GenericResources, swarm.GenericResource{
+			DiscreteResourceSpec: &swarm.DiscreteGenericResource{Kind: spec.Kind, Value: spec.Value},
+		})
+	}
+
+	return result, nil
+}
+
+// ParseMemory converts a compose memory value like "512M" or "1.5g" to bytes, units are powers of 1024.
+func ParseMemory(memory string) (int64, error) {
+	bytes, err := units.RAMInBytes(memory)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory %q: %w", memory, err)
+	}
+	return bytes, nil
+}
+
+func convertRestartPolicy(policy RestartPolicy) (*swarm.RestartPolicy, error) {
+	result := &swarm.RestartPolicy{
+		MaxAttempts: policy.MaxAttempts,
+	}
+
+	switch condition := swarm.RestartPolicyCondition(policy.Condition); condition {
+	case "":
+		result.Condition = swarm.RestartPolicyConditionAny
+	case swarm.RestartPolicyConditionNone, swarm.RestartPolicyConditionOnFailure, swarm.RestartPolicyConditionAny:
+		result.Condition = condition
+	default:
+		return nil, fmt.Errorf("unknown condition %q", policy.Condition)
+	}
+
+	var err error
+	if result.Delay, err = parseOptionalDuration(policy.Delay); err != nil {
+		return nil, err
+	}
+	if result.Window, err = parseOptionalDuration(policy.Window); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func convertUpdateConfig(config UpdateConfig) (*swarm.UpdateConfig, error) {
+	result := &swarm.UpdateConfig{
+		Parallelism:     1,
+		FailureAction:   config.FailureAction,
+		MaxFailureRatio: config.MaxFailureRatio,
+		Order:           config.Order,
+	}
+
+	if config.Parallelism != nil {
+		result.Parallelism = *config.Parallelism
+	}
+
+	switch config.FailureAction {
+	case "", swarm.UpdateFailureActionPause, swarm.UpdateFailureActionContinue, swarm.UpdateFailureActionRollback:
+	default:
+		return nil, fmt.Errorf("unknown failure_action %q", config.FailureAction)
+	}
+
+	switch config.Order {
+	case "", swarm.UpdateOrderStopFirst, swarm.UpdateOrderStartFirst:
+	default:
+		return nil, fmt.Errorf("unknown order %q", config.Order)
+	}
+
+	delay, err := parseOptionalDuration(config.Delay)
+	if err != nil {
+		return nil, err
+	}
+	if delay != nil {
+		result.Delay = *delay
+	}
+
+	monitor, err := parseOptionalDuration(config.Monitor)
+	if err != nil {
+		return nil, err
+	}
+	if monitor != nil {
+		result.Monitor = *monitor
+	}
+
+	return result, nil
+}
+
+// convertRollbackConfig converts a rollback_config, which can not roll back a failed rollback.
+func convertRollbackConfig(config UpdateConfig) (*swarm.UpdateConfig, error) {
+	if config.FailureAction == swarm.UpdateFailureActionRollback {
+		return nil, fmt.Errorf("failure_action can not be %s", swarm.UpdateFailureActionRollback)
+	}
+	return convertUpdateConfig(config)
+}
+
+func parseOptionalDuration(duration string) (*time.Duration, error) {
+	if duration == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.ParseDuration(duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q: %w", duration, err)
+	}
+	return &parsed, nil
+}
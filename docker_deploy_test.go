@@ -0,0 +1,157 @@
+package GoLib
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateServiceSpecFromPayloadDeploy(t *testing.T) {
+	maxAttempts := uint64(3)
+	parallelism := uint64(2)
+
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName: "query_service",
+		Deploy: Deploy{
+			Replicas:  NewReplicas(3),
+			Placement: Placement{Constraints: []string{"node.role == manager"}},
+			Resources: Resources{
+				Limits:       Resource{Memory: "512M", Cpus: "0.5"},
+				Reservations: Resource{Memory: "128m"},
+			},
+			RestartPolicy: &RestartPolicy{Condition: "on-failure", Delay: "5s", MaxAttempts: &maxAttempts},
+			UpdateConfig:  &UpdateConfig{Parallelism: &parallelism, Order: "start-first", FailureAction: "rollback"},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(3), *spec.Mode.Replicated.Replicas)
+	assert.Equal(t, []string{"node.role == manager"}, spec.TaskTemplate.Placement.Constraints)
+	assert.Equal(t, int64(512*1024*1024), spec.TaskTemplate.Resources.Limits.MemoryBytes)
+	assert.Equal(t, int64(500000000), spec.TaskTemplate.Resources.Limits.NanoCPUs)
+	assert.Equal(t, int64(128*1024*1024), spec.TaskTemplate.Resources.Reservations.MemoryBytes)
+
+	assert.Equal(t, swarm.RestartPolicyConditionOnFailure, spec.TaskTemplate.RestartPolicy.Condition)
+	assert.Equal(t, 5*time.Second, *spec.TaskTemplate.RestartPolicy.Delay)
+	assert.Equal(t, uint64(3), *spec.TaskTemplate.RestartPolicy.MaxAttempts)
+
+	assert.Equal(t, uint64(2), spec.UpdateConfig.Parallelism)
+	assert.Equal(t, swarm.UpdateOrderStartFirst, spec.UpdateConfig.Order)
+	assert.Equal(t, swarm.UpdateFailureActionRollback, spec.UpdateConfig.FailureAction)
+}
+
+func TestCreateServiceSpecFromPayloadGlobal(t *testing.T) {
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName: "log_collector",
+		Deploy: Deploy{
+			Mode:         "global",
+			EndpointMode: "dnsrr",
+			Placement: Placement{
+				Preferences: []PlacementPreference{{Spread: "node.labels.zone"}},
+			},
+			Resources: Resources{
+				Reservations: Resource{GenericResources: []GenericResource{
+					{DiscreteResourceSpec: &DiscreteGenericResource{Kind: "gpu", Value: 2}},
+				}},
+			},
+			RollbackConfig: &UpdateConfig{Monitor: "10s", FailureAction: "continue"},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, spec.Mode.Replicated)
+	assert.NotNil(t, spec.Mode.Global)
+	assert.Equal(t, swarm.ResolutionModeDNSRR, spec.EndpointSpec.Mode)
+	assert.Equal(t, "node.labels.zone", spec.TaskTemplate.Placement.Preferences[0].Spread.SpreadDescriptor)
+	assert.Equal(t, []swarm.GenericResource{
+		{DiscreteResourceSpec: &swarm.DiscreteGenericResource{Kind: "gpu", Value: 2}},
+	}, spec.TaskTemplate.Resources.Reservations.GenericResources)
+	assert.Equal(t, 10*time.Second, spec.RollbackConfig.Monitor)
+	assert.Equal(t, swarm.UpdateFailureActionContinue, spec.RollbackConfig.FailureAction)
+	assert.Nil(t, spec.UpdateConfig)
+}
+
+func TestCreateServiceSpecFromPayloadDefaults(t *testing.T) {
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{ImageName: "query_service"}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(1), *spec.Mode.Replicated.Replicas)
+	assert.Nil(t, spec.TaskTemplate.Placement)
+	assert.Nil(t, spec.TaskTemplate.Resources)
+	assert.Nil(t, spec.TaskTemplate.RestartPolicy)
+	assert.Nil(t, spec.UpdateConfig)
+}
+
+func TestCreateServiceSpecFromPayloadInvalidDeploy(t *testing.T) {
+	testCases := map[string]Deploy{
+		"memory":    {Resources: Resources{Limits: Resource{Memory: "lots"}}},
+		"cpus":      {Resources: Resources{Reservations: Resource{Cpus: "half"}}},
+		"condition": {RestartPolicy: &RestartPolicy{Condition: "always"}},
+		"delay":     {RestartPolicy: &RestartPolicy{Delay: "5"}},
+		"order":     {UpdateConfig: &UpdateConfig{Order: "random"}},
+		"mode":      {Mode: "replicated-job"},
+		"replicas":  {Mode: "global", Replicas: NewReplicas(2)},
+		"rollback":  {RollbackConfig: &UpdateConfig{FailureAction: "rollback"}},
+		"endpoint":  {EndpointMode: "round-robin"},
+		"spread":    {Placement: Placement{Preferences: []PlacementPreference{{}}}},
+		"max":       {Mode: "global", Placement: Placement{MaxReplicas: 1}},
+		"generic":   {Resources: Resources{Limits: Resource{GenericResources: []GenericResource{{DiscreteResourceSpec: &DiscreteGenericResource{Kind: "gpu", Value: 1}}}}}},
+		"dnsrr":     {EndpointMode: "dnsrr"},
+	}
+
+	for name, deploy := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := CreateServiceSpecFromPayload(CreateServicePayload{ImageName: "query_service", Ports: map[string]string{"8080": "80"}, Deploy: deploy}, nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	for input, expected := range map[string]int64{"512M": 512 << 20, "1g": 1 << 30, "1.5G": 3 << 29, "100": 100} {
+		memory, err := ParseMemory(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, memory, input)
+	}
+}
+
+func TestDeployZeroReplicas(t *testing.T) {
+	zero := uint64(0)
+	deploy := Deploy{Replicas: &zero}
+
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{ImageName: "query_service", Deploy: deploy}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), *spec.Mode.Replicated.Replicas)
+
+	// An explicit 0 is stored and written, only a missing value means 1 replica
+	data, err := json.Marshal(deploy)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"replicas": 0, "placement": {}, "resources": {"reservations": {}, "limits": {}}}`, string(data))
+
+	stack, err := MarshalStackFile(MicroServiceData{Services: map[string]MicroServiceDetails{
+		"query": {Image: "query_service", Deploy: deploy},
+	}}, ExternalDockerConfig{})
+	require.NoError(t, err)
+	assert.Contains(t, string(stack), "    deploy:\n      replicas: 0\n")
+
+	// Scaling a running service to zero stops its tasks
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service"})
+	_, err = UpdateDockerService(fake, id, CreateServicePayload{ImageName: "query_service", Deploy: deploy})
+	require.NoError(t, err)
+	service, _, err := fake.ServiceInspectWithRaw(context.Background(), id, types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), *service.Spec.Mode.Replicated.Replicas)
+}
+
+func TestDeployGetReplicas(t *testing.T) {
+	assert.Equal(t, uint64(1), Deploy{}.GetReplicas())
+	assert.Equal(t, uint64(0), Deploy{Replicas: NewReplicas(0)}.GetReplicas())
+	assert.Equal(t, uint64(5), Deploy{Replicas: NewReplicas(5)}.GetReplicas())
+}
@@ -0,0 +1,192 @@
+package GoLib
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Labels Swarm sets on the containers of tasks.
+const (
+	swarmServiceIDLabel   = "com.docker.swarm.service.id"
+	swarmServiceNameLabel = "com.docker.swarm.service.name"
+	swarmTaskIDLabel      = "com.docker.swarm.task.id"
+	swarmTaskNameLabel    = "com.docker.swarm.task.name"
+	swarmNodeIDLabel      = "com.docker.swarm.node.id"
+)
+
+// SwarmEvent is a Docker event about a service, or about a container running a task of a service.
+// Kind is events.ServiceEventType or events.ContainerEventType. Action is the Docker action, like
+// create, update and remove for services and start, die, oom and health_status for containers.
+type SwarmEvent struct {
+	Kind        string
+	Action      string
+	ServiceID   string
+	ServiceName string
+	// TaskID, TaskName, ContainerID and NodeID are only set for container events
+	TaskID      string
+	TaskName    string
+	ContainerID string
+	NodeID      string
+	// ExitCode is set for die events, Health for health_status events
+	ExitCode   int
+	Health     string
+	Time       time.Time
+	Attributes map[string]string
+}
+
+type EventOption func(*eventOptions)
+
+type eventOptions struct {
+	since     time.Time
+	unmanaged bool
+}
+
+// EventsSince replays the events since a point in time before following new events.
+func EventsSince(since time.Time) EventOption {
+	return func(o *eventOptions) {
+		o.since = since
+	}
+}
+
+// EventsIncludeUnmanaged also returns events of services that do not carry ManagedByLabel.
+func EventsIncludeUnmanaged() EventOption {
+	return func(o *eventOptions) {
+		o.unmanaged = true
+	}
+}
+
+// SubscribeSwarmEvents follows the Docker events of the services created by this library and of
+// the containers running their tasks. Both channels are closed when the context is cancelled or
+// the event stream fails, in which case the error is sent first.
+func SubscribeSwarmEvents(ctx context.Context, cli DockerClient, opts ...EventOption) (<-chan SwarmEvent, <-chan error) {
+	options := eventOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	out := make(chan SwarmEvent)
+	errs := make(chan error, 1)
+
+	eventsOptions := types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", events.ServiceEventType),
+			filters.Arg("type", events.ContainerEventType),
+		),
+	}
+	if !options.since.IsZero() {
+		eventsOptions.Since = strconv.FormatInt(options.since.Unix(), 10)
+	}
+	messages, messageErrs := cli.Events(ctx, eventsOptions)
+
+	go func() {
+		defer close(out)
+		defer close(errs)
+
+		managed := managedServices{cli: cli, known: make(map[string]bool)}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-messageErrs:
+				if ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				event, ok := convertEvent(message)
+				if !ok || (!options.unmanaged && !managed.isManaged(ctx, event)) {
+					continue
+				}
+
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, errs
+}
+
+// convertEvent converts service events and container events of Swarm tasks, other events are skipped.
+func convertEvent(message events.Message) (SwarmEvent, bool) {
+	attributes := message.Actor.Attributes
+	event := SwarmEvent{
+		Kind:       message.Type,
+		Action:     message.Action,
+		Time:       time.Unix(0, message.TimeNano),
+		Attributes: attributes,
+	}
+	if message.TimeNano == 0 {
+		event.Time = time.Unix(message.Time, 0)
+	}
+
+	switch message.Type {
+	case events.ServiceEventType:
+		event.ServiceID = message.Actor.ID
+		event.ServiceName = attributes["name"]
+
+	case events.ContainerEventType:
+		if attributes[swarmServiceIDLabel] == "" {
+			return event, false
+		}
+		event.ServiceID = attributes[swarmServiceIDLabel]
+		event.ServiceName = attributes[swarmServiceNameLabel]
+		event.TaskID = attributes[swarmTaskIDLabel]
+		event.TaskName = attributes[swarmTaskNameLabel]
+		event.NodeID = attributes[swarmNodeIDLabel]
+		event.ContainerID = message.Actor.ID
+
+		// Health changes come as "health_status: healthy"
+		if action, health, ok := strings.Cut(message.Action, ": "); ok && action == "health_status" {
+			event.Action, event.Health = action, health
+		}
+		if exitCode, err := strconv.Atoi(attributes["exitCode"]); err == nil {
+			event.ExitCode = exitCode
+		}
+
+	default:
+		return event, false
+	}
+
+	return event, true
+}
+
+// managedServices remembers which service IDs carry ManagedByLabel. Service events do not include
+// the labels of the service, so unknown services are inspected once.
+type managedServices struct {
+	cli   DockerClient
+	known map[string]bool
+}
+
+func (m *managedServices) isManaged(ctx context.Context, event SwarmEvent) bool {
+	managed, ok := m.known[event.ServiceID]
+	if !ok {
+		service, _, err := m.cli.ServiceInspectWithRaw(ctx, event.ServiceID, types.ServiceInspectOptions{})
+		if err != nil {
+			if !client.IsErrNotFound(err) {
+				log.Warnf("Failed to inspect service %s of event: %v", event.ServiceID, err)
+			}
+			return false
+		}
+		managed = service.Spec.Labels[ManagedByLabel] == ManagedByValue
+		m.known[event.ServiceID] = managed
+	}
+
+	if event.Kind == events.ServiceEventType && event.Action == "remove" {
+		delete(m.known, event.ServiceID)
+	}
+	return managed
+}
@@ -0,0 +1,91 @@
+package GoLib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertEvent(t *testing.T) {
+	event, ok := convertEvent(events.Message{
+		Type:   events.ContainerEventType,
+		Action: "health_status: unhealthy",
+		Actor: events.Actor{ID: "container1", Attributes: map[string]string{
+			swarmServiceIDLabel:   "service1",
+			swarmServiceNameLabel: "query",
+			swarmTaskIDLabel:      "task1",
+			swarmNodeIDLabel:      "node1",
+		}},
+		Time: 1700000000,
+	})
+	require.True(t, ok)
+	assert.Equal(t, "health_status", event.Action)
+	assert.Equal(t, "unhealthy", event.Health)
+	assert.Equal(t, "query", event.ServiceName)
+	assert.Equal(t, "task1", event.TaskID)
+	assert.Equal(t, "container1", event.ContainerID)
+	assert.Equal(t, time.Unix(1700000000, 0), event.Time)
+
+	event, ok = convertEvent(events.Message{
+		Type:   events.ContainerEventType,
+		Action: "die",
+		Actor: events.Actor{ID: "container1", Attributes: map[string]string{
+			swarmServiceIDLabel: "service1",
+			"exitCode":          "137",
+		}},
+	})
+	require.True(t, ok)
+	assert.Equal(t, 137, event.ExitCode)
+
+	// Containers that are not part of a service and other event types are skipped
+	_, ok = convertEvent(events.Message{Type: events.ContainerEventType, Action: "start", Actor: events.Actor{ID: "c"}})
+	assert.False(t, ok)
+	_, ok = convertEvent(events.Message{Type: events.NetworkEventType, Action: "create"})
+	assert.False(t, ok)
+}
+
+func TestSubscribeSwarmEvents(t *testing.T) {
+	fake := NewFakeSwarm()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventsCh, errs := SubscribeSwarmEvents(ctx, fake)
+
+	// Not created from a payload, so without the managed-by label
+	_, err := fake.ServiceCreate(ctx, swarm.ServiceSpec{
+		Annotations:  swarm.Annotations{Name: "other"},
+		TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "other:1.0"}},
+	}, types.ServiceCreateOptions{})
+	require.NoError(t, err)
+
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service", Tag: "1.0"})
+
+	received := []SwarmEvent{}
+	for len(received) < 2 {
+		select {
+		case event := <-eventsCh:
+			received = append(received, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, received %v", received)
+		}
+	}
+
+	assert.Equal(t, events.ServiceEventType, received[0].Kind)
+	assert.Equal(t, "create", received[0].Action)
+	assert.Equal(t, id, received[0].ServiceID)
+	assert.Equal(t, events.ContainerEventType, received[1].Kind)
+	assert.Equal(t, "start", received[1].Action)
+	assert.Equal(t, id, received[1].ServiceID)
+	assert.NotEmpty(t, received[1].TaskID)
+
+	cancel()
+	for range eventsCh {
+	}
+	assert.NoError(t, <-errs)
+}
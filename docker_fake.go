@@ -0,0 +1,703 @@
+package GoLib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+var _ DockerClient = (*FakeSwarm)(nil)
+
+// FakeSwarm is an in-memory, single node Swarm implementing DockerClient, meant for tests.
+// Services get versioned like in Swarm, so out of sequence updates are rejected, and every
+// create or update replaces the tasks of a service by new running tasks. With SetManualRollouts
+// the old tasks of an updated service keep running until CompleteRollout. Use UpdateTasks to
+// simulate tasks that fail or can not be scheduled. Service changes and task starts are published
+// as events, and lines added with AddServiceLog are returned by ServiceLogs.
+type FakeSwarm struct {
+	mu      sync.Mutex
+	nextID  int
+	manager bool
+	// manualRollouts keeps updated services in the updating state until CompleteRollout
+	manualRollouts bool
+	services       map[string]*swarm.Service
+	tasks          map[string][]swarm.Task
+	secrets        map[string]swarm.Secret
+	configs        map[string]swarm.Config
+	networks       map[string]types.NetworkResource
+	volumes        map[string]volume.Volume
+	logs           map[string][]fakeLogLine
+	// subscribers receive the events published while they are subscribed, with their type filters
+	subscribers map[chan events.Message]filters.Args
+}
+
+type fakeLogLine struct {
+	stream stdcopy.StdType
+	line   string
+}
+
+func NewFakeSwarm() *FakeSwarm {
+	return &FakeSwarm{
+		manager:  true,
+		services: make(map[string]*swarm.Service),
+		tasks:    make(map[string][]swarm.Task),
+		secrets:  make(map[string]swarm.Secret),
+		configs:  make(map[string]swarm.Config),
+		networks: make(map[string]types.NetworkResource),
+		volumes:  make(map[string]volume.Volume),
+		logs:     make(map[string][]fakeLogLine),
+
+		subscribers: make(map[chan events.Message]filters.Args),
+	}
+}
+
+// SetManager sets whether Info reports the node as a swarm manager, default true.
+func (f *FakeSwarm) SetManager(manager bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.manager = manager
+}
+
+// SetManualRollouts sets whether updates of services are rolled out only when CompleteRollout is
+// called, instead of right away. Until then the service is updating and its old tasks keep running.
+func (f *FakeSwarm) SetManualRollouts(manual bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.manualRollouts = manual
+}
+
+// CompleteRollout replaces the tasks of an updating service (by name or ID) and marks its update completed.
+func (f *FakeSwarm) CompleteRollout(serviceName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, err := f.lookupService(serviceName)
+	if err != nil {
+		return err
+	}
+	if service.UpdateStatus == nil || (service.UpdateStatus.State != swarm.UpdateStateUpdating && service.UpdateStatus.State != swarm.UpdateStateRollbackStarted) {
+		return fmt.Errorf("service %s is not being updated", serviceName)
+	}
+	f.completeRollout(service, time.Now())
+	return nil
+}
+
+// UpdateTasks calls update for every current task of a service (by name or ID), for example to mark
+// them as failed.
+func (f *FakeSwarm) UpdateTasks(serviceName string, update func(task *swarm.Task)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, err := f.lookupService(serviceName)
+	if err != nil {
+		return err
+	}
+
+	tasks := f.tasks[service.ID]
+	for i := range tasks {
+		if tasks[i].DesiredState == swarm.TaskStateRunning {
+			update(&tasks[i])
+		}
+	}
+	return nil
+}
+
+// AddServiceLog adds a line to the logs of a service (by name or ID), written by its first running task.
+func (f *FakeSwarm) AddServiceLog(serviceName string, stderr bool, line string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, err := f.lookupService(serviceName)
+	if err != nil {
+		return err
+	}
+
+	stream := stdcopy.Stdout
+	if stderr {
+		stream = stdcopy.Stderr
+	}
+	f.logs[service.ID] = append(f.logs[service.ID], fakeLogLine{stream: stream, line: line})
+	return nil
+}
+
+func (f *FakeSwarm) Info(ctx context.Context) (types.Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info := types.Info{ID: "fake", Name: "fake-swarm"}
+	info.Swarm.LocalNodeState = swarm.LocalNodeStateActive
+	info.Swarm.ControlAvailable = f.manager
+	return info, nil
+}
+
+func (f *FakeSwarm) ServiceCreate(ctx context.Context, spec swarm.ServiceSpec, options types.ServiceCreateOptions) (types.ServiceCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if spec.Name == "" {
+		return types.ServiceCreateResponse{}, errdefs.InvalidParameter(fmt.Errorf("service name is required"))
+	}
+	for _, service := range f.services {
+		if service.Spec.Name == spec.Name {
+			return types.ServiceCreateResponse{}, errdefs.Conflict(fmt.Errorf("service %s already exists", spec.Name))
+		}
+	}
+
+	now := time.Now()
+	service := &swarm.Service{
+		ID:   f.newID("service"),
+		Spec: copySpec(spec),
+	}
+	service.Version.Index = 1
+	service.CreatedAt = now
+	service.UpdatedAt = now
+
+	f.services[service.ID] = service
+	f.publishServiceEvent(service, "create", now)
+	f.replaceTasks(service, now)
+
+	return types.ServiceCreateResponse{ID: service.ID}, nil
+}
+
+func (f *FakeSwarm) ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, spec swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, err := f.lookupService(serviceID)
+	if err != nil {
+		return types.ServiceUpdateResponse{}, err
+	}
+	if version.Index != service.Version.Index {
+		return types.ServiceUpdateResponse{}, errdefs.Unknown(fmt.Errorf("rpc error: code = Unknown desc = update out of sequence"))
+	}
+
+	previous := copySpec(service.Spec)
+	switch options.Rollback {
+	case "":
+		if serviceModeName(spec.Mode) != serviceModeName(service.Spec.Mode) {
+			return types.ServiceUpdateResponse{}, errdefs.NotImplemented(fmt.Errorf("rpc error: code = Unimplemented desc = service mode change is not allowed"))
+		}
+		service.Spec = copySpec(spec)
+	case "previous":
+		if service.PreviousSpec == nil {
+			return types.ServiceUpdateResponse{}, errdefs.InvalidParameter(fmt.Errorf("service %s does not have a previous spec", service.ID))
+		}
+		service.Spec = copySpec(*service.PreviousSpec)
+	default:
+		return types.ServiceUpdateResponse{}, errdefs.InvalidParameter(fmt.Errorf("unknown rollback option %q", options.Rollback))
+	}
+
+	now := time.Now()
+	service.PreviousSpec = &previous
+	service.Version.Index++
+	service.UpdatedAt = now
+	service.UpdateStatus = &swarm.UpdateStatus{State: swarm.UpdateStateUpdating, StartedAt: &now}
+	if options.Rollback != "" {
+		service.UpdateStatus.State = swarm.UpdateStateRollbackStarted
+	}
+	f.publishServiceEvent(service, "update", now)
+	if !f.manualRollouts {
+		f.completeRollout(service, now)
+	}
+
+	return types.ServiceUpdateResponse{}, nil
+}
+
+func (f *FakeSwarm) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	services := []swarm.Service{}
+	for _, service := range f.services {
+		if matchesFilters(options.Filters, service.ID, service.Spec.Annotations) {
+			services = append(services, copyService(*service))
+		}
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Spec.Name < services[j].Spec.Name })
+	return services, nil
+}
+
+func (f *FakeSwarm) ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, err := f.lookupService(serviceID)
+	if err != nil {
+		return swarm.Service{}, nil, err
+	}
+
+	raw, err := json.Marshal(service)
+	return copyService(*service), raw, err
+}
+
+func (f *FakeSwarm) ServiceRemove(ctx context.Context, serviceID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, err := f.lookupService(serviceID)
+	if err != nil {
+		return err
+	}
+
+	delete(f.services, service.ID)
+	delete(f.tasks, service.ID)
+	delete(f.logs, service.ID)
+	f.publishServiceEvent(service, "remove", time.Now())
+	return nil
+}
+
+// ServiceLogs returns the lines added with AddServiceLog as a multiplexed stream. It ignores
+// Follow, Since and Tail, and only adds details when they are asked for.
+func (f *FakeSwarm) ServiceLogs(ctx context.Context, serviceID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	service, err := f.lookupService(serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := ""
+	for _, task := range f.tasks[service.ID] {
+		if task.DesiredState == swarm.TaskStateRunning {
+			details = fmt.Sprintf("com.docker.swarm.node.id=%s,com.docker.swarm.service.id=%s,com.docker.swarm.task.id=%s ",
+				task.NodeID, service.ID, task.ID)
+			break
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	for _, line := range f.logs[service.ID] {
+		if (line.stream == stdcopy.Stdout && !options.ShowStdout) || (line.stream == stdcopy.Stderr && !options.ShowStderr) {
+			continue
+		}
+		message := line.line + "\n"
+		if options.Details {
+			message = details + message
+		}
+		if _, err := stdcopy.NewStdWriter(buffer, line.stream).Write([]byte(message)); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(buffer), nil
+}
+
+// TaskList supports the service, desired-state and label filters.
+func (f *FakeSwarm) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	args := options.Filters
+	serviceIDs := make(map[string]bool)
+	for _, name := range args.Get("service") {
+		if service, err := f.lookupService(name); err == nil {
+			serviceIDs[service.ID] = true
+		}
+	}
+
+	tasks := []swarm.Task{}
+	for serviceID, serviceTasks := range f.tasks {
+		if args.Contains("service") && !serviceIDs[serviceID] {
+			continue
+		}
+		for _, task := range serviceTasks {
+			if args.Contains("desired-state") && !args.ExactMatch("desired-state", string(task.DesiredState)) {
+				continue
+			}
+			if !args.MatchKVList("label", task.Labels) {
+				continue
+			}
+			tasks = append(tasks, task)
+		}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+// Events publishes the events of changes made after subscribing, Since and Until are ignored.
+// It only supports the type filter. Like the Docker client, the context error is sent when the
+// context is cancelled.
+func (f *FakeSwarm) Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	messages := make(chan events.Message, 100)
+	errs := make(chan error, 1)
+	f.subscribers[messages] = options.Filters
+
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.subscribers, messages)
+		errs <- ctx.Err()
+	}()
+
+	return messages, errs
+}
+
+func (f *FakeSwarm) SecretCreate(ctx context.Context, spec swarm.SecretSpec) (types.SecretCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, secret := range f.secrets {
+		if secret.Spec.Name == spec.Name {
+			return types.SecretCreateResponse{}, errdefs.Conflict(fmt.Errorf("secret %s already exists", spec.Name))
+		}
+	}
+
+	secret := swarm.Secret{ID: f.newID("secret"), Spec: spec}
+	secret.Version.Index = 1
+	secret.CreatedAt = time.Now()
+	secret.UpdatedAt = secret.CreatedAt
+	f.secrets[secret.ID] = secret
+
+	return types.SecretCreateResponse{ID: secret.ID}, nil
+}
+
+// SecretList supports the id, name and label filters. Like Swarm, it never returns the secret data.
+func (f *FakeSwarm) SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	secrets := []swarm.Secret{}
+	for _, secret := range f.secrets {
+		if matchesFilters(options.Filters, secret.ID, secret.Spec.Annotations) {
+			secret.Spec.Data = nil
+			secrets = append(secrets, secret)
+		}
+	}
+
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Spec.Name < secrets[j].Spec.Name })
+	return secrets, nil
+}
+
+// SecretRemove fails, like in Swarm, while a service still uses the secret.
+func (f *FakeSwarm) SecretRemove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.secrets[id]; !ok {
+		return errdefs.NotFound(fmt.Errorf("secret %s not found", id))
+	}
+	for _, service := range f.services {
+		if containerSpec := service.Spec.TaskTemplate.ContainerSpec; containerSpec != nil {
+			for _, ref := range containerSpec.Secrets {
+				if ref.SecretID == id {
+					return errdefs.InvalidParameter(fmt.Errorf("secret %s is in use by service %s", id, service.Spec.Name))
+				}
+			}
+		}
+	}
+
+	delete(f.secrets, id)
+	return nil
+}
+
+func (f *FakeSwarm) ConfigCreate(ctx context.Context, spec swarm.ConfigSpec) (types.ConfigCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, config := range f.configs {
+		if config.Spec.Name == spec.Name {
+			return types.ConfigCreateResponse{}, errdefs.Conflict(fmt.Errorf("config %s already exists", spec.Name))
+		}
+	}
+
+	config := swarm.Config{ID: f.newID("config"), Spec: spec}
+	config.Version.Index = 1
+	config.CreatedAt = time.Now()
+	config.UpdatedAt = config.CreatedAt
+	f.configs[config.ID] = config
+
+	return types.ConfigCreateResponse{ID: config.ID}, nil
+}
+
+// ConfigList supports the id, name and label filters.
+func (f *FakeSwarm) ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	configs := []swarm.Config{}
+	for _, config := range f.configs {
+		if matchesFilters(options.Filters, config.ID, config.Spec.Annotations) {
+			configs = append(configs, config)
+		}
+	}
+
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Spec.Name < configs[j].Spec.Name })
+	return configs, nil
+}
+
+// ConfigRemove fails, like in Swarm, while a service still uses the config.
+func (f *FakeSwarm) ConfigRemove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.configs[id]; !ok {
+		return errdefs.NotFound(fmt.Errorf("config %s not found", id))
+	}
+	for _, service := range f.services {
+		if containerSpec := service.Spec.TaskTemplate.ContainerSpec; containerSpec != nil {
+			for _, ref := range containerSpec.Configs {
+				if ref.ConfigID == id {
+					return errdefs.InvalidParameter(fmt.Errorf("config %s is in use by service %s", id, service.Spec.Name))
+				}
+			}
+		}
+	}
+
+	delete(f.configs, id)
+	return nil
+}
+
+func (f *FakeSwarm) NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.networks[name]; ok && options.CheckDuplicate {
+		return types.NetworkCreateResponse{}, errdefs.Conflict(fmt.Errorf("network with name %s already exists", name))
+	}
+
+	network := types.NetworkResource{
+		Name:       name,
+		ID:         f.newID("network"),
+		Created:    time.Now(),
+		Scope:      "swarm",
+		Driver:     options.Driver,
+		Attachable: options.Attachable,
+		Internal:   options.Internal,
+		Options:    options.Options,
+		Labels:     options.Labels,
+	}
+	f.networks[name] = network
+
+	return types.NetworkCreateResponse{ID: network.ID}, nil
+}
+
+func (f *FakeSwarm) NetworkInspect(ctx context.Context, networkID string, options types.NetworkInspectOptions) (types.NetworkResource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, network := range f.networks {
+		if network.Name == networkID || network.ID == networkID {
+			return network, nil
+		}
+	}
+	return types.NetworkResource{}, errdefs.NotFound(fmt.Errorf("network %s not found", networkID))
+}
+
+func (f *FakeSwarm) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := options.Name
+	if name == "" {
+		name = f.newID("volume")
+	}
+	// Like Docker, creating an existing volume returns the existing one
+	if existing, ok := f.volumes[name]; ok {
+		return existing, nil
+	}
+
+	driver := options.Driver
+	if driver == "" {
+		driver = "local"
+	}
+
+	vol := volume.Volume{
+		Name:       name,
+		Driver:     driver,
+		Options:    options.DriverOpts,
+		Labels:     options.Labels,
+		Scope:      "local",
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Mountpoint: "/var/lib/docker/volumes/" + name + "/_data",
+	}
+	f.volumes[name] = vol
+	return vol, nil
+}
+
+func (f *FakeSwarm) VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	vol, ok := f.volumes[volumeID]
+	if !ok {
+		return volume.Volume{}, errdefs.NotFound(fmt.Errorf("volume %s not found", volumeID))
+	}
+	return vol, nil
+}
+
+// lookupService finds a service by ID, name or unique ID prefix, the caller must hold the lock.
+func (f *FakeSwarm) lookupService(nameOrID string) (*swarm.Service, error) {
+	if service, ok := f.services[nameOrID]; ok {
+		return service, nil
+	}
+
+	var found *swarm.Service
+	for id, service := range f.services {
+		if service.Spec.Name == nameOrID {
+			return service, nil
+		}
+		if strings.HasPrefix(id, nameOrID) {
+			if found != nil {
+				return nil, errdefs.InvalidParameter(fmt.Errorf("service %s is ambiguous", nameOrID))
+			}
+			found = service
+		}
+	}
+
+	if found == nil {
+		return nil, errdefs.NotFound(fmt.Errorf("service %s not found", nameOrID))
+	}
+	return found, nil
+}
+
+// completeRollout replaces the tasks of an updated service, like Swarm does once the update is rolled out.
+func (f *FakeSwarm) completeRollout(service *swarm.Service, now time.Time) {
+	f.replaceTasks(service, now)
+	service.UpdateStatus.CompletedAt = &now
+	if service.UpdateStatus.State == swarm.UpdateStateRollbackStarted {
+		service.UpdateStatus.State = swarm.UpdateStateRollbackCompleted
+	} else {
+		service.UpdateStatus.State = swarm.UpdateStateCompleted
+	}
+}
+
+// replaceTasks shuts down the running tasks of a service and starts new ones for every replica.
+func (f *FakeSwarm) replaceTasks(service *swarm.Service, now time.Time) {
+	tasks := f.tasks[service.ID]
+	for i := range tasks {
+		if tasks[i].DesiredState == swarm.TaskStateRunning {
+			tasks[i].DesiredState = swarm.TaskStateShutdown
+			tasks[i].Status.State = swarm.TaskStateShutdown
+			tasks[i].UpdatedAt = now
+		}
+	}
+
+	// A single node runs exactly one task of a global service
+	replicas := uint64(1)
+	if replicated := service.Spec.Mode.Replicated; replicated != nil && replicated.Replicas != nil {
+		replicas = *replicated.Replicas
+	}
+
+	for slot := 1; slot <= int(replicas); slot++ {
+		task := swarm.Task{
+			ID:           f.newID("task"),
+			ServiceID:    service.ID,
+			Slot:         slot,
+			NodeID:       "fake",
+			Spec:         service.Spec.TaskTemplate,
+			DesiredState: swarm.TaskStateRunning,
+			Status: swarm.TaskStatus{
+				Timestamp: now,
+				State:     swarm.TaskStateRunning,
+				Message:   "started",
+			},
+		}
+		task.Version.Index = service.Version.Index
+		task.CreatedAt = now
+		task.UpdatedAt = now
+		if service.Spec.TaskTemplate.ContainerSpec != nil {
+			task.Labels = service.Spec.TaskTemplate.ContainerSpec.Labels
+		}
+		task.Status.ContainerStatus = &swarm.ContainerStatus{ContainerID: f.newID("container")}
+		tasks = append(tasks, task)
+
+		f.publish(events.Message{
+			Type:   events.ContainerEventType,
+			Action: "start",
+			Actor: events.Actor{
+				ID: task.Status.ContainerStatus.ContainerID,
+				Attributes: map[string]string{
+					swarmServiceIDLabel:   service.ID,
+					swarmServiceNameLabel: service.Spec.Name,
+					swarmTaskIDLabel:      task.ID,
+					swarmTaskNameLabel:    fmt.Sprintf("%s.%d.%s", service.Spec.Name, slot, task.ID),
+					swarmNodeIDLabel:      task.NodeID,
+				},
+			},
+			Scope: "local",
+		}, now)
+	}
+
+	f.tasks[service.ID] = tasks
+}
+
+func (f *FakeSwarm) publishServiceEvent(service *swarm.Service, action string, now time.Time) {
+	f.publish(events.Message{
+		Type:   events.ServiceEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         service.ID,
+			Attributes: map[string]string{"name": service.Spec.Name},
+		},
+		Scope: "swarm",
+	}, now)
+}
+
+// publish sends an event to the subscribers, dropping it for subscribers that do not keep up.
+// The caller must hold the lock.
+func (f *FakeSwarm) publish(message events.Message, now time.Time) {
+	message.Time = now.Unix()
+	message.TimeNano = now.UnixNano()
+	for subscriber, args := range f.subscribers {
+		if args.Contains("type") && !args.ExactMatch("type", message.Type) {
+			continue
+		}
+		select {
+		case subscriber <- message:
+		default:
+		}
+	}
+}
+
+// newID returns a unique, sortable ID, the caller must hold the lock.
+func (f *FakeSwarm) newID(kind string) string {
+	f.nextID++
+	return fmt.Sprintf("%s%06d", kind, f.nextID)
+}
+
+// matchesFilters applies the id, name (prefix) and label filters shared by the list calls.
+func matchesFilters(args filters.Args, id string, annotations swarm.Annotations) bool {
+	if args.Contains("id") && !args.ExactMatch("id", id) {
+		return false
+	}
+
+	if args.Contains("name") {
+		matched := false
+		for _, name := range args.Get("name") {
+			matched = matched || strings.HasPrefix(annotations.Name, name)
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return args.MatchKVList("label", annotations.Labels)
+}
+
+// copySpec deep copies a spec through JSON, so callers can not change the stored state.
+func copyService(service swarm.Service) swarm.Service {
+	copied := swarm.Service{}
+	data, _ := json.Marshal(service)
+	_ = json.Unmarshal(data, &copied)
+	return copied
+}
@@ -0,0 +1,54 @@
+package GoLib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeSwarmServiceVersions(t *testing.T) {
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	spec := swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "query"}}
+	created, err := fake.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+	require.NoError(t, err)
+
+	_, err = fake.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+	assert.Error(t, err)
+
+	service, _, err := fake.ServiceInspectWithRaw(ctx, "query", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, service.ID)
+
+	_, err = fake.ServiceUpdate(ctx, service.ID, service.Version, spec, types.ServiceUpdateOptions{})
+	require.NoError(t, err)
+
+	// The version read before the first update is stale now
+	_, err = fake.ServiceUpdate(ctx, service.ID, service.Version, spec, types.ServiceUpdateOptions{})
+	assert.True(t, isOutOfSequence(err))
+
+	tasks, err := fake.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", "query"), filters.Arg("desired-state", "running")),
+	})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	require.NoError(t, fake.ServiceRemove(ctx, "query"))
+	_, _, err = fake.ServiceInspectWithRaw(ctx, "query", types.ServiceInspectOptions{})
+	assert.True(t, client.IsErrNotFound(err))
+}
+
+func TestCheckSwarmManager(t *testing.T) {
+	fake := NewFakeSwarm()
+	assert.NoError(t, checkSwarmManager(fake))
+
+	fake.SetManager(false)
+	assert.ErrorIs(t, checkSwarmManager(fake), ErrNotSwarmManager)
+}
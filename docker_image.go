@@ -0,0 +1,112 @@
+package GoLib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultImageRegistry is the registry of images without a registry, Docker Hub.
+	DefaultImageRegistry = "docker.io"
+	// DefaultImageTag is the tag of images without a tag or digest.
+	DefaultImageTag = "latest"
+)
+
+var (
+	registryPattern  = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?\.?)+(?::[0-9]+)?$|^\[[0-9a-fA-F:]+\](?::[0-9]+)?$`)
+	componentPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagPattern       = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestPattern    = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// ImageReference is a parsed image reference, like "registry.local:5000/team/anonymize:1.2".
+// Parts that are not in the reference are empty, Normalize fills in the Docker Hub defaults.
+type ImageReference struct {
+	// Registry is the host of the registry, with an optional port
+	Registry string
+	// Repository is the path of the image within the registry, like "team/anonymize"
+	Repository string
+	Tag        string
+	// Digest pins the image to its content, like "sha256:..."
+	Digest string
+}
+
+// ParseImageReference parses "[registry/]repository[:tag][@digest]". Like Docker, the first part
+// of the path is the registry when it contains a "." or ":" or is "localhost".
+func ParseImageReference(image string) (ImageReference, error) {
+	ref := ImageReference{}
+	if image == "" {
+		return ref, fmt.Errorf("image reference is empty")
+	}
+
+	name := image
+	if at := strings.IndexByte(name, '@'); at >= 0 {
+		name, ref.Digest = name[:at], name[at+1:]
+		if !digestPattern.MatchString(ref.Digest) {
+			return ImageReference{}, fmt.Errorf("invalid digest %q in image %s", ref.Digest, image)
+		}
+	}
+
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, name = first, rest
+		if !registryPattern.MatchString(ref.Registry) {
+			return ImageReference{}, fmt.Errorf("invalid registry %q in image %s", ref.Registry, image)
+		}
+	}
+
+	// After the registry a colon can only start the tag
+	if colon := strings.LastIndexByte(name, ':'); colon >= 0 {
+		name, ref.Tag = name[:colon], name[colon+1:]
+		if !tagPattern.MatchString(ref.Tag) {
+			return ImageReference{}, fmt.Errorf("invalid tag %q in image %s", ref.Tag, image)
+		}
+	}
+
+	ref.Repository = name
+	for _, component := range strings.Split(name, "/") {
+		if !componentPattern.MatchString(component) {
+			return ImageReference{}, fmt.Errorf("invalid repository %q in image %s, it must be lowercase", name, image)
+		}
+	}
+	return ref, nil
+}
+
+// Normalize returns the reference with the Docker Hub defaults filled in: the docker.io
+// registry, the library namespace for official images and the latest tag.
+func (r ImageReference) Normalize() ImageReference {
+	if r.Registry == "" || r.Registry == "index.docker.io" {
+		r.Registry = DefaultImageRegistry
+	}
+	if r.Registry == DefaultImageRegistry && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = DefaultImageTag
+	}
+	return r
+}
+
+// Name returns the registry and repository, without tag and digest.
+func (r ImageReference) Name() string {
+	if r.Registry == "" {
+		return r.Repository
+	}
+	return r.Registry + "/" + r.Repository
+}
+
+// Alias returns the last part of the repository, which is used as network alias of services.
+func (r ImageReference) Alias() string {
+	return r.Repository[strings.LastIndexByte(r.Repository, '/')+1:]
+}
+
+func (r ImageReference) String() string {
+	image := r.Name()
+	if r.Tag != "" {
+		image += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		image += "@" + r.Digest
+	}
+	return image
+}
@@ -0,0 +1,69 @@
+package GoLib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "sha256:3b4f1b2d4c5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8"
+
+func TestParseImageReference(t *testing.T) {
+	testCases := []struct {
+		image      string
+		expected   ImageReference
+		normalized string
+	}{
+		{"anonymize", ImageReference{Repository: "anonymize"}, "docker.io/library/anonymize:latest"},
+		{"team/anonymize:1.2", ImageReference{Repository: "team/anonymize", Tag: "1.2"}, "docker.io/team/anonymize:1.2"},
+		{
+			"registry.local:5000/anonymize:1.2",
+			ImageReference{Registry: "registry.local:5000", Repository: "anonymize", Tag: "1.2"},
+			"registry.local:5000/anonymize:1.2",
+		},
+		{"localhost/team/query", ImageReference{Registry: "localhost", Repository: "team/query"}, "localhost/team/query:latest"},
+		{"nginx@" + testDigest, ImageReference{Repository: "nginx", Digest: testDigest}, "docker.io/library/nginx@" + testDigest},
+		{
+			"registry.local:5000/nginx:1.25@" + testDigest,
+			ImageReference{Registry: "registry.local:5000", Repository: "nginx", Tag: "1.25", Digest: testDigest},
+			"registry.local:5000/nginx:1.25@" + testDigest,
+		},
+		{"index.docker.io/nginx", ImageReference{Registry: "index.docker.io", Repository: "nginx"}, "docker.io/library/nginx:latest"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.image, func(t *testing.T) {
+			ref, err := ParseImageReference(testCase.image)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, ref)
+			assert.Equal(t, testCase.image, ref.String())
+			assert.Equal(t, testCase.normalized, ref.Normalize().String())
+		})
+	}
+
+	for _, image := range []string{"", "Anonymize", "anonymize:", "anonymize:-1", "nginx@sha256:short", "registry_host:5000/nginx", "team//query"} {
+		_, err := ParseImageReference(image)
+		assert.Error(t, err, image)
+	}
+}
+
+func TestCreateServiceSpecImageReference(t *testing.T) {
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName: "registry.local:5000/team/anonymize",
+		Tag:       "1.2",
+		Networks:  []string{"unl_1"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymize", spec.Name)
+	assert.Equal(t, "registry.local:5000/team/anonymize:1.2", spec.TaskTemplate.ContainerSpec.Image)
+	assert.Equal(t, []string{"anonymize"}, spec.TaskTemplate.Networks[0].Aliases)
+
+	// A digest pins the image without defaulting the tag
+	spec, err = CreateServiceSpecFromPayload(CreateServicePayload{ImageName: "nginx", Digest: testDigest}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io/library/nginx@"+testDigest, spec.TaskTemplate.ContainerSpec.Image)
+
+	_, err = CreateServiceSpecFromPayload(CreateServicePayload{ImageName: "Nginx"}, nil)
+	assert.Error(t, err)
+}
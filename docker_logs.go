@@ -0,0 +1,163 @@
+package GoLib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/sirupsen/logrus"
+)
+
+type LogOption func(*logOptions)
+
+type logOptions struct {
+	follow bool
+	since  string
+	tail   string
+	logger *logrus.Entry
+}
+
+// LogsFollow keeps streaming new log lines until the context is cancelled.
+func LogsFollow() LogOption {
+	return func(o *logOptions) {
+		o.follow = true
+	}
+}
+
+// LogsSince only streams lines since a timestamp or relative duration, like "10m".
+func LogsSince(since string) LogOption {
+	return func(o *logOptions) {
+		o.since = since
+	}
+}
+
+// LogsTail starts with the last lines of every task, "all" by default.
+func LogsTail(lines string) LogOption {
+	return func(o *logOptions) {
+		o.tail = lines
+	}
+}
+
+// LogsTo logs the lines to another logger than the package logger.
+func LogsTo(logger *logrus.Entry) LogOption {
+	return func(o *logOptions) {
+		o.logger = logger
+	}
+}
+
+// StreamServiceLogs writes the logs of all tasks of a service to logrus, with the service, task
+// and node as fields. Lines written to stdout are logged at info level, stderr at error level.
+// It returns when the logs end, or with LogsFollow when the context is cancelled.
+func StreamServiceLogs(ctx context.Context, cli DockerClient, serviceName string, opts ...LogOption) error {
+	options := logOptions{tail: "all", logger: log}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	service, _, err := cli.ServiceInspectWithRaw(ctx, serviceName, types.ServiceInspectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to inspect service %s: %w", serviceName, err)
+	}
+
+	reader, err := cli.ServiceLogs(ctx, service.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     options.follow,
+		Since:      options.since,
+		Tail:       options.tail,
+		Details:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get logs of service %s: %w", serviceName, err)
+	}
+	defer reader.Close()
+
+	logger := options.logger.WithField("service", service.Spec.Name)
+	stdout := &logLineWriter{logger: logger.WithField("stream", "stdout"), level: logrus.InfoLevel}
+	stderr := &logLineWriter{logger: logger.WithField("stream", "stderr"), level: logrus.ErrorLevel}
+
+	// With a TTY there is only one stream, which is not multiplexed
+	tty := service.Spec.TaskTemplate.ContainerSpec != nil && service.Spec.TaskTemplate.ContainerSpec.TTY
+	if tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+	stdout.Flush()
+	stderr.Flush()
+
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read logs of service %s: %w", serviceName, err)
+	}
+	return nil
+}
+
+// logLineWriter logs every complete line written to it, a partial line is kept until the rest arrives.
+type logLineWriter struct {
+	logger *logrus.Entry
+	level  logrus.Level
+	buffer []byte
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	for {
+		end := bytes.IndexByte(w.buffer, '\n')
+		if end < 0 {
+			break
+		}
+		w.logLine(string(w.buffer[:end]))
+		w.buffer = w.buffer[end+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs what is left of the last line.
+func (w *logLineWriter) Flush() {
+	if len(w.buffer) > 0 {
+		w.logLine(string(w.buffer))
+		w.buffer = nil
+	}
+}
+
+func (w *logLineWriter) logLine(line string) {
+	details, message := parseLogDetails(strings.TrimSuffix(line, "\r"))
+
+	fields := logrus.Fields{}
+	for key, field := range map[string]string{
+		swarmTaskIDLabel:    "task",
+		swarmNodeIDLabel:    "node",
+		swarmServiceIDLabel: "serviceId",
+	} {
+		if value, ok := details[key]; ok {
+			fields[field] = value
+		}
+	}
+
+	w.logger.WithFields(fields).Log(w.level, message)
+}
+
+// parseLogDetails splits the details Docker puts in front of a log line,
+// "com.docker.swarm.node.id=...,com.docker.swarm.service.id=...,com.docker.swarm.task.id=... message",
+// from the message.
+func parseLogDetails(line string) (map[string]string, string) {
+	prefix, message, ok := strings.Cut(line, " ")
+	if !ok || !strings.HasPrefix(prefix, "com.docker.swarm.") {
+		return nil, line
+	}
+
+	details := make(map[string]string)
+	for _, pair := range strings.Split(prefix, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		details[key] = value
+	}
+	return details, message
+}
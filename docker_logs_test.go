@@ -0,0 +1,47 @@
+package GoLib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogDetails(t *testing.T) {
+	details, message := parseLogDetails("com.docker.swarm.node.id=n1,com.docker.swarm.task.id=t1 hello world")
+	assert.Equal(t, map[string]string{swarmNodeIDLabel: "n1", swarmTaskIDLabel: "t1"}, details)
+	assert.Equal(t, "hello world", message)
+
+	details, message = parseLogDetails("hello world")
+	assert.Nil(t, details)
+	assert.Equal(t, "hello world", message)
+}
+
+func TestStreamServiceLogs(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service", Tag: "1.0"})
+	require.NoError(t, fake.AddServiceLog(id, false, "listening on :80"))
+	require.NoError(t, fake.AddServiceLog(id, true, "connection refused"))
+
+	logger, hook := test.NewNullLogger()
+	require.NoError(t, StreamServiceLogs(context.Background(), fake, id, LogsTo(logrus.NewEntry(logger))))
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "listening on :80", entries[0].Message)
+	assert.Equal(t, logrus.InfoLevel, entries[0].Level)
+	assert.Equal(t, "stdout", entries[0].Data["stream"])
+	assert.Equal(t, "query_service", entries[0].Data["service"])
+	assert.Equal(t, "fake", entries[0].Data["node"])
+	assert.NotEmpty(t, entries[0].Data["task"])
+
+	assert.Equal(t, "connection refused", entries[1].Message)
+	assert.Equal(t, logrus.ErrorLevel, entries[1].Level)
+	assert.Equal(t, "stderr", entries[1].Data["stream"])
+
+	assert.Error(t, StreamServiceLogs(context.Background(), fake, "missing"))
+}
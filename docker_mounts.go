@@ -0,0 +1,162 @@
+package GoLib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// ParseVolumeSpec parses the compose short syntax of a volume, "[source:]target[:options]".
+// A source starting with /, . or ~ is a bind mount, any other source a named volume and without
+// a source an anonymous volume. Options is a comma separated list of ro, rw and nocopy.
+func ParseVolumeSpec(spec string) (MountConfig, error) {
+	parts := strings.Split(spec, ":")
+
+	config := MountConfig{Type: string(mount.TypeVolume)}
+	options := ""
+	switch len(parts) {
+	case 1:
+		config.Target = parts[0]
+	case 2:
+		// "target:ro" is an anonymous volume with options, not a mount of volume "target"
+		if isVolumeOptions(parts[1]) && strings.HasPrefix(parts[0], "/") {
+			config.Target, options = parts[0], parts[1]
+		} else {
+			config.Source, config.Target = parts[0], parts[1]
+		}
+	case 3:
+		config.Source, config.Target, options = parts[0], parts[1], parts[2]
+	default:
+		return config, fmt.Errorf("invalid volume %q", spec)
+	}
+
+	if config.Target == "" {
+		return config, fmt.Errorf("invalid volume %q: target is required", spec)
+	}
+
+	if strings.HasPrefix(config.Source, "/") || strings.HasPrefix(config.Source, ".") || strings.HasPrefix(config.Source, "~") {
+		config.Type = string(mount.TypeBind)
+	}
+
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "", "rw":
+		case "ro":
+			config.ReadOnly = true
+		case "nocopy":
+			if config.Type != string(mount.TypeVolume) {
+				return config, fmt.Errorf("invalid volume %q: nocopy only applies to volumes", spec)
+			}
+			config.Volume = &VolumeOptions{NoCopy: true}
+		case "z", "Z", "shared", "rshared", "slave", "rslave", "private", "rprivate":
+			if config.Type != string(mount.TypeBind) {
+				return config, fmt.Errorf("invalid volume %q: %s only applies to bind mounts", spec, option)
+			}
+			if option != "z" && option != "Z" {
+				config.Bind = &BindOptions{Propagation: option}
+			}
+		default:
+			return config, fmt.Errorf("invalid volume %q: unknown option %s", spec, option)
+		}
+	}
+
+	return config, nil
+}
+
+func isVolumeOptions(options string) bool {
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "ro", "rw", "nocopy":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func convertMountConfig(config MountConfig) (mount.Mount, error) {
+	result := mount.Mount{
+		Type:     mount.Type(config.Type),
+		Source:   config.Source,
+		Target:   config.Target,
+		ReadOnly: config.ReadOnly,
+	}
+	if result.Type == "" {
+		result.Type = mount.TypeVolume
+	}
+
+	if config.Target == "" {
+		return result, fmt.Errorf("mount target is required")
+	}
+
+	switch result.Type {
+	case mount.TypeVolume:
+		if config.Bind != nil || config.Tmpfs != nil {
+			return result, fmt.Errorf("volume mount %s can only have volume options", config.Target)
+		}
+		if volume := config.Volume; volume != nil {
+			result.VolumeOptions = &mount.VolumeOptions{
+				NoCopy: volume.NoCopy,
+				Labels: volume.Labels,
+			}
+			if volume.Driver != "" || len(volume.DriverOpts) > 0 {
+				result.VolumeOptions.DriverConfig = &mount.Driver{Name: volume.Driver, Options: volume.DriverOpts}
+			}
+		}
+
+	case mount.TypeBind:
+		if config.Volume != nil || config.Tmpfs != nil {
+			return result, fmt.Errorf("bind mount %s can only have bind options", config.Target)
+		}
+		source, err := expandBindSource(config.Source)
+		if err != nil {
+			return result, err
+		}
+		result.Source = source
+		if config.Bind != nil && config.Bind.Propagation != "" {
+			result.BindOptions = &mount.BindOptions{Propagation: mount.Propagation(config.Bind.Propagation)}
+		}
+
+	case mount.TypeTmpfs:
+		if config.Source != "" {
+			return result, fmt.Errorf("tmpfs mount %s can not have a source", config.Target)
+		}
+		if config.Volume != nil || config.Bind != nil {
+			return result, fmt.Errorf("tmpfs mount %s can only have tmpfs options", config.Target)
+		}
+		if tmpfs := config.Tmpfs; tmpfs != nil {
+			result.TmpfsOptions = &mount.TmpfsOptions{Mode: os.FileMode(tmpfs.Mode)}
+			if tmpfs.Size != "" {
+				size, err := ParseMemory(tmpfs.Size)
+				if err != nil {
+					return result, fmt.Errorf("invalid tmpfs size: %w", err)
+				}
+				result.TmpfsOptions.SizeBytes = size
+			}
+		}
+
+	default:
+		return result, fmt.Errorf("unknown mount type %q", config.Type)
+	}
+
+	return result, nil
+}
+
+// expandBindSource makes relative and ~ paths absolute, Swarm only accepts absolute bind sources.
+func expandBindSource(source string) (string, error) {
+	if source == "" {
+		return "", fmt.Errorf("bind mount requires a source")
+	}
+
+	if source == "~" || strings.HasPrefix(source, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		source = filepath.Join(home, source[1:])
+	}
+	return filepath.Abs(source)
+}
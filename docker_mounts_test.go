@@ -0,0 +1,106 @@
+package GoLib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseVolumeSpec(t *testing.T) {
+	testCases := map[string]MountConfig{
+		"/data":                    {Type: "volume", Target: "/data"},
+		"/data:ro":                 {Type: "volume", Target: "/data", ReadOnly: true},
+		"logs:/var/log":            {Type: "volume", Source: "logs", Target: "/var/log"},
+		"logs:/var/log:ro":         {Type: "volume", Source: "logs", Target: "/var/log", ReadOnly: true},
+		"logs:/var/log:nocopy":     {Type: "volume", Source: "logs", Target: "/var/log", Volume: &VolumeOptions{NoCopy: true}},
+		"./config:/etc/app:ro":     {Type: "bind", Source: "./config", Target: "/etc/app", ReadOnly: true},
+		"/var/run:/var/run:rslave": {Type: "bind", Source: "/var/run", Target: "/var/run", Bind: &BindOptions{Propagation: "rslave"}},
+	}
+
+	for spec, expected := range testCases {
+		t.Run(spec, func(t *testing.T) {
+			config, err := ParseVolumeSpec(spec)
+			require.NoError(t, err)
+			assert.Equal(t, expected, config)
+		})
+	}
+
+	for _, spec := range []string{"", "logs:", "a:b:c:d", "logs:/var/log:rw,fast", "/src:/dst:nocopy"} {
+		_, err := ParseVolumeSpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestConvertMountConfig(t *testing.T) {
+	m, err := convertMountConfig(MountConfig{
+		Type:   "volume",
+		Source: "data",
+		Target: "/data",
+		Volume: &VolumeOptions{Driver: "local", DriverOpts: map[string]string{"type": "nfs"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, mount.TypeVolume, m.Type)
+	assert.Equal(t, "nfs", m.VolumeOptions.DriverConfig.Options["type"])
+
+	m, err = convertMountConfig(MountConfig{Type: "tmpfs", Target: "/cache", Tmpfs: &TmpfsOptions{Size: "64M", Mode: 0o1777}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(64<<20), m.TmpfsOptions.SizeBytes)
+	assert.Equal(t, os.FileMode(0o1777), m.TmpfsOptions.Mode)
+
+	m, err = convertMountConfig(MountConfig{Type: "bind", Source: "/etc/app", Target: "/config", ReadOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/app", m.Source)
+	assert.True(t, m.ReadOnly)
+
+	invalid := []MountConfig{
+		{Target: ""},
+		{Type: "tmpfs", Source: "data", Target: "/data"},
+		{Type: "bind", Target: "/data"},
+		{Type: "volume", Target: "/data", Tmpfs: &TmpfsOptions{}},
+		{Type: "npipe", Target: "/data"},
+	}
+	for _, config := range invalid {
+		_, err := convertMountConfig(config)
+		assert.Error(t, err, "%+v", config)
+	}
+}
+
+func TestUnmarshalStackFilePortsAndVolumes(t *testing.T) {
+	data := `
+services:
+  dns:
+    image: dns:1.0
+    ports:
+      - "8080:80"
+      - "53:53/udp"
+      - target: 443
+        published: 8443
+        mode: host
+    volumes:
+      - logs:/var/log
+      - ./zones:/etc/zones:ro
+      - type: tmpfs
+        target: /cache
+        tmpfs:
+          size: 64M
+`
+	stack := MicroServiceData{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &stack))
+
+	dns := stack.Services["dns"]
+	assert.Equal(t, map[string]string{"8080": "80"}, dns.Ports)
+	assert.Equal(t, []PortConfig{
+		{Target: 53, Published: 53, Protocol: "udp"},
+		{Target: 443, Published: 8443, Mode: "host"},
+	}, dns.PortConfigs)
+
+	assert.Equal(t, map[string]string{"logs": "/var/log"}, dns.Volumes)
+	assert.Equal(t, []MountConfig{
+		{Type: "bind", Source: "./zones", Target: "/etc/zones", ReadOnly: true},
+		{Type: "tmpfs", Target: "/cache", Tmpfs: &TmpfsOptions{Size: "64M"}},
+	}, dns.Mounts)
+}
@@ -0,0 +1,107 @@
+package GoLib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// ParsePortSpec parses the compose short syntax of a port, "[host_ip:][published:]target[/protocol]",
+// where published and target may be ranges like "8000-8010". A range expands into one PortConfig per port.
+// The host IP is accepted for compatibility but ignored, Swarm always publishes on all interfaces.
+func ParsePortSpec(spec string) ([]PortConfig, error) {
+	ports, protocol, _ := strings.Cut(spec, "/")
+
+	parts := strings.Split(ports, ":")
+	published, target := "", parts[len(parts)-1]
+	switch len(parts) {
+	case 1:
+	case 2:
+		published = parts[0]
+	case 3:
+		published = parts[1]
+	default:
+		return nil, fmt.Errorf("invalid port %q", spec)
+	}
+
+	targetStart, targetEnd, err := parsePortRange(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", spec, err)
+	}
+
+	var publishedStart, publishedEnd uint32
+	if published != "" {
+		publishedStart, publishedEnd, err = parsePortRange(published)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", spec, err)
+		}
+		if publishedEnd-publishedStart != targetEnd-targetStart {
+			return nil, fmt.Errorf("invalid port %q: published and target ranges differ in size", spec)
+		}
+	}
+
+	configs := []PortConfig{}
+	for offset := uint32(0); targetStart+offset <= targetEnd; offset++ {
+		config := PortConfig{Target: targetStart + offset, Protocol: protocol}
+		if published != "" {
+			config.Published = publishedStart + offset
+		}
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+func parsePortRange(ports string) (uint32, uint32, error) {
+	startPort, endPort, isRange := strings.Cut(ports, "-")
+
+	start, err := strconv.ParseUint(startPort, 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		return uint32(start), uint32(start), nil
+	}
+
+	end, err := strconv.ParseUint(endPort, 10, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("range %s ends before it starts", ports)
+	}
+	return uint32(start), uint32(end), nil
+}
+
+func convertPortConfig(port PortConfig) (swarm.PortConfig, error) {
+	result := swarm.PortConfig{
+		TargetPort:    port.Target,
+		PublishedPort: port.Published,
+		Protocol:      swarm.PortConfigProtocolTCP,
+		PublishMode:   swarm.PortConfigPublishModeIngress,
+	}
+
+	if port.Target == 0 {
+		return result, fmt.Errorf("port target is required")
+	}
+
+	switch protocol := swarm.PortConfigProtocol(strings.ToLower(port.Protocol)); protocol {
+	case "":
+	case swarm.PortConfigProtocolTCP, swarm.PortConfigProtocolUDP, swarm.PortConfigProtocolSCTP:
+		result.Protocol = protocol
+	default:
+		return result, fmt.Errorf("unknown port protocol %q", port.Protocol)
+	}
+
+	switch mode := swarm.PortConfigPublishMode(port.Mode); mode {
+	case "":
+	case swarm.PortConfigPublishModeIngress, swarm.PortConfigPublishModeHost:
+		result.PublishMode = mode
+	default:
+		return result, fmt.Errorf("unknown port mode %q", port.Mode)
+	}
+
+	return result, nil
+}
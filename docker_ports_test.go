@@ -0,0 +1,55 @@
+package GoLib
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	testCases := map[string][]PortConfig{
+		"80":                  {{Target: 80}},
+		"8080:80":             {{Target: 80, Published: 8080}},
+		"53:53/udp":           {{Target: 53, Published: 53, Protocol: "udp"}},
+		"127.0.0.1:8080:80":   {{Target: 80, Published: 8080}},
+		"9000-9001:8000-8001": {{Target: 8000, Published: 9000}, {Target: 8001, Published: 9001}},
+		"7000-7001/sctp":      {{Target: 7000, Protocol: "sctp"}, {Target: 7001, Protocol: "sctp"}},
+	}
+
+	for spec, expected := range testCases {
+		t.Run(spec, func(t *testing.T) {
+			configs, err := ParsePortSpec(spec)
+			require.NoError(t, err)
+			assert.Equal(t, expected, configs)
+		})
+	}
+
+	for _, spec := range []string{"", "http", "8080:80:90:100", "9000-9002:8000-8001", "8001-8000", "70000"} {
+		_, err := ParsePortSpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCreateServiceSpecFromPayloadPorts(t *testing.T) {
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName: "dns",
+		PortConfigs: []PortConfig{
+			{Target: 53, Published: 53, Protocol: "udp", Mode: "host"},
+			{Target: 8080},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []swarm.PortConfig{
+		{TargetPort: 53, PublishedPort: 53, Protocol: swarm.PortConfigProtocolUDP, PublishMode: swarm.PortConfigPublishModeHost},
+		{TargetPort: 8080, Protocol: swarm.PortConfigProtocolTCP, PublishMode: swarm.PortConfigPublishModeIngress},
+	}, spec.EndpointSpec.Ports)
+
+	_, err = CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName:   "dns",
+		PortConfigs: []PortConfig{{Target: 53, Protocol: "icmp"}},
+	}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,297 @@
+package GoLib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SecretNameLabel holds the name of the secret a rotated copy was created from.
+	SecretNameLabel = "com.golib.secret.name"
+	// SecretVersionLabel holds the version of a rotated copy, the original secret is version 0.
+	SecretVersionLabel = "com.golib.secret.version"
+)
+
+// CreateSecret creates a Swarm secret and returns its ID.
+func CreateSecret(cli DockerClient, name string, data []byte, labels map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	response, err := cli.SecretCreate(ctx, swarm.SecretSpec{
+		Annotations: swarm.Annotations{Name: name, Labels: labels},
+		Data:        data,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create secret %s: %w", name, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"secret": name,
+		"id":     response.ID,
+	}).Info("Secret created")
+	return response.ID, nil
+}
+
+// CreateSecretFromFile creates a Swarm secret with the content of a file.
+func CreateSecretFromFile(cli DockerClient, name string, fileName string, labels map[string]string) (string, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", fileName, err)
+	}
+	return CreateSecret(cli, name, data, labels)
+}
+
+// CreateConfig creates a Swarm config and returns its ID.
+func CreateConfig(cli DockerClient, name string, data []byte, labels map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	response, err := cli.ConfigCreate(ctx, swarm.ConfigSpec{
+		Annotations: swarm.Annotations{Name: name, Labels: labels},
+		Data:        data,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create config %s: %w", name, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"config": name,
+		"id":     response.ID,
+	}).Info("Config created")
+	return response.ID, nil
+}
+
+// CreateConfigFromFile creates a Swarm config with the content of a file.
+func CreateConfigFromFile(cli DockerClient, name string, fileName string, labels map[string]string) (string, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config file %s: %w", fileName, err)
+	}
+	return CreateConfig(cli, name, data, labels)
+}
+
+func GetConfigIDByName(cli DockerClient, configName string) (string, error) {
+	configs, err := cli.ConfigList(context.Background(), types.ConfigListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", configName)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The name filter matches on prefix
+	for _, config := range configs {
+		if config.Spec.Name == configName {
+			return config.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("config not found: %s", configName)
+}
+
+// RotateSecret creates a new version of a secret, named "<name>_v<version>", and updates every
+// service using any version of the secret to use the new one. The file the secret is mounted as
+// stays the same, so services only see new content. Old versions are not removed, as tasks that
+// are still being replaced might use them. It returns the name of the new secret.
+func RotateSecret(cli DockerClient, name string, data []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	versions, err := secretVersions(ctx, cli, name)
+	if err != nil {
+		return "", err
+	}
+
+	latest := 0
+	for _, version := range versions {
+		if version > latest {
+			latest = version
+		}
+	}
+
+	newName := fmt.Sprintf("%s_v%d", name, latest+1)
+	newID, err := CreateSecret(cli, newName, data, map[string]string{
+		SecretNameLabel:    name,
+		SecretVersionLabel: strconv.Itoa(latest + 1),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	services, err := cli.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return newName, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	for _, service := range services {
+		if !usesSecret(service, versions) {
+			continue
+		}
+
+		_, err := updateService(cli, service.ID, types.ServiceUpdateOptions{}, func(service swarm.Service) (swarm.ServiceSpec, error) {
+			spec := service.Spec
+			for _, ref := range spec.TaskTemplate.ContainerSpec.Secrets {
+				if _, ok := versions[ref.SecretID]; ok {
+					ref.SecretID = newID
+					ref.SecretName = newName
+				}
+			}
+			return spec, nil
+		})
+		if err != nil {
+			return newName, fmt.Errorf("failed to rotate secret %s of service %s: %w", name, service.Spec.Name, err)
+		}
+	}
+
+	return newName, nil
+}
+
+// secretVersions returns the IDs of all versions of a secret, mapped to their version.
+func secretVersions(ctx context.Context, cli DockerClient, name string) (map[string]int, error) {
+	versions := make(map[string]int)
+
+	rotated, err := cli.SecretList(ctx, types.SecretListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", SecretNameLabel+"="+name)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions of secret %s: %w", name, err)
+	}
+	for _, secret := range rotated {
+		version, err := strconv.Atoi(secret.Spec.Labels[SecretVersionLabel])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s has an invalid version label: %w", secret.Spec.Name, err)
+		}
+		versions[secret.ID] = version
+	}
+
+	originalID, err := GetSecretIDByName(cli, name)
+	if err == nil {
+		versions[originalID] = 0
+	} else if len(versions) == 0 {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// latestSecretVersion returns the ID and name of the newest version of a secret, so services
+// created after a rotation get the rotated secret as well.
+func latestSecretVersion(ctx context.Context, cli DockerClient, name string) (string, string, error) {
+	rotated, err := cli.SecretList(ctx, types.SecretListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", SecretNameLabel+"="+name)),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	latest := swarm.Secret{}
+	latestVersion := 0
+	for _, secret := range rotated {
+		if version, err := strconv.Atoi(secret.Spec.Labels[SecretVersionLabel]); err == nil && version > latestVersion {
+			latest, latestVersion = secret, version
+		}
+	}
+	if latestVersion > 0 {
+		return latest.ID, latest.Spec.Name, nil
+	}
+
+	id, err := GetSecretIDByName(cli, name)
+	return id, name, err
+}
+
+func usesSecret(service swarm.Service, versions map[string]int) bool {
+	if service.Spec.TaskTemplate.ContainerSpec == nil {
+		return false
+	}
+	for _, ref := range service.Spec.TaskTemplate.ContainerSpec.Secrets {
+		if _, ok := versions[ref.SecretID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// secretReferences resolves the secrets of a payload, plain names and long syntax, to references.
+func secretReferences(cli DockerClient, payload CreateServicePayload) ([]*swarm.SecretReference, error) {
+	refs := make([]FileReference, 0, len(payload.Secrets)+len(payload.SecretRefs))
+	for _, secret := range payload.Secrets {
+		refs = append(refs, FileReference{Source: secret})
+	}
+	refs = append(refs, payload.SecretRefs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	secretRefs := []*swarm.SecretReference{}
+	for _, ref := range refs {
+		id, name, err := latestSecretVersion(ctx, cli, ref.Source)
+		if err != nil {
+			return nil, fmt.Errorf("secret does not exist, %w", err)
+		}
+
+		target, uid, gid, mode := fileTarget(ref)
+		secretRefs = append(secretRefs, &swarm.SecretReference{
+			SecretName: name,
+			SecretID:   id,
+			File: &swarm.SecretReferenceFileTarget{
+				Name: target,
+				UID:  uid,
+				GID:  gid,
+				Mode: mode,
+			},
+		})
+	}
+
+	return secretRefs, nil
+}
+
+func configReferences(cli DockerClient, configs []FileReference) ([]*swarm.ConfigReference, error) {
+	configRefs := []*swarm.ConfigReference{}
+	for _, ref := range configs {
+		id, err := GetConfigIDByName(cli, ref.Source)
+		if err != nil {
+			return nil, fmt.Errorf("config does not exist, %w", err)
+		}
+
+		target, uid, gid, mode := fileTarget(ref)
+		if target == ref.Source {
+			target = "/" + target
+		}
+		configRefs = append(configRefs, &swarm.ConfigReference{
+			ConfigName: ref.Source,
+			ConfigID:   id,
+			File: &swarm.ConfigReferenceFileTarget{
+				Name: target,
+				UID:  uid,
+				GID:  gid,
+				Mode: mode,
+			},
+		})
+	}
+
+	return configRefs, nil
+}
+
+func fileTarget(ref FileReference) (string, string, string, os.FileMode) {
+	target, uid, gid, mode := ref.Target, ref.UID, ref.GID, os.FileMode(0444)
+	if target == "" {
+		target = ref.Source
+	}
+	if uid == "" {
+		uid = "0"
+	}
+	if gid == "" {
+		gid = "0"
+	}
+	if ref.Mode != nil {
+		mode = os.FileMode(*ref.Mode)
+	}
+	return target, uid, gid, mode
+}
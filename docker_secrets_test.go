@@ -0,0 +1,100 @@
+package GoLib
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSecretIDByName(t *testing.T) {
+	fake := NewFakeSwarm()
+
+	id, err := CreateSecret(fake, "db_password_old", []byte("old"), nil)
+	require.NoError(t, err)
+	_, err = GetSecretIDByName(fake, "db_password")
+	assert.Error(t, err, "the name filter matches on prefix, the lookup must not")
+
+	found, err := GetSecretIDByName(fake, "db_password_old")
+	require.NoError(t, err)
+	assert.Equal(t, id, found)
+}
+
+func TestCreateServiceSpecFromPayloadSecretsAndConfigs(t *testing.T) {
+	fake := NewFakeSwarm()
+
+	_, err := CreateSecret(fake, "db_password", []byte("secret"), nil)
+	require.NoError(t, err)
+	configFile := t.TempDir() + "/nginx.conf"
+	require.NoError(t, os.WriteFile(configFile, []byte("server {}"), 0644))
+	_, err = CreateConfigFromFile(fake, "nginx_conf", configFile, nil)
+	require.NoError(t, err)
+
+	mode := uint32(0400)
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName:  "nginx",
+		Secrets:    []string{"db_password"},
+		SecretRefs: []FileReference{{Source: "db_password", Target: "password", UID: "101", GID: "101", Mode: &mode}},
+		Configs:    []FileReference{{Source: "nginx_conf", Target: "/etc/nginx/nginx.conf"}},
+	}, fake)
+	require.NoError(t, err)
+
+	secrets := spec.TaskTemplate.ContainerSpec.Secrets
+	require.Len(t, secrets, 2)
+	assert.Equal(t, "db_password", secrets[0].File.Name)
+	assert.Equal(t, "0", secrets[0].File.UID)
+	assert.Equal(t, os.FileMode(0444), secrets[0].File.Mode)
+	assert.Equal(t, "password", secrets[1].File.Name)
+	assert.Equal(t, "101", secrets[1].File.UID)
+	assert.Equal(t, os.FileMode(0400), secrets[1].File.Mode)
+
+	configs := spec.TaskTemplate.ContainerSpec.Configs
+	require.Len(t, configs, 1)
+	assert.Equal(t, "nginx_conf", configs[0].ConfigName)
+	assert.Equal(t, "/etc/nginx/nginx.conf", configs[0].File.Name)
+
+	_, err = CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName: "nginx",
+		Configs:   []FileReference{{Source: "missing"}},
+	}, fake)
+	assert.Error(t, err)
+}
+
+func TestRotateSecret(t *testing.T) {
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	oldID, err := CreateSecret(fake, "db_password", []byte("old"), nil)
+	require.NoError(t, err)
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service", Secrets: []string{"db_password"}})
+	otherID := createFakeService(t, fake, CreateServicePayload{ImageName: "other_service"})
+
+	newName, err := RotateSecret(fake, "db_password", []byte("new"))
+	require.NoError(t, err)
+	assert.Equal(t, "db_password_v1", newName)
+
+	service, _, err := fake.ServiceInspectWithRaw(ctx, id, types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	ref := service.Spec.TaskTemplate.ContainerSpec.Secrets[0]
+	assert.Equal(t, "db_password_v1", ref.SecretName)
+	assert.Equal(t, "db_password", ref.File.Name, "the file name must not change")
+
+	other, _, err := fake.ServiceInspectWithRaw(ctx, otherID, types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), other.Version.Index, "services without the secret are not updated")
+
+	// The old version is no longer used and can be removed
+	require.NoError(t, fake.SecretRemove(ctx, oldID))
+
+	newName, err = RotateSecret(fake, "db_password", []byte("newer"))
+	require.NoError(t, err)
+	assert.Equal(t, "db_password_v2", newName)
+
+	// New services get the latest version
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{ImageName: "new_service", Secrets: []string{"db_password"}}, fake)
+	require.NoError(t, err)
+	assert.Equal(t, "db_password_v2", spec.TaskTemplate.ContainerSpec.Secrets[0].SecretName)
+}
@@ -0,0 +1,207 @@
+package GoLib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/sirupsen/logrus"
+)
+
+// maxUpdateAttempts is how often an update is retried when Swarm reports the service
+// was changed between reading its version and writing the update.
+const maxUpdateAttempts = 5
+
+// ErrServiceModeChanged is returned when an update would change a service between replicated and
+// global mode. Swarm does not allow that, the service has to be removed and created again.
+var ErrServiceModeChanged = errors.New("service mode can not be changed")
+
+// UpdateDockerService updates an existing service (by name or ID) to match payload.
+// Only the parts of the spec that CreateServicePayload describes are replaced, other settings,
+// like labels added by hand, are kept. A payload without replicas keeps the current scale. A
+// payload with another deploy mode than the service returns ErrServiceModeChanged.
+func UpdateDockerService(cli DockerClient, serviceName string, payload CreateServicePayload) (types.ServiceUpdateResponse, error) {
+	return updateServiceFromPayload(cli, serviceName, payload, nil)
+}
+
+// updateServiceFromPayload is UpdateDockerService, additionally setting the given service labels.
+func updateServiceFromPayload(cli DockerClient, serviceName string, payload CreateServicePayload, labels map[string]string) (types.ServiceUpdateResponse, error) {
+	desired, err := CreateServiceSpecFromPayload(payload, cli)
+	if err != nil {
+		return types.ServiceUpdateResponse{}, err
+	}
+	for k, v := range labels {
+		desired.Labels[k] = v
+	}
+
+	return updateServiceToSpec(cli, serviceName, desired, payload.Deploy.Replicas == nil)
+}
+
+// updateServiceToSpec applies desired to an existing service, see applyServiceDiff.
+// Labels of desired are added to the labels the service already has.
+func updateServiceToSpec(cli DockerClient, serviceName string, desired swarm.ServiceSpec, keepReplicas bool) (types.ServiceUpdateResponse, error) {
+	return updateService(cli, serviceName, types.ServiceUpdateOptions{}, func(service swarm.Service) (swarm.ServiceSpec, error) {
+		spec := service.Spec
+		if current, wanted := serviceModeName(spec.Mode), serviceModeName(desired.Mode); current != wanted {
+			return spec, fmt.Errorf("%w: service %s is %s, not %s", ErrServiceModeChanged, serviceName, current, wanted)
+		}
+		applyServiceDiff(&spec, desired, keepReplicas)
+
+		if len(desired.Labels) > 0 && spec.Labels == nil {
+			spec.Labels = make(map[string]string)
+		}
+		for k, v := range desired.Labels {
+			spec.Labels[k] = v
+		}
+		return spec, nil
+	})
+}
+
+// ScaleService sets the number of replicas of a replicated service.
+func ScaleService(cli DockerClient, serviceName string, replicas uint64) error {
+	_, err := updateService(cli, serviceName, types.ServiceUpdateOptions{}, func(service swarm.Service) (swarm.ServiceSpec, error) {
+		spec := service.Spec
+		if spec.Mode.Replicated == nil {
+			return spec, fmt.Errorf("service %s is not in replicated mode and can not be scaled", serviceName)
+		}
+		spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+		return spec, nil
+	})
+	return err
+}
+
+// RollbackService reverts a service to the spec it had before its last update.
+func RollbackService(cli DockerClient, serviceName string) error {
+	_, err := updateService(cli, serviceName, types.ServiceUpdateOptions{Rollback: "previous"}, func(service swarm.Service) (swarm.ServiceSpec, error) {
+		if service.PreviousSpec == nil {
+			return service.Spec, fmt.Errorf("service %s has no previous spec to roll back to", serviceName)
+		}
+		return service.Spec, nil
+	})
+	return err
+}
+
+func RemoveService(cli DockerClient, serviceName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := cli.ServiceRemove(ctx, serviceName); err != nil {
+		return fmt.Errorf("failed to remove service %s: %w", serviceName, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"service": serviceName,
+	}).Info("Service removed")
+	return nil
+}
+
+// updateService reads the current version of the service, lets mutate derive the new spec and
+// writes it, starting over when Swarm rejects the update as out of sequence.
+func updateService(
+	cli DockerClient,
+	serviceName string,
+	options types.ServiceUpdateOptions,
+	mutate func(swarm.Service) (swarm.ServiceSpec, error),
+) (types.ServiceUpdateResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var err error
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		var service swarm.Service
+		service, _, err = cli.ServiceInspectWithRaw(ctx, serviceName, types.ServiceInspectOptions{})
+		if err != nil {
+			return types.ServiceUpdateResponse{}, fmt.Errorf("failed to inspect service %s: %w", serviceName, err)
+		}
+
+		spec, mutateErr := mutate(service)
+		if mutateErr != nil {
+			return types.ServiceUpdateResponse{}, mutateErr
+		}
+
+		var response types.ServiceUpdateResponse
+		response, err = cli.ServiceUpdate(ctx, service.ID, service.Version, spec, options)
+		if err == nil {
+			for _, warning := range response.Warnings {
+				log.Warnf("Updating service %s: %s", serviceName, warning)
+			}
+			log.WithFields(logrus.Fields{
+				"service": serviceName,
+				"version": service.Version.Index,
+			}).Info("Service updated")
+			return response, nil
+		}
+
+		if !isOutOfSequence(err) {
+			break
+		}
+		log.Warnf("Update of service %s out of sequence, retrying (%d/%d)", serviceName, attempt, maxUpdateAttempts)
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+
+	return types.ServiceUpdateResponse{}, fmt.Errorf("failed to update service %s: %w", serviceName, err)
+}
+
+func isOutOfSequence(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "update out of sequence")
+}
+
+// copySpec returns a deep copy of a spec, as Swarm would store it.
+func copySpec(spec swarm.ServiceSpec) swarm.ServiceSpec {
+	copied := swarm.ServiceSpec{}
+	data, _ := json.Marshal(spec)
+	_ = json.Unmarshal(data, &copied)
+	return copied
+}
+
+// applyServiceDiff copies the fields generated from a CreateServicePayload from desired into spec.
+func applyServiceDiff(spec *swarm.ServiceSpec, desired swarm.ServiceSpec, keepReplicas bool) {
+	if spec.TaskTemplate.ContainerSpec == nil {
+		spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{}
+	}
+	containerSpec := spec.TaskTemplate.ContainerSpec
+	desiredContainer := desired.TaskTemplate.ContainerSpec
+
+	containerSpec.Image = desiredContainer.Image
+	containerSpec.Env = desiredContainer.Env
+	containerSpec.Secrets = desiredContainer.Secrets
+	containerSpec.Configs = desiredContainer.Configs
+	containerSpec.Mounts = desiredContainer.Mounts
+	containerSpec.Labels = desiredContainer.Labels
+	containerSpec.Command = desiredContainer.Command
+	containerSpec.Args = desiredContainer.Args
+	containerSpec.User = desiredContainer.User
+	containerSpec.Dir = desiredContainer.Dir
+	containerSpec.Hostname = desiredContainer.Hostname
+	containerSpec.Healthcheck = desiredContainer.Healthcheck
+
+	spec.TaskTemplate.Networks = desired.TaskTemplate.Networks
+	spec.TaskTemplate.Placement = desired.TaskTemplate.Placement
+	spec.TaskTemplate.Resources = desired.TaskTemplate.Resources
+	spec.TaskTemplate.RestartPolicy = desired.TaskTemplate.RestartPolicy
+	spec.UpdateConfig = desired.UpdateConfig
+	spec.RollbackConfig = desired.RollbackConfig
+	spec.EndpointSpec = desired.EndpointSpec
+
+	if !keepReplicas || spec.Mode.Replicated == nil {
+		spec.Mode = desired.Mode
+	}
+}
+
+func serviceModeName(mode swarm.ServiceMode) string {
+	switch {
+	case mode.Global != nil:
+		return "global"
+	case mode.ReplicatedJob != nil:
+		return "replicated-job"
+	case mode.GlobalJob != nil:
+		return "global-job"
+	default:
+		return "replicated"
+	}
+}
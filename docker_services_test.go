@@ -0,0 +1,115 @@
+package GoLib
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyServiceDiff(t *testing.T) {
+	replicas := uint64(4)
+	current := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: "query", Labels: map[string]string{"owner": "team"}},
+		Mode:        swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{Image: "query_service:1.0", Env: []string{"A=1"}, StopSignal: "SIGINT"},
+		},
+	}
+
+	desired, err := CreateServiceSpecFromPayload(CreateServicePayload{
+		ImageName: "query_service",
+		Tag:       "1.1",
+		EnvVars:   map[string]string{"A": "2"},
+	}, nil)
+	require.NoError(t, err)
+
+	applyServiceDiff(&current, desired, true)
+	assert.Equal(t, "query", current.Name)
+	assert.Equal(t, map[string]string{"owner": "team"}, current.Labels)
+	assert.Equal(t, "SIGINT", current.TaskTemplate.ContainerSpec.StopSignal)
+	assert.Equal(t, "docker.io/library/query_service:1.1", current.TaskTemplate.ContainerSpec.Image)
+	assert.Equal(t, []string{"A=2"}, current.TaskTemplate.ContainerSpec.Env)
+	assert.Equal(t, uint64(4), *current.Mode.Replicated.Replicas)
+
+	applyServiceDiff(&current, desired, false)
+	assert.Equal(t, uint64(1), *current.Mode.Replicated.Replicas)
+}
+
+func TestIsOutOfSequence(t *testing.T) {
+	assert.True(t, isOutOfSequence(errors.New("Error response from daemon: rpc error: code = Unknown desc = update out of sequence")))
+	assert.False(t, isOutOfSequence(errors.New("service not found")))
+	assert.False(t, isOutOfSequence(nil))
+}
+
+func createFakeService(t *testing.T, fake *FakeSwarm, payload CreateServicePayload) string {
+	spec, err := CreateServiceSpecFromPayload(payload, fake)
+	require.NoError(t, err)
+	spec.Labels["owner"] = "team"
+
+	response, err := CreateDockerService(fake, spec)
+	require.NoError(t, err)
+	return response.ID
+}
+
+func TestUpdateDockerService(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{
+		ImageName: "query_service",
+		Tag:       "1.0",
+		Deploy:    Deploy{Replicas: NewReplicas(3)},
+	})
+
+	_, err := UpdateDockerService(fake, "query_service", CreateServicePayload{
+		ImageName: "query_service",
+		Tag:       "1.1",
+		EnvVars:   map[string]string{"LOG_LEVEL": "debug"},
+	})
+	require.NoError(t, err)
+
+	service, _, err := fake.ServiceInspectWithRaw(context.Background(), id, types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io/library/query_service:1.1", service.Spec.TaskTemplate.ContainerSpec.Image)
+	assert.Equal(t, []string{"LOG_LEVEL=debug"}, service.Spec.TaskTemplate.ContainerSpec.Env)
+	assert.Equal(t, uint64(3), *service.Spec.Mode.Replicated.Replicas)
+	assert.Equal(t, "team", service.Spec.Labels["owner"])
+	assert.Equal(t, uint64(2), service.Version.Index)
+}
+
+func TestScaleAndRollbackService(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service"})
+
+	err := RollbackService(fake, id)
+	assert.Error(t, err, "a new service has nothing to roll back to")
+
+	require.NoError(t, ScaleService(fake, id, 4))
+	service, _, err := fake.ServiceInspectWithRaw(context.Background(), id, types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), *service.Spec.Mode.Replicated.Replicas)
+
+	require.NoError(t, RollbackService(fake, id))
+	service, _, err = fake.ServiceInspectWithRaw(context.Background(), id, types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), *service.Spec.Mode.Replicated.Replicas)
+
+	require.NoError(t, RemoveService(fake, id))
+	_, _, err = fake.ServiceInspectWithRaw(context.Background(), id, types.ServiceInspectOptions{})
+	assert.Error(t, err)
+}
+
+func TestCreateDockerServiceError(t *testing.T) {
+	fake := NewFakeSwarm()
+	spec, err := CreateServiceSpecFromPayload(CreateServicePayload{ImageName: "nginx", Tag: "1.23"}, fake)
+	require.NoError(t, err)
+	spec.Name = "web"
+
+	_, err = CreateDockerService(fake, spec)
+	require.NoError(t, err)
+	_, err = CreateDockerService(fake, spec)
+	assert.Error(t, err)
+}
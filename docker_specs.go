@@ -3,32 +3,69 @@ package GoLib
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// ManagedByLabel is set on every service created from a CreateServicePayload, to find them back later.
+	ManagedByLabel = "com.golib.managed-by"
+	ManagedByValue = "golib"
+)
+
+// ErrNotSwarmManager is returned by NewDockerClient when the Docker daemon is not a swarm manager.
+var ErrNotSwarmManager = errors.New("this node is not a swarm manager")
+
 func GetDockerClient() *client.Client {
-	// Create a new Docker client
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := NewDockerClient()
 	if err != nil {
 		log.Fatalf("Error creating Docker client: %v", err)
 	}
+	return cli
+}
+
+// NewDockerClient connects to the Docker daemon configured in the environment and checks it is a
+// swarm manager. Unlike GetDockerClient it returns an error instead of exiting.
+func NewDockerClient() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSwarmManager(cli); err != nil {
+		cli.Close()
+		return nil, err
+	}
+	return cli, nil
+}
 
-	// Check if Swarm is active
+func checkSwarmManager(cli DockerClient) error {
 	info, err := cli.Info(context.Background())
 	if err != nil {
-		log.Fatalf("Error getting Docker info: %v", err)
+		return fmt.Errorf("failed to get Docker info: %w", err)
 	}
 	if !info.Swarm.ControlAvailable {
-		log.Fatal("This node is not a swarm manager. The agent can only be run on a swarm manager.")
+		return ErrNotSwarmManager
+	}
+	return nil
+}
+
+type ServiceSpecOption func(*CreateServicePayload)
+
+// WithDeploy sets the replicas, placement, resources, restart policy and update config of the service.
+func WithDeploy(deploy Deploy) ServiceSpecOption {
+	return func(payload *CreateServicePayload) {
+		payload.Deploy = deploy
 	}
-	return cli
 }
 
 func CreateServiceSpec(
@@ -39,64 +76,100 @@ func CreateServiceSpec(
 	secrets []string,
 	volumes map[string]string,
 	ports map[string]string,
-	cli *client.Client,
+	cli DockerClient,
+	opts ...ServiceSpecOption,
 ) swarm.ServiceSpec {
 
-	if tag == "" {
-		tag = "latest"
+	payload := CreateServicePayload{
+		ImageName: imageName,
+		Tag:       tag,
+		EnvVars:   envVars,
+		Networks:  networks,
+		Secrets:   secrets,
+		Volumes:   volumes,
+		Ports:     ports,
+	}
+
+	for _, opt := range opts {
+		opt(&payload)
+	}
+
+	spec, err := CreateServiceSpecFromPayload(payload, cli)
+	if err != nil {
+		log.Fatalf("Failed creating service spec: %v", err)
+	}
+	return spec
+}
+
+// CreateServiceSpecFromPayload builds a swarm.ServiceSpec from a CreateServicePayload.
+// Unlike CreateServiceSpec it returns an error instead of exiting on invalid input.
+func CreateServiceSpecFromPayload(payload CreateServicePayload, cli DockerClient) (swarm.ServiceSpec, error) {
+	image, err := ParseImageReference(payload.ImageName)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
 	}
+	if payload.Tag != "" {
+		image.Tag = payload.Tag
+	}
+	if payload.Digest != "" {
+		image.Digest = payload.Digest
+	}
+	// Like docker service create, the image is stored fully qualified
+	image = image.Normalize()
 
+	// Maps are walked in random order, so the lists built from them are sorted to give the same
+	// spec every time. Otherwise every reconcile would see a changed service.
 	env := []string{}
-	for k, v := range envVars {
+	for k, v := range payload.EnvVars {
 		env = append(env, k+"="+v)
 	}
+	sort.Strings(env)
 
 	networkConfigs := []swarm.NetworkAttachmentConfig{}
-	alias := LastPartAfterSlash(imageName)
-	for _, network := range networks {
+	alias := image.Alias()
+	for _, network := range payload.Networks {
 		networkConfigs = append(networkConfigs, swarm.NetworkAttachmentConfig{
 			Target:  network,
-			Aliases: []string{alias},
+			Aliases: append([]string{alias}, payload.NetworkAliases[network]...),
 		})
 	}
 
-	secretRefs := []*swarm.SecretReference{}
-	for _, secret := range secrets {
-		id, err := GetSecretIDByName(cli, secret)
-		if err != nil {
-			log.Fatalf("Secret does not exist, %s", err)
-		}
+	secretRefs, err := secretReferences(cli, payload)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
 
-		secretRefs = append(secretRefs, &swarm.SecretReference{
-			SecretName: secret,
-			SecretID:   id,
-			File: &swarm.SecretReferenceFileTarget{
-				Name: fmt.Sprintf("/run/secrets/%s", secret), // This should be just the filename, not the full path
-				UID:  "0",
-				GID:  "0",
-				Mode: 0444,
-			},
-		})
+	configRefs, err := configReferences(cli, payload.Configs)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
 	}
 
 	mounts := []mount.Mount{}
-	for src, target := range volumes {
+	for src, target := range payload.Volumes {
 		mounts = append(mounts, mount.Mount{
 			Type:   mount.TypeVolume,
 			Source: src,
 			Target: target,
 		})
 	}
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Target < mounts[j].Target })
+	for _, config := range payload.Mounts {
+		m, err := convertMountConfig(config)
+		if err != nil {
+			return swarm.ServiceSpec{}, fmt.Errorf("invalid mount: %w", err)
+		}
+		mounts = append(mounts, m)
+	}
 
 	portConfigs := []swarm.PortConfig{}
-	for published, target := range ports {
+	for published, target := range payload.Ports {
 		publishedPort, err := strconv.ParseUint(published, 10, 16)
 		if err != nil {
-			log.Fatalf("Invalid published port %s: %v", published, err)
+			return swarm.ServiceSpec{}, fmt.Errorf("invalid published port %s: %w", published, err)
 		}
 		targetPort, err := strconv.ParseUint(target, 10, 16)
 		if err != nil {
-			log.Fatalf("Invalid target port %s: %v", target, err)
+			return swarm.ServiceSpec{}, fmt.Errorf("invalid target port %s: %w", target, err)
 		}
 
 		portConfigs = append(portConfigs, swarm.PortConfig{
@@ -105,16 +178,25 @@ func CreateServiceSpec(
 			TargetPort:    uint32(targetPort),
 		})
 	}
+	sort.Slice(portConfigs, func(i, j int) bool { return portConfigs[i].PublishedPort < portConfigs[j].PublishedPort })
+	for _, config := range payload.PortConfigs {
+		port, err := convertPortConfig(config)
+		if err != nil {
+			return swarm.ServiceSpec{}, fmt.Errorf("invalid port: %w", err)
+		}
+		portConfigs = append(portConfigs, port)
+	}
 
-	return swarm.ServiceSpec{
+	spec := swarm.ServiceSpec{
 		Annotations: swarm.Annotations{
-			Name: imageName,
+			Name: alias,
 		},
 		TaskTemplate: swarm.TaskSpec{
 			ContainerSpec: &swarm.ContainerSpec{
-				Image:   imageName + ":" + tag,
+				Image:   image.String(),
 				Env:     env,
 				Secrets: secretRefs,
+				Configs: configRefs,
 				Mounts:  mounts,
 			},
 			Networks: networkConfigs,
@@ -124,14 +206,31 @@ func CreateServiceSpec(
 			Ports: portConfigs,
 		},
 	}
+
+	spec.Labels = map[string]string{}
+	for k, v := range payload.Deploy.Labels {
+		spec.Labels[k] = v
+	}
+	spec.Labels[ManagedByLabel] = ManagedByValue
+
+	if err := applyContainerOptions(spec.TaskTemplate.ContainerSpec, payload.ContainerOptions); err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	if err := applyDeploy(&spec, payload.Deploy); err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	return spec, nil
 }
 
-func GetSecretIDByName(cli *client.Client, secretName string) (string, error) {
-	secrets, err := cli.SecretList(context.Background(), types.SecretListOptions{})
+func GetSecretIDByName(cli DockerClient, secretName string) (string, error) {
+	secrets, err := cli.SecretList(context.Background(), types.SecretListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", secretName)),
+	})
 	if err != nil {
 		return "", err
 	}
 
+	// The name filter matches on prefix
 	for _, secret := range secrets {
 		if secret.Spec.Name == secretName {
 			return secret.ID, nil
@@ -141,10 +240,11 @@ func GetSecretIDByName(cli *client.Client, secretName string) (string, error) {
 	return "", fmt.Errorf("secret not found: %s", secretName)
 }
 
-func CreateDockerService(cli *client.Client, spec swarm.ServiceSpec) types.ServiceCreateResponse {
+// CreateDockerService creates the service described by spec and returns the response of the daemon.
+func CreateDockerService(cli DockerClient, spec swarm.ServiceSpec) (types.ServiceCreateResponse, error) {
 	serviceSpecJSON, err := json.MarshalIndent(spec, "", "  ")
 	if err != nil {
-		log.Fatalf("Error marshaling service spec to JSON: %v", err)
+		return types.ServiceCreateResponse{}, fmt.Errorf("failed to marshal service spec to JSON: %w", err)
 	}
 
 	log.Println("---------------------------")
@@ -154,7 +254,7 @@ func CreateDockerService(cli *client.Client, spec swarm.ServiceSpec) types.Servi
 	// Create the service
 	response, err := cli.ServiceCreate(context.Background(), spec, types.ServiceCreateOptions{})
 	if err != nil {
-		log.Fatalf("Error creating service: %v", err)
+		return types.ServiceCreateResponse{}, fmt.Errorf("failed to create service %s: %w", spec.Name, err)
 	}
 
 	// Print the service ID
@@ -162,5 +262,5 @@ func CreateDockerService(cli *client.Client, spec swarm.ServiceSpec) types.Servi
 		"responseId": response.ID,
 	}).Info("Service created")
 
-	return response
+	return response, nil
 }
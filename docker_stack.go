@@ -0,0 +1,433 @@
+package GoLib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// StackNamespaceLabel is the label docker stack deploy uses to group the resources of a stack,
+	// setting it makes `docker stack ls/ps/rm` work on stacks deployed with DeployStack.
+	StackNamespaceLabel = "com.docker.stack.namespace"
+	StackImageLabel     = "com.docker.stack.image"
+
+	// defaultStackNetwork is the network of the services in a stack file that list no networks.
+	defaultStackNetwork = "default"
+)
+
+// stackResource is a top level network, volume or secret of a stack file.
+type stackResource struct {
+	External bool              `yaml:"external"`
+	Name     string            `yaml:"name"`
+	Driver   string            `yaml:"driver"`
+	Options  map[string]string `yaml:"driver_opts"`
+	File     string            `yaml:"file"`
+	// Attachable networks can also be joined by standalone containers
+	Attachable bool `yaml:"attachable"`
+}
+
+type stackResources struct {
+	Networks map[string]stackResource `yaml:"networks"`
+	Volumes  map[string]stackResource `yaml:"volumes"`
+	Secrets  map[string]stackResource `yaml:"secrets"`
+	Configs  map[string]stackResource `yaml:"configs"`
+}
+
+// resolve returns the name of a resource in Docker: external resources, and resources with an explicit
+// name, keep their name, others are prefixed with the stack name like docker stack deploy does.
+func (r stackResource) resolve(stackName string, name string) string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.External:
+		return name
+	default:
+		return stackName + "_" + name
+	}
+}
+
+func resolveNames(resources map[string]stackResource, stackName string) map[string]string {
+	names := make(map[string]string)
+	for name, resource := range resources {
+		names[name] = resource.resolve(stackName, name)
+	}
+	return names
+}
+
+// DeployStack deploys all services of a stack file as `<stackName>_<service>`, comparable to
+// `docker stack deploy`. Missing networks and volumes are created, as are missing secrets and
+// configs with a file. Services without networks join the overlay network <stackName>_default. Missing external resources are an error. Existing services are updated in place,
+// or removed and created again when their deploy mode changed.
+// Services are deployed after the services they depend on, see StartupOrder, and otherwise in order
+// of their name. With StackWaitForDependencies the dependencies are also waited for. Variables in the
+// stack file are interpolated like UnmarshalStackFile does.
+func DeployStack(cli DockerClient, stackFile string, stackName string, opts ...StackOption) error {
+	options := stackOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	data, err := loadStackFile(stackFile, opts...)
+	if err != nil {
+		return err
+	}
+
+	stack := MicroServiceData{}
+	if err := yaml.Unmarshal(data, &stack); err != nil {
+		return fmt.Errorf("failed to parse stack file %s: %w", stackFile, err)
+	}
+	resources := stackResources{}
+	if err := yaml.Unmarshal(data, &resources); err != nil {
+		return fmt.Errorf("failed to parse stack file %s: %w", stackFile, err)
+	}
+	addDefaultNetwork(&stack, &resources)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := ensureStackNetworks(ctx, cli, stackName, resources.Networks); err != nil {
+		return err
+	}
+	if err := ensureStackVolumes(ctx, cli, stackName, resources.Volumes); err != nil {
+		return err
+	}
+	// Relative paths are relative to the stack file, like with docker stack deploy
+	workingDir := filepath.Dir(stackFile)
+
+	if err := ensureStackFiles(ctx, cli, stackName, workingDir, "secret", resources.Secrets); err != nil {
+		return err
+	}
+	if err := ensureStackFiles(ctx, cli, stackName, workingDir, "config", resources.Configs); err != nil {
+		return err
+	}
+
+	order, err := StartupOrder(stack.Services)
+	if err != nil {
+		return fmt.Errorf("failed to order services of stack file %s: %w", stackFile, err)
+	}
+
+	for _, name := range order {
+		details := stack.Services[name]
+		if options.waitForDependencies {
+			for _, dependency := range details.dependencyNames() {
+				if _, ok := stack.Services[dependency]; !ok {
+					continue
+				}
+				dependencyName := stackName + "_" + dependency
+				if err := WaitForDependency(context.Background(), cli, dependencyName, details.DependsOn[dependency].Condition, options.waitOpts...); err != nil {
+					return fmt.Errorf("service %s: dependency %s did not become ready: %w", name, dependencyName, err)
+				}
+			}
+		}
+
+		// Waiting can take longer than deploying, so every service gets its own timeout
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := deployStackService(ctx, cli, stackName, workingDir, name, details, resources)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addDefaultNetwork attaches the services without networks to the default network, so they can
+// reach each other by name. Like docker stack deploy, it becomes <stackName>_default, with the
+// options of a top level network called default if there is one.
+func addDefaultNetwork(stack *MicroServiceData, resources *stackResources) {
+	used := false
+	for name, details := range stack.Services {
+		if len(details.Networks) == 0 {
+			details.Networks = map[string]Network{defaultStackNetwork: {}}
+			stack.Services[name] = details
+			used = true
+		}
+	}
+
+	if _, ok := resources.Networks[defaultStackNetwork]; used && !ok {
+		if resources.Networks == nil {
+			resources.Networks = make(map[string]stackResource)
+		}
+		resources.Networks[defaultStackNetwork] = stackResource{}
+	}
+}
+
+func ensureStackNetworks(ctx context.Context, cli DockerClient, stackName string, networks map[string]stackResource) error {
+	for name, network := range networks {
+		networkName := network.resolve(stackName, name)
+
+		_, err := cli.NetworkInspect(ctx, networkName, types.NetworkInspectOptions{})
+		if err == nil {
+			continue
+		}
+		if !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to inspect network %s: %w", networkName, err)
+		}
+		// Like docker stack deploy, external networks are never created
+		if network.External {
+			return fmt.Errorf("network %s is external but does not exist", networkName)
+		}
+
+		driver := network.Driver
+		if driver == "" {
+			driver = "overlay"
+		}
+
+		_, err = cli.NetworkCreate(ctx, networkName, types.NetworkCreate{
+			CheckDuplicate: true,
+			Driver:         driver,
+			Attachable:     network.Attachable,
+			Options:        network.Options,
+			Labels:         map[string]string{StackNamespaceLabel: stackName},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create network %s: %w", networkName, err)
+		}
+		log.Infof("Created network %s", networkName)
+	}
+
+	return nil
+}
+
+func ensureStackVolumes(ctx context.Context, cli DockerClient, stackName string, volumes map[string]stackResource) error {
+	for name, vol := range volumes {
+		volumeName := vol.resolve(stackName, name)
+
+		_, err := cli.VolumeInspect(ctx, volumeName)
+		if err == nil {
+			continue
+		}
+		if !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to inspect volume %s: %w", volumeName, err)
+		}
+		if vol.External {
+			return fmt.Errorf("volume %s is external but does not exist", volumeName)
+		}
+
+		_, err = cli.VolumeCreate(ctx, volume.CreateOptions{
+			Name:       volumeName,
+			Driver:     vol.Driver,
+			DriverOpts: vol.Options,
+			Labels:     map[string]string{StackNamespaceLabel: stackName},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create volume %s: %w", volumeName, err)
+		}
+		log.Infof("Created volume %s", volumeName)
+	}
+
+	return nil
+}
+
+// ensureStackFiles creates the missing secrets or configs, depending on kind, that have a file.
+func ensureStackFiles(ctx context.Context, cli DockerClient, stackName string, workingDir string, kind string, resources map[string]stackResource) error {
+	existing := make(map[string]bool)
+	if kind == "secret" {
+		secrets, err := cli.SecretList(ctx, types.SecretListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list secrets: %w", err)
+		}
+		for _, secret := range secrets {
+			existing[secret.Spec.Name] = true
+		}
+	} else {
+		configs, err := cli.ConfigList(ctx, types.ConfigListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list configs: %w", err)
+		}
+		for _, config := range configs {
+			existing[config.Spec.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	missing := []string{}
+	for _, name := range names {
+		resource := resources[name]
+		resolved := resource.resolve(stackName, name)
+		if existing[resolved] {
+			continue
+		}
+		if resource.External || resource.File == "" {
+			missing = append(missing, resolved)
+			continue
+		}
+
+		fileName := resource.File
+		if !filepath.IsAbs(fileName) {
+			fileName = filepath.Join(workingDir, fileName)
+		}
+
+		labels := map[string]string{StackNamespaceLabel: stackName}
+		var err error
+		if kind == "secret" {
+			_, err = CreateSecretFromFile(cli, resolved, fileName, labels)
+		} else {
+			_, err = CreateConfigFromFile(cli, resolved, fileName, labels)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%ss must be created before deploying the stack, missing: %s", kind, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func deployStackService(ctx context.Context, cli DockerClient, stackName string, workingDir string, name string, details MicroServiceDetails, resources stackResources) error {
+	serviceName := stackName + "_" + name
+
+	payload := details.Payload()
+	networkNames := resolveNames(resources.Networks, stackName)
+	payload.Networks = resolveList(payload.Networks, networkNames)
+	aliases := make(map[string][]string)
+	for network, extra := range payload.NetworkAliases {
+		aliases[resolveList([]string{network}, networkNames)[0]] = extra
+	}
+
+	// Secrets of the stack keep their name in the stack file as target, so all secrets become references
+	secretRefs := []FileReference{}
+	for _, secret := range payload.Secrets {
+		secretRefs = append(secretRefs, FileReference{Source: secret})
+	}
+	payload.Secrets = nil
+	payload.SecretRefs = resolveFileReferences(append(secretRefs, payload.SecretRefs...), resolveNames(resources.Secrets, stackName))
+	payload.Configs = resolveFileReferences(payload.Configs, resolveNames(resources.Configs, stackName))
+
+	// Named volumes need the driver of the top level volume, so all volumes become mounts
+	sources := make([]string, 0, len(payload.Volumes))
+	for source := range payload.Volumes {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	configs := []MountConfig{}
+	for _, source := range sources {
+		configs = append(configs, MountConfig{Type: string(mount.TypeVolume), Source: source, Target: payload.Volumes[source]})
+	}
+	configs = append(configs, payload.Mounts...)
+
+	mounts := make([]MountConfig, 0, len(configs))
+	for _, config := range configs {
+		mounts = append(mounts, resolveStackMount(config, stackName, workingDir, resources.Volumes))
+	}
+	payload.Volumes = nil
+	payload.Mounts = mounts
+
+	spec, err := CreateServiceSpecFromPayload(payload, cli)
+	if err != nil {
+		return fmt.Errorf("failed to create spec for service %s: %w", serviceName, err)
+	}
+
+	spec.Name = serviceName
+	spec.Labels[StackNamespaceLabel] = stackName
+	spec.Labels[StackImageLabel] = spec.TaskTemplate.ContainerSpec.Image
+	// Within a stack, services reach each other by their name in the stack file
+	for i := range spec.TaskTemplate.Networks {
+		network := &spec.TaskTemplate.Networks[i]
+		network.Aliases = append([]string{name}, aliases[network.Target]...)
+	}
+
+	_, _, err = cli.ServiceInspectWithRaw(ctx, serviceName, types.ServiceInspectOptions{})
+	switch {
+	case err == nil:
+		_, err = updateServiceToSpec(cli, serviceName, spec, payload.Deploy.Replicas == nil)
+		if !errors.Is(err, ErrServiceModeChanged) {
+			return err
+		}
+		// Swarm can not change the mode of a service, it is created again
+		log.Warnf("Recreating service %s: %v", serviceName, err)
+		if err := RemoveService(cli, serviceName); err != nil {
+			return err
+		}
+	case !client.IsErrNotFound(err):
+		return fmt.Errorf("failed to inspect service %s: %w", serviceName, err)
+	}
+
+	response, err := cli.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %w", serviceName, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"service":    serviceName,
+		"responseId": response.ID,
+	}).Info("Service created")
+	return nil
+}
+
+// resolveStackMount gives named volumes their name in the stack and the driver configured in the
+// top level volumes, and makes relative bind sources relative to workingDir.
+func resolveStackMount(config MountConfig, stackName string, workingDir string, volumes map[string]stackResource) MountConfig {
+	switch mount.Type(config.Type) {
+	case mount.TypeVolume, "":
+		resource, ok := volumes[config.Source]
+		if !ok {
+			return config
+		}
+		config.Source = resource.resolve(stackName, config.Source)
+
+		if resource.Driver != "" || len(resource.Options) > 0 {
+			options := VolumeOptions{}
+			if config.Volume != nil {
+				options = *config.Volume
+			}
+			options.Driver = resource.Driver
+			options.DriverOpts = resource.Options
+			config.Volume = &options
+		}
+	case mount.TypeBind:
+		if !filepath.IsAbs(config.Source) && !strings.HasPrefix(config.Source, "~") {
+			config.Source = filepath.Join(workingDir, config.Source)
+		}
+	}
+	return config
+}
+
+// resolveFileReferences replaces the source of every reference that has an entry in names.
+// The target keeps defaulting to the name in the stack file.
+func resolveFileReferences(refs []FileReference, names map[string]string) []FileReference {
+	resolved := make([]FileReference, 0, len(refs))
+	for _, ref := range refs {
+		if mapped, ok := names[ref.Source]; ok {
+			if ref.Target == "" {
+				ref.Target = ref.Source
+			}
+			ref.Source = mapped
+		}
+		resolved = append(resolved, ref)
+	}
+	return resolved
+}
+
+// resolveList replaces every name that has an entry in names, others are kept as is.
+func resolveList(list []string, names map[string]string) []string {
+	resolved := make([]string, 0, len(list))
+	for _, name := range list {
+		if mapped, ok := names[name]; ok {
+			name = mapped
+		}
+		resolved = append(resolved, name)
+	}
+	return resolved
+}
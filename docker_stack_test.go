@@ -0,0 +1,216 @@
+package GoLib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestStackResourceNames(t *testing.T) {
+	data := `
+networks:
+  unl_1:
+    external: true
+  backend: {}
+  frontend:
+    name: shared_frontend
+volumes:
+  service_logs:
+`
+	resources := stackResources{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &resources))
+
+	networks := resolveNames(resources.Networks, "demo")
+	assert.Equal(t, map[string]string{
+		"unl_1":    "unl_1",
+		"backend":  "demo_backend",
+		"frontend": "shared_frontend",
+	}, networks)
+	assert.Equal(t, map[string]string{"service_logs": "demo_service_logs"}, resolveNames(resources.Volumes, "demo"))
+
+	assert.Equal(t, []string{"demo_backend", "other"}, resolveList([]string{"backend", "other"}, networks))
+}
+
+func TestDeployStack(t *testing.T) {
+	stackFile := filepath.Join(t.TempDir(), "stack.yml")
+	require.NoError(t, os.WriteFile(stackFile, []byte(`
+version: '3.9'
+services:
+  query_service:
+    image: query_service:1.0
+    networks:
+      backend:
+      unl_1:
+    volumes:
+      - service_logs:/var/log/service_logs
+    secrets:
+      - rabbitmq_user
+      - source: api_key
+        mode: 0400
+networks:
+  backend: {}
+  unl_1:
+    external: true
+volumes:
+  service_logs:
+    driver: local
+    driver_opts:
+      type: tmpfs
+secrets:
+  rabbitmq_user:
+    external: true
+  api_key:
+    file: ./api_key.txt
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(stackFile), "api_key.txt"), []byte("key"), 0600))
+
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	err := DeployStack(fake, stackFile, "demo")
+	assert.ErrorContains(t, err, "network unl_1 is external but does not exist")
+	_, err = fake.NetworkInspect(ctx, "unl_1", types.NetworkInspectOptions{})
+	assert.Error(t, err)
+
+	external, err := fake.NetworkCreate(ctx, "unl_1", types.NetworkCreate{Driver: "overlay"})
+	require.NoError(t, err)
+	err = DeployStack(fake, stackFile, "demo")
+	assert.ErrorContains(t, err, "missing: rabbitmq_user")
+
+	_, err = CreateSecret(fake, "rabbitmq_user", []byte("secret"), nil)
+	require.NoError(t, err)
+	require.NoError(t, DeployStack(fake, stackFile, "demo"))
+
+	network, err := fake.NetworkInspect(ctx, "demo_backend", types.NetworkInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "demo", network.Labels[StackNamespaceLabel])
+	assert.False(t, network.Attachable)
+	// Every service has networks, so there is no default network
+	_, err = fake.NetworkInspect(ctx, "demo_default", types.NetworkInspectOptions{})
+	assert.Error(t, err)
+	network, err = fake.NetworkInspect(ctx, "unl_1", types.NetworkInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, external.ID, network.ID)
+	assert.Empty(t, network.Labels[StackNamespaceLabel])
+	_, err = fake.VolumeInspect(ctx, "demo_service_logs")
+	assert.NoError(t, err)
+
+	service, _, err := fake.ServiceInspectWithRaw(ctx, "demo_query_service", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "demo", service.Spec.Labels[StackNamespaceLabel])
+	assert.Equal(t, "demo_service_logs", service.Spec.TaskTemplate.ContainerSpec.Mounts[0].Source)
+	assert.Equal(t, "tmpfs", service.Spec.TaskTemplate.ContainerSpec.Mounts[0].VolumeOptions.DriverConfig.Options["type"])
+	require.Len(t, service.Spec.TaskTemplate.Networks, 2)
+	assert.Equal(t, "demo_backend", service.Spec.TaskTemplate.Networks[0].Target)
+	assert.Equal(t, []string{"query_service"}, service.Spec.TaskTemplate.Networks[0].Aliases)
+
+	secrets := service.Spec.TaskTemplate.ContainerSpec.Secrets
+	require.Len(t, secrets, 2)
+	assert.Equal(t, "rabbitmq_user", secrets[0].SecretName)
+	assert.Equal(t, "demo_api_key", secrets[1].SecretName)
+	assert.Equal(t, "api_key", secrets[1].File.Name)
+
+	// Deploying again updates the existing service
+	require.NoError(t, DeployStack(fake, stackFile, "demo"))
+	service, _, err = fake.ServiceInspectWithRaw(ctx, "demo_query_service", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), service.Version.Index)
+}
+
+func TestDeployStackDefaultNetwork(t *testing.T) {
+	stackFile := filepath.Join(t.TempDir(), "stack.yml")
+	require.NoError(t, os.WriteFile(stackFile, []byte(`
+services:
+  query_service:
+    image: query_service:1.0
+  anonymize_service:
+    image: anonymize_service:1.0
+  tools:
+    image: tools:1.0
+    networks:
+      - debug
+networks:
+  debug:
+    attachable: true
+`), 0644))
+
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+	require.NoError(t, DeployStack(fake, stackFile, "demo"))
+
+	network, err := fake.NetworkInspect(ctx, "demo_default", types.NetworkInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "overlay", network.Driver)
+	assert.False(t, network.Attachable)
+	assert.Equal(t, "demo", network.Labels[StackNamespaceLabel])
+	network, err = fake.NetworkInspect(ctx, "demo_debug", types.NetworkInspectOptions{})
+	require.NoError(t, err)
+	assert.True(t, network.Attachable)
+
+	for name, target := range map[string]string{"query_service": "demo_default", "anonymize_service": "demo_default", "tools": "demo_debug"} {
+		service, _, err := fake.ServiceInspectWithRaw(ctx, "demo_"+name, types.ServiceInspectOptions{})
+		require.NoError(t, err)
+		require.Len(t, service.Spec.TaskTemplate.Networks, 1, name)
+		assert.Equal(t, target, service.Spec.TaskTemplate.Networks[0].Target, name)
+		assert.Equal(t, []string{name}, service.Spec.TaskTemplate.Networks[0].Aliases, name)
+	}
+}
+
+func TestDeployStackMissingExternalVolume(t *testing.T) {
+	stackFile := filepath.Join(t.TempDir(), "stack.yml")
+	require.NoError(t, os.WriteFile(stackFile, []byte(`
+services:
+  query_service:
+    image: query_service:1.0
+    volumes:
+      - shared_data:/data
+volumes:
+  shared_data:
+    external: true
+`), 0644))
+
+	fake := NewFakeSwarm()
+	err := DeployStack(fake, stackFile, "demo")
+	assert.ErrorContains(t, err, "volume shared_data is external but does not exist")
+
+	_, err = fake.VolumeInspect(context.Background(), "shared_data")
+	assert.Error(t, err)
+	services, err := fake.ServiceList(context.Background(), types.ServiceListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+func TestDeployStackModeChange(t *testing.T) {
+	stackFile := filepath.Join(t.TempDir(), "stack.yml")
+	writeStack := func(mode string) {
+		require.NoError(t, os.WriteFile(stackFile, []byte(`
+services:
+  collector:
+    image: log_collector
+    deploy:
+      mode: `+mode+`
+`), 0644))
+	}
+
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	writeStack("replicated")
+	require.NoError(t, DeployStack(fake, stackFile, "demo"))
+	before, _, err := fake.ServiceInspectWithRaw(ctx, "demo_collector", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+
+	writeStack("global")
+	require.NoError(t, DeployStack(fake, stackFile, "demo"))
+	after, _, err := fake.ServiceInspectWithRaw(ctx, "demo_collector", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.NotEqual(t, before.ID, after.ID)
+	assert.NotNil(t, after.Spec.Mode.Global)
+}
@@ -0,0 +1,307 @@
+package GoLib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+var (
+	ErrServiceNotConverged = errors.New("service did not converge")
+	ErrImageNotFound       = errors.New("image not found")
+	ErrNoSuitableNode      = errors.New("no suitable node")
+	ErrOutOfMemory         = errors.New("task ran out of memory")
+	ErrTaskFailed          = errors.New("task failed")
+	ErrUpdatePaused        = errors.New("service update paused")
+)
+
+// TaskError describes why a task of a service did not reach the running state.
+// Use errors.Is with ErrImageNotFound, ErrNoSuitableNode, ErrOutOfMemory or ErrTaskFailed to
+// find out the cause.
+type TaskError struct {
+	ServiceID string
+	TaskID    string
+	State     swarm.TaskState
+	Message   string
+	ExitCode  int
+	cause     error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("task %s of service %s is %s: %v: %s", e.TaskID, e.ServiceID, e.State, e.cause, e.Message)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.cause
+}
+
+type waitOptions struct {
+	timeout         time.Duration
+	pollInterval    time.Duration
+	maxTaskFailures int
+}
+
+type WaitOption func(*waitOptions)
+
+// WaitTimeout limits how long WaitForService waits, on top of the deadline of the context.
+func WaitTimeout(timeout time.Duration) WaitOption {
+	return func(options *waitOptions) {
+		options.timeout = timeout
+	}
+}
+
+func WaitPollInterval(interval time.Duration) WaitOption {
+	return func(options *waitOptions) {
+		options.pollInterval = interval
+	}
+}
+
+// WaitMaxTaskFailures sets after how many failed tasks a crash looping service is given up on, default 3.
+func WaitMaxTaskFailures(failures int) WaitOption {
+	return func(options *waitOptions) {
+		options.maxTaskFailures = failures
+	}
+}
+
+// WaitForService blocks until the last update of a service (by name or ID) is rolled out and the
+// desired number of tasks is running. Until Swarm reports the update completed, the running tasks
+// may still be of the old version, so they are not counted. It fails early with a *TaskError when
+// an image can not be pulled or tasks keep failing, with ErrUpdatePaused when Swarm paused the
+// update, and returns the last task error, or ErrServiceNotConverged, when the context or timeout
+// expires.
+func WaitForService(ctx context.Context, cli DockerClient, serviceID string, opts ...WaitOption) error {
+	options := applyWaitOptions(opts)
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+
+	service, _, err := cli.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to inspect service %s: %w", serviceID, err)
+	}
+
+	// Failed tasks from before an update are not the concern of this wait
+	since := service.UpdatedAt
+	failures := make(map[string]bool)
+	var lastErr *TaskError
+
+	ticker := time.NewTicker(options.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// The update status changes while the update rolls out
+		current, _, err := cli.ServiceInspectWithRaw(ctx, service.ID, types.ServiceInspectOptions{})
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to inspect service %s: %w", serviceID, err)
+		}
+		if err == nil {
+			service = current
+		}
+		rolledOut, err := updateRolledOut(service)
+		if err != nil {
+			return err
+		}
+
+		tasks, err := cli.TaskList(ctx, types.TaskListOptions{
+			Filters: filters.NewArgs(filters.Arg("service", service.ID)),
+		})
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to list tasks of service %s: %w", serviceID, err)
+		}
+
+		desired, running := 0, 0
+		for _, task := range tasks {
+			if task.DesiredState == swarm.TaskStateRunning {
+				desired++
+				if task.Status.State == swarm.TaskStateRunning {
+					running++
+				}
+			}
+
+			taskErr := classifyTask(service.ID, task)
+			if taskErr == nil || task.CreatedAt.Before(since) {
+				continue
+			}
+			lastErr = taskErr
+
+			// A missing image will not appear by retrying, a failing task might succeed next time
+			if errors.Is(taskErr, ErrImageNotFound) {
+				return taskErr
+			}
+			if taskErr.State == swarm.TaskStateFailed || taskErr.State == swarm.TaskStateRejected {
+				failures[task.ID] = true
+			}
+		}
+
+		if len(failures) > 0 && len(failures) >= options.maxTaskFailures {
+			return lastErr
+		}
+
+		// Global services have no replica count, they are done when every scheduled task runs
+		converged := desired > 0 && running == desired
+		if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
+			desired = int(*service.Spec.Mode.Replicated.Replicas)
+			converged = running >= desired
+		}
+		if err == nil && rolledOut && converged {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return lastErr
+			}
+			if !rolledOut {
+				return fmt.Errorf("%w: update of %s is %s: %v", ErrServiceNotConverged, serviceID, service.UpdateStatus.State, ctx.Err())
+			}
+			return fmt.Errorf("%w: %d of %d tasks of %s running: %v", ErrServiceNotConverged, running, desired, serviceID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateRolledOut reports whether the last update of a service is completed or rolled back, a
+// service that was never updated has no update status. A paused update needs a manual fix.
+func updateRolledOut(service swarm.Service) (bool, error) {
+	if service.UpdateStatus == nil {
+		return true, nil
+	}
+	switch service.UpdateStatus.State {
+	case swarm.UpdateStateUpdating, swarm.UpdateStateRollbackStarted:
+		return false, nil
+	case swarm.UpdateStatePaused, swarm.UpdateStateRollbackPaused:
+		return false, fmt.Errorf("%w: update of %s is %s: %s", ErrUpdatePaused, service.Spec.Name, service.UpdateStatus.State, service.UpdateStatus.Message)
+	default:
+		return true, nil
+	}
+}
+
+// WaitForServiceCompletion blocks until a task of a service (by name or ID) exited successfully,
+// for services that run once, like migrations with restart policy "none". It fails like
+// WaitForService when the image is missing or tasks keep failing.
+func WaitForServiceCompletion(ctx context.Context, cli DockerClient, serviceID string, opts ...WaitOption) error {
+	options := applyWaitOptions(opts)
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+
+	service, _, err := cli.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to inspect service %s: %w", serviceID, err)
+	}
+
+	since := service.UpdatedAt
+	failures := make(map[string]bool)
+	var lastErr *TaskError
+
+	ticker := time.NewTicker(options.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		tasks, err := cli.TaskList(ctx, types.TaskListOptions{
+			Filters: filters.NewArgs(filters.Arg("service", service.ID)),
+		})
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("failed to list tasks of service %s: %w", serviceID, err)
+		}
+
+		for _, task := range tasks {
+			if task.CreatedAt.Before(since) {
+				continue
+			}
+			if task.Status.State == swarm.TaskStateComplete {
+				return nil
+			}
+
+			taskErr := classifyTask(service.ID, task)
+			if taskErr == nil {
+				continue
+			}
+			lastErr = taskErr
+			if errors.Is(taskErr, ErrImageNotFound) {
+				return taskErr
+			}
+			if taskErr.State == swarm.TaskStateFailed || taskErr.State == swarm.TaskStateRejected {
+				failures[task.ID] = true
+			}
+		}
+
+		if len(failures) > 0 && len(failures) >= options.maxTaskFailures {
+			return lastErr
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return lastErr
+			}
+			return fmt.Errorf("%w: no task of %s completed: %v", ErrServiceNotConverged, serviceID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func applyWaitOptions(opts []WaitOption) *waitOptions {
+	options := &waitOptions{
+		pollInterval:    time.Second,
+		maxTaskFailures: 3,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// oomMessage matches the messages of a container killed by the kernel OOM killer. Exit code 137
+// alone is any SIGKILL, like docker service rm or a failing healthcheck, so both must match.
+var oomMessage = regexp.MustCompile(`\boom[ -]?kill(ed)?\b|\bout of memory\b`)
+
+// classifyTask returns a TaskError for tasks that failed, were rejected or can not be scheduled.
+func classifyTask(serviceID string, task swarm.Task) *TaskError {
+	status := task.Status
+	message := status.Err
+	if message == "" {
+		message = status.Message
+	}
+
+	taskErr := &TaskError{
+		ServiceID: serviceID,
+		TaskID:    task.ID,
+		State:     status.State,
+		Message:   message,
+	}
+	if status.ContainerStatus != nil {
+		taskErr.ExitCode = status.ContainerStatus.ExitCode
+	}
+
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "no such image"),
+		strings.Contains(lower, "pull access denied"),
+		strings.Contains(lower, "manifest unknown"),
+		strings.Contains(lower, "repository does not exist"):
+		taskErr.cause = ErrImageNotFound
+	case strings.Contains(lower, "no suitable node"):
+		taskErr.cause = ErrNoSuitableNode
+	case status.State == swarm.TaskStateFailed && taskErr.ExitCode == 137 && oomMessage.MatchString(lower):
+		taskErr.cause = ErrOutOfMemory
+	case status.State == swarm.TaskStateFailed || status.State == swarm.TaskStateRejected:
+		taskErr.cause = ErrTaskFailed
+	default:
+		return nil
+	}
+
+	return taskErr
+}
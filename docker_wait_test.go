@@ -0,0 +1,125 @@
+package GoLib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyTask(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status swarm.TaskStatus
+		cause  error
+	}{
+		{"running", swarm.TaskStatus{State: swarm.TaskStateRunning}, nil},
+		{"image", swarm.TaskStatus{State: swarm.TaskStateRejected, Err: "No such image: query_service:latest"}, ErrImageNotFound},
+		{"pull", swarm.TaskStatus{State: swarm.TaskStateRejected, Err: "pull access denied for query_service"}, ErrImageNotFound},
+		{"node", swarm.TaskStatus{State: swarm.TaskStatePending, Err: "no suitable node (scheduling constraints not satisfied on 3 nodes)"}, ErrNoSuitableNode},
+		{"oom", swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "task: non-zero exit (137): OOMKilled", ContainerStatus: &swarm.ContainerStatus{ExitCode: 137}}, ErrOutOfMemory},
+		{"out of memory", swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "task: non-zero exit (137): container ran out of memory", ContainerStatus: &swarm.ContainerStatus{ExitCode: 137}}, ErrOutOfMemory},
+		{"sigkill", swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "task: non-zero exit (137)", ContainerStatus: &swarm.ContainerStatus{ExitCode: 137}}, ErrTaskFailed},
+		{"unhealthy", swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "task: non-zero exit (137): dockerexec: unhealthy container", ContainerStatus: &swarm.ContainerStatus{ExitCode: 137}}, ErrTaskFailed},
+		{"room", swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "task: non-zero exit (137): no room left on device", ContainerStatus: &swarm.ContainerStatus{ExitCode: 137}}, ErrTaskFailed},
+		{"oom without sigkill", swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "task: non-zero exit (1): zoom call failed, OOMKilled", ContainerStatus: &swarm.ContainerStatus{ExitCode: 1}}, ErrTaskFailed},
+		{"failed", swarm.TaskStatus{State: swarm.TaskStateFailed, Err: "task: non-zero exit (1)", ContainerStatus: &swarm.ContainerStatus{ExitCode: 1}}, ErrTaskFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			taskErr := classifyTask("service1", swarm.Task{ID: "task1", Status: tc.status})
+			if tc.cause == nil {
+				assert.Nil(t, taskErr)
+				return
+			}
+
+			assert.True(t, errors.Is(taskErr, tc.cause), taskErr.Error())
+			assert.Equal(t, "task1", taskErr.TaskID)
+		})
+	}
+}
+
+func TestWaitForServiceConverged(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service", Deploy: Deploy{Replicas: NewReplicas(2)}})
+
+	err := WaitForService(context.Background(), fake, id, WaitTimeout(time.Second), WaitPollInterval(10*time.Millisecond))
+	assert.NoError(t, err)
+}
+
+func TestWaitForServiceRollout(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service", Tag: "1.0"})
+
+	// The tasks of 1.0 keep running while 1.1 rolls out, they do not make the update converged
+	fake.SetManualRollouts(true)
+	_, err := UpdateDockerService(fake, id, CreateServicePayload{ImageName: "query_service", Tag: "1.1"})
+	require.NoError(t, err)
+
+	err = WaitForService(context.Background(), fake, id, WaitTimeout(50*time.Millisecond), WaitPollInterval(10*time.Millisecond))
+	assert.ErrorIs(t, err, ErrServiceNotConverged)
+	assert.ErrorContains(t, err, "is updating")
+
+	done := make(chan error)
+	go func() {
+		done <- WaitForService(context.Background(), fake, id, WaitTimeout(time.Second), WaitPollInterval(10*time.Millisecond))
+	}()
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, fake.CompleteRollout(id))
+	assert.NoError(t, <-done)
+
+	tasks, err := fake.TaskList(context.Background(), types.TaskListOptions{})
+	require.NoError(t, err)
+	for _, task := range tasks {
+		if task.DesiredState == swarm.TaskStateRunning {
+			assert.Equal(t, "docker.io/library/query_service:1.1", task.Spec.ContainerSpec.Image)
+		}
+	}
+}
+
+func TestWaitForServiceUpdatePaused(t *testing.T) {
+	_, err := updateRolledOut(swarm.Service{
+		Spec:         swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "query"}},
+		UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStatePaused, Message: "update paused due to failure or early termination of task"},
+	})
+	assert.ErrorIs(t, err, ErrUpdatePaused)
+
+	rolledOut, err := updateRolledOut(swarm.Service{UpdateStatus: &swarm.UpdateStatus{State: swarm.UpdateStateRollbackCompleted}})
+	assert.NoError(t, err)
+	assert.True(t, rolledOut)
+}
+
+func TestWaitForServiceImageNotFound(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "missing"})
+
+	require.NoError(t, fake.UpdateTasks(id, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateRejected
+		task.Status.Err = "No such image: missing:latest"
+	}))
+
+	err := WaitForService(context.Background(), fake, id, WaitTimeout(time.Second), WaitPollInterval(10*time.Millisecond))
+	assert.ErrorIs(t, err, ErrImageNotFound)
+
+	var taskErr *TaskError
+	require.ErrorAs(t, err, &taskErr)
+	assert.Equal(t, id, taskErr.ServiceID)
+}
+
+func TestWaitForServiceNotConverged(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "query_service"})
+
+	require.NoError(t, fake.UpdateTasks(id, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStatePending
+	}))
+
+	err := WaitForService(context.Background(), fake, id, WaitTimeout(50*time.Millisecond), WaitPollInterval(10*time.Millisecond))
+	assert.ErrorIs(t, err, ErrServiceNotConverged)
+}
@@ -1,14 +1,14 @@
 package GoLib
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"reflect"
 	"strings"
 	"time"
 
-	"github.com/cloudflare/cfssl/log"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"gopkg.in/yaml.v2"
 )
@@ -38,7 +38,7 @@ func LeaseTime(leaseTime int64) Option {
 }
 
 // Create object in Etcd with a default 5 second lease
-func CreateEtcdLeaseObject(etcdClient *clientv3.Client, key string, value string, opts ...Option) {
+func CreateEtcdLeaseObject(etcdClient EtcdClient, key string, value string, opts ...Option) {
 	// Default options
 	options := &leaseOptions{
 		leaseTime: 5,
@@ -74,42 +74,47 @@ func CreateEtcdLeaseObject(etcdClient *clientv3.Client, key string, value string
 	}
 }
 
-func UnmarshalStackFile(fileLocation string) MicroServiceData {
-
-	yamlFile, err := os.ReadFile(fileLocation)
+// UnmarshalStackFile reads the services of a stack file. Problems in the stack file are returned
+// together as a *StackValidationError, with the file and line of every problem.
+func UnmarshalStackFile(fileLocation string, opts ...StackOption) (MicroServiceData, error) {
+	yamlFile, err := loadStackFile(fileLocation, opts...)
 	if err != nil {
-		log.Errorf("Failed to read the YAML file: %v", err)
+		return MicroServiceData{}, err
 	}
 
 	service := MicroServiceData{}
-	err = yaml.Unmarshal(yamlFile, &service)
-	if err != nil {
-		log.Errorf("Failed to unmarshal the YAML file: %v", err)
+	if err := yaml.Unmarshal(yamlFile, &service); err != nil {
+		return MicroServiceData{}, fmt.Errorf("failed to unmarshal stack file %s: %w", fileLocation, err)
+	}
+	return service, nil
+}
+
+// WithStackOptions passes options for reading the stack file to SetMicroservicesEtcd.
+func WithStackOptions(opts ...StackOption) EtcdOption {
+	return func(options *etcdOptions) {
+		options.stackOpts = append(options.stackOpts, opts...)
 	}
-	return service
 }
 
 // Take a given docker stack yaml file, and save all pertinent info (struct MicroServiceData), like the
 // required env variable and volumes etc. Into etcd.
-func SetMicroservicesEtcd(etcdClient EtcdClient, fileLocation string, etcdPath string) (map[string]MicroServiceDetails, error) {
+func SetMicroservicesEtcd(etcdClient EtcdClient, fileLocation string, etcdPath string, opts ...EtcdOption) (map[string]MicroServiceDetails, error) {
 	if etcdPath == "" {
 		etcdPath = "/microservices"
 	}
 
-	var service MicroServiceData = UnmarshalStackFile(fileLocation)
+	options := applyEtcdOptions(opts)
+	service, err := UnmarshalStackFile(fileLocation, options.stackOpts...)
+	if err != nil {
+		log.Errorf("Failed to read stack file: %v", err)
+		return nil, err
+	}
 
 	processedServices := make(map[string]MicroServiceDetails)
 
 	for serviceName, payload := range service.Services {
 
-		jsonPayload, err := json.Marshal(payload)
-		if err != nil {
-			log.Errorf("Failed to marshal the payload to JSON: %v", err)
-			return nil, err
-		}
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		_, err = etcdClient.Put(ctx, fmt.Sprintf("%s/%s", etcdPath, serviceName), string(jsonPayload))
+		err := SaveStructToEtcd(etcdClient, fmt.Sprintf("%s/%s", etcdPath, serviceName), payload, opts...)
 		if err != nil {
 			log.Errorf("Failed creating service config in etcd: %s", err)
 			return nil, err
@@ -120,7 +125,7 @@ func SetMicroservicesEtcd(etcdClient EtcdClient, fileLocation string, etcdPath s
 	return processedServices, nil
 }
 
-func GetValueFromEtcd(etcdClient *clientv3.Client, key string) (string, error) {
+func GetValueFromEtcd(etcdClient EtcdClient, key string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -137,7 +142,7 @@ func GetValueFromEtcd(etcdClient *clientv3.Client, key string) (string, error) {
 	return value, nil
 }
 
-func GetKeyValueMap(etcdClient *clientv3.Client, pathName string) (map[string]string, error) {
+func GetKeyValueMap(etcdClient EtcdClient, pathName string) (map[string]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -160,7 +165,8 @@ func GetKeyValueMap(etcdClient *clientv3.Client, pathName string) (map[string]st
 }
 
 // RegisterJSONArray takes a JSON array, unmarshals it into the target Iterable,
-// and stores each element in the etcd key-value store.
+// and stores each element in the etcd key-value store. The JSON is first validated against the
+// schema of the target, nothing is stored when it does not match (see GenerateJSONSchema).
 //   - T is the underlying struct type of the target.
 //   - jsonContent is the byte array containing the JSON content.
 //   - target should be an instance of a struct that implements the Iterable and NameGetter interfaces.
@@ -168,10 +174,21 @@ func GetKeyValueMap(etcdClient *clientv3.Client, pathName string) (map[string]st
 //   - key is the etcd key prefix where the elements will be stored.
 //
 // Add Get(), .GetName() interfaces to struct that uses this. See archetypes/requestor as an example
-func RegisterJSONArray[T any](jsonContent []byte, target Iterable, etcdClient *clientv3.Client, key string) error {
+func RegisterJSONArray[T any](jsonContent []byte, target Iterable, etcdClient EtcdClient, key string) error {
 
-	err := json.Unmarshal(jsonContent, &target)
+	schema, err := cachedJSONSchema(reflect.TypeOf(target))
 	if err != nil {
+		return err
+	}
+	if err := schema.Validate(jsonContent); err != nil {
+		log.Errorf("JSON content does not match the schema: %v", err)
+		return err
+	}
+
+	// Typos in field names would otherwise silently become empty values
+	decoder := json.NewDecoder(bytes.NewReader(jsonContent))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
 		log.Errorf("failed to unmarshal JSON content: %v", err)
 		return err
 	}
@@ -203,7 +220,10 @@ func RegisterJSONArray[T any](jsonContent []byte, target Iterable, etcdClient *c
 // - etcdClient is an instance of the etcd client.
 // - key is the etcd key where the JSON value is stored.
 // - target should be a pointer to an instance of the target struct.
-func GetAndUnmarshalJSON[T any](etcdClient *clientv3.Client, key string, target T) ([]byte, error) {
+// - pass WithEncryption to decrypt values written with the same option.
+func GetAndUnmarshalJSON[T any](etcdClient EtcdClient, key string, target T, opts ...EtcdOption) ([]byte, error) {
+	options := applyEtcdOptions(opts)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -220,7 +240,7 @@ func GetAndUnmarshalJSON[T any](etcdClient *clientv3.Client, key string, target
 	}
 
 	// Unmarshal the JSON value into the target struct.
-	err = json.Unmarshal(resp.Kvs[0].Value, target)
+	err = decryptJSON(options.keyring, resp.Kvs[0].Value, target)
 	if err != nil {
 		log.Errorf("failed to unmarshal JSON: %v", err)
 		return nil, err
@@ -233,7 +253,9 @@ func GetAndUnmarshalJSON[T any](etcdClient *clientv3.Client, key string, target
 // Pass a full path (like /microservices/) and get a Map back of all entries in that folder.
 //
 // See etcd_test.go for examples
-func GetAndUnmarshalJSONMap[T any](etcdClient *clientv3.Client, prefix string) (map[string]T, error) {
+func GetAndUnmarshalJSONMap[T any](etcdClient EtcdClient, prefix string, opts ...EtcdOption) (map[string]T, error) {
+	options := applyEtcdOptions(opts)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	// Get all key-value pairs under the specified prefix.
@@ -256,7 +278,7 @@ func GetAndUnmarshalJSONMap[T any](etcdClient *clientv3.Client, prefix string) (
 
 		// Unmarshal the JSON value into the target struct.
 		var target T
-		err = json.Unmarshal(kv.Value, &target)
+		err = decryptJSON(options.keyring, kv.Value, &target)
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal JSON for key %s: %v", key, err)
 		}
@@ -272,9 +294,12 @@ func GetAndUnmarshalJSONMap[T any](etcdClient *clientv3.Client, prefix string) (
 // target is an instance of the struct.
 // etcdClient is an instance of the etcd client.
 // key is the etcd key where the value will be stored.
-func SaveStructToEtcd[T any](etcdClient *clientv3.Client, key string, target T) error {
+// Pass WithEncryption to encrypt the fields tagged with `encrypt:"true"`, or the whole value if there are none.
+func SaveStructToEtcd[T any](etcdClient EtcdClient, key string, target T, opts ...EtcdOption) error {
+	options := applyEtcdOptions(opts)
+
 	// Marshal the target struct into a JSON representation
-	jsonRep, err := json.Marshal(target)
+	jsonRep, err := marshalForEtcd(target, options)
 	if err != nil {
 		log.Errorf("failed to marshal struct: %v", err)
 		return err
@@ -0,0 +1,340 @@
+package GoLib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/yaml.v2"
+)
+
+// EtcdBundleVersion is the format version written into the metadata of every exported bundle.
+const EtcdBundleVersion = 1
+
+// ErrImportConflict is returned by ImportEtcd in ConflictFail mode when a key already holds a different value.
+var ErrImportConflict = errors.New("bundle conflicts with existing keys in etcd")
+
+// EtcdBundle is a portable dump of one or more etcd prefixes, see ExportEtcd and ImportEtcd.
+type EtcdBundle struct {
+	Metadata EtcdBundleMetadata `json:"metadata" yaml:"metadata"`
+	Entries  []EtcdBundleEntry  `json:"entries" yaml:"entries"`
+}
+
+type EtcdBundleMetadata struct {
+	Version   int       `json:"version" yaml:"version"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	Source    string    `json:"source,omitempty" yaml:"source,omitempty"`
+	Prefixes  []string  `json:"prefixes" yaml:"prefixes"`
+	Revision  int64     `json:"revision" yaml:"revision"`
+	Checksum  string    `json:"checksum" yaml:"checksum"`
+}
+
+type EtcdBundleEntry struct {
+	Key      string `json:"key" yaml:"key"`
+	Value    string `json:"value" yaml:"value"`
+	Checksum string `json:"checksum" yaml:"checksum"`
+}
+
+type BundleFormat string
+
+const (
+	BundleFormatYAML BundleFormat = "yaml"
+	BundleFormatJSON BundleFormat = "json"
+)
+
+// ExportEtcd reads all keys under the given prefixes at a single revision and returns them as a bundle.
+// source is free text stored in the metadata, like the name of the environment the bundle came from.
+func ExportEtcd(etcdClient EtcdClient, prefixes []string, source string) (*EtcdBundle, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	bundle := &EtcdBundle{
+		Metadata: EtcdBundleMetadata{
+			Version:   EtcdBundleVersion,
+			CreatedAt: time.Now().UTC(),
+			Source:    source,
+			Prefixes:  prefixes,
+		},
+	}
+
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		if bundle.Metadata.Revision != 0 {
+			opts = append(opts, clientv3.WithRev(bundle.Metadata.Revision))
+		}
+
+		resp, err := etcdClient.Get(ctx, prefix, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get keys with prefix %s from etcd: %w", prefix, err)
+		}
+		if bundle.Metadata.Revision == 0 {
+			bundle.Metadata.Revision = resp.Header.Revision
+		}
+
+		for _, kv := range resp.Kvs {
+			// Overlapping prefixes would otherwise export a key twice
+			if seen[string(kv.Key)] {
+				continue
+			}
+			seen[string(kv.Key)] = true
+
+			bundle.Entries = append(bundle.Entries, EtcdBundleEntry{
+				Key:      string(kv.Key),
+				Value:    string(kv.Value),
+				Checksum: checksum(kv.Value),
+			})
+		}
+	}
+
+	sort.Slice(bundle.Entries, func(i, j int) bool { return bundle.Entries[i].Key < bundle.Entries[j].Key })
+	bundle.Metadata.Checksum = bundle.checksum()
+
+	return bundle, nil
+}
+
+// Verify checks the checksum of every entry and of the bundle as a whole.
+func (b *EtcdBundle) Verify() error {
+	for _, entry := range b.Entries {
+		if checksum([]byte(entry.Value)) != entry.Checksum {
+			return fmt.Errorf("checksum mismatch for key %s", entry.Key)
+		}
+	}
+
+	if b.checksum() != b.Metadata.Checksum {
+		return fmt.Errorf("bundle checksum mismatch, expected %s", b.Metadata.Checksum)
+	}
+	return nil
+}
+
+func (b *EtcdBundle) checksum() string {
+	hash := sha256.New()
+	for _, entry := range b.Entries {
+		fmt.Fprintf(hash, "%s\x00%s\n", entry.Key, entry.Checksum)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func checksum(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteEtcdBundle encodes the bundle as YAML or JSON.
+func WriteEtcdBundle(w io.Writer, bundle *EtcdBundle, format BundleFormat) error {
+	switch format {
+	case BundleFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(bundle)
+	case BundleFormatYAML, "":
+		return yaml.NewEncoder(w).Encode(bundle)
+	default:
+		return fmt.Errorf("unknown bundle format: %s", format)
+	}
+}
+
+// ReadEtcdBundle decodes a bundle written by WriteEtcdBundle in either format and verifies its checksums.
+func ReadEtcdBundle(r io.Reader) (*EtcdBundle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &EtcdBundle{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(data, bundle)
+	} else {
+		err = yaml.Unmarshal(data, bundle)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bundle: %w", err)
+	}
+
+	if bundle.Metadata.Version != EtcdBundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Metadata.Version)
+	}
+
+	if err := bundle.Verify(); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+type ConflictMode string
+
+const (
+	// ConflictOverwrite replaces existing values with the ones from the bundle.
+	ConflictOverwrite ConflictMode = "overwrite"
+	// ConflictSkip keeps existing values and only creates missing keys.
+	ConflictSkip ConflictMode = "skip"
+	// ConflictFail aborts the import, before writing anything, if any key holds a different value.
+	ConflictFail ConflictMode = "fail"
+)
+
+type ImportAction string
+
+const (
+	ImportCreate    ImportAction = "create"
+	ImportUpdate    ImportAction = "update"
+	ImportUnchanged ImportAction = "unchanged"
+	ImportSkip      ImportAction = "skip"
+)
+
+type ImportChange struct {
+	Key      string
+	Action   ImportAction
+	OldValue string
+	NewValue string
+}
+
+// ImportReport lists what ImportEtcd did, or would do in a dry run, for every key in the bundle.
+type ImportReport struct {
+	DryRun  bool
+	Changes []ImportChange
+}
+
+// String renders the report as a diff: + for created, ~ for updated and ! for skipped keys.
+func (r ImportReport) String() string {
+	var sb strings.Builder
+
+	for _, change := range r.Changes {
+		switch change.Action {
+		case ImportCreate:
+			sb.WriteString(fmt.Sprintf("+ %s\n", change.Key))
+			sb.WriteString(fmt.Sprintf("    + %s\n", change.NewValue))
+		case ImportUpdate:
+			sb.WriteString(fmt.Sprintf("~ %s\n", change.Key))
+			sb.WriteString(fmt.Sprintf("    - %s\n", change.OldValue))
+			sb.WriteString(fmt.Sprintf("    + %s\n", change.NewValue))
+		case ImportSkip:
+			sb.WriteString(fmt.Sprintf("! %s (exists, skipped)\n", change.Key))
+		}
+	}
+
+	return sb.String()
+}
+
+// Count returns the number of keys with the given action.
+func (r ImportReport) Count(action ImportAction) int {
+	count := 0
+	for _, change := range r.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+type importOptions struct {
+	mode   ConflictMode
+	dryRun bool
+}
+
+type ImportOption func(*importOptions)
+
+func ImportConflictMode(mode ConflictMode) ImportOption {
+	return func(options *importOptions) {
+		options.mode = mode
+	}
+}
+
+// ImportDryRun only computes the report, nothing is written to etcd.
+func ImportDryRun() ImportOption {
+	return func(options *importOptions) {
+		options.dryRun = true
+	}
+}
+
+// ImportEtcd writes the entries of a bundle into etcd, by default overwriting existing values.
+// Every key is written with a compare on the revision it was read at, so keys changed
+// concurrently during the import are reported as an error instead of being overwritten blindly.
+func ImportEtcd(etcdClient EtcdClient, bundle *EtcdBundle, opts ...ImportOption) (*ImportReport, error) {
+	options := &importOptions{
+		mode: ConflictOverwrite,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	switch options.mode {
+	case ConflictOverwrite, ConflictSkip, ConflictFail:
+	default:
+		return nil, fmt.Errorf("unknown conflict mode: %s", options.mode)
+	}
+
+	if err := bundle.Verify(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report := &ImportReport{DryRun: options.dryRun}
+	revisions := make(map[string]int64)
+	conflicts := []string{}
+
+	for _, entry := range bundle.Entries {
+		resp, err := etcdClient.Get(ctx, entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key %s from etcd: %w", entry.Key, err)
+		}
+
+		change := ImportChange{Key: entry.Key, NewValue: entry.Value}
+		switch {
+		case len(resp.Kvs) == 0:
+			change.Action = ImportCreate
+		case string(resp.Kvs[0].Value) == entry.Value:
+			change.Action = ImportUnchanged
+		default:
+			change.OldValue = string(resp.Kvs[0].Value)
+			revisions[entry.Key] = resp.Kvs[0].ModRevision
+
+			switch options.mode {
+			case ConflictSkip:
+				change.Action = ImportSkip
+			case ConflictFail:
+				conflicts = append(conflicts, entry.Key)
+				change.Action = ImportUpdate
+			default:
+				change.Action = ImportUpdate
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+
+	if len(conflicts) > 0 {
+		return report, fmt.Errorf("%w: %s", ErrImportConflict, strings.Join(conflicts, ", "))
+	}
+
+	if options.dryRun {
+		return report, nil
+	}
+
+	for _, change := range report.Changes {
+		if change.Action != ImportCreate && change.Action != ImportUpdate {
+			continue
+		}
+
+		cmp := clientv3.Compare(clientv3.ModRevision(change.Key), "=", revisions[change.Key])
+		resp, err := etcdClient.Txn(ctx).If(cmp).Then(clientv3.OpPut(change.Key, change.NewValue)).Commit()
+		if err != nil {
+			return report, fmt.Errorf("failed to import key %s: %w", change.Key, err)
+		}
+		if !resp.Succeeded {
+			return report, fmt.Errorf("key %s was modified during the import", change.Key)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,77 @@
+package GoLib
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportEtcd(t *testing.T) {
+	ctx := context.Background()
+	source := setupEtcdClient(t)
+	for key, value := range map[string]string{
+		"/microservices/query_service":     `{"image":"query_service"}`,
+		"/microservices/anonymize_service": `{"image":"anonymize_service"}`,
+		"/archetypes/computeToData":        `{"name":"computeToData"}`,
+		"/agents/not_exported":             `{}`,
+	} {
+		_, err := source.Put(ctx, key, value)
+		require.NoError(t, err)
+	}
+
+	bundle, err := ExportEtcd(source, []string{"/microservices", "/archetypes", "/microservices/query"}, "test")
+	require.NoError(t, err)
+	require.Len(t, bundle.Entries, 3)
+
+	for _, format := range []BundleFormat{BundleFormatYAML, BundleFormatJSON} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteEtcdBundle(&buf, bundle, format))
+
+		decoded, err := ReadEtcdBundle(&buf)
+		require.NoError(t, err, format)
+		assert.Equal(t, bundle.Entries, decoded.Entries)
+		assert.Equal(t, bundle.Metadata.Checksum, decoded.Metadata.Checksum)
+	}
+
+	target := setupEtcdClient(t)
+	_, err = target.Put(ctx, "/microservices/query_service", `{"image":"old"}`)
+	require.NoError(t, err)
+
+	_, err = ImportEtcd(target, bundle, ImportConflictMode(ConflictFail))
+	assert.ErrorIs(t, err, ErrImportConflict)
+
+	report, err := ImportEtcd(target, bundle, ImportDryRun())
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Count(ImportCreate))
+	assert.Equal(t, 1, report.Count(ImportUpdate))
+	assert.Contains(t, report.String(), `- {"image":"old"}`)
+
+	report, err = ImportEtcd(target, bundle, ImportConflictMode(ConflictSkip))
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Count(ImportSkip))
+	value, err := GetValueFromEtcd(target, "/microservices/query_service")
+	require.NoError(t, err)
+	assert.Equal(t, `{"image":"old"}`, value)
+
+	_, err = ImportEtcd(target, bundle)
+	require.NoError(t, err)
+	value, err = GetValueFromEtcd(target, "/microservices/query_service")
+	require.NoError(t, err)
+	assert.Equal(t, `{"image":"query_service"}`, value)
+}
+
+func TestEtcdBundleVerify(t *testing.T) {
+	cli := setupEtcdClient(t)
+	_, err := cli.Put(context.Background(), "/microservices/a", "a")
+	require.NoError(t, err)
+
+	bundle, err := ExportEtcd(cli, []string{"/microservices"}, "")
+	require.NoError(t, err)
+	require.NoError(t, bundle.Verify())
+
+	bundle.Entries[0].Value = "tampered"
+	assert.Error(t, bundle.Verify())
+}
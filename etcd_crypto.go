@@ -0,0 +1,373 @@
+package GoLib
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Values encrypted by a Keyring are stored as
+//
+//	enc:v1:<key id>:<base64 wrapped data key>:<base64 nonce+ciphertext>
+//
+// Every value gets its own random AES-256 data key, which is in turn encrypted (wrapped)
+// with the key identified by the key id. Only the key id and the wrapped data key are stored,
+// so rotating the key only requires adding a new key to the front of the key file.
+const encryptedPrefix = "enc:v1:"
+
+// ErrNoKeyring is returned when reading an encrypted value without a Keyring configured.
+var ErrNoKeyring = errors.New("value is encrypted but no keyring is configured")
+
+// Keyring holds the AES-256 keys used to encrypt values stored in etcd.
+// Fields tagged with `encrypt:"true"` are encrypted individually. Types without any tagged
+// field are encrypted as a whole.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a Keyring from 32 byte keys, new values are encrypted with primaryID.
+func NewKeyring(primaryID string, keys map[string][]byte) (*Keyring, error) {
+	keyring := &Keyring{primary: primaryID, keys: make(map[string]cipher.AEAD)}
+
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes, got %d", id, len(key))
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring.keys[id] = aead
+	}
+
+	if _, ok := keyring.keys[primaryID]; !ok {
+		return nil, fmt.Errorf("primary key %s not found in keyring", primaryID)
+	}
+	return keyring, nil
+}
+
+// LoadKeyring reads a key file, typically a Docker secret, with one "<key id>:<base64 key>"
+// per line. The first key is used for encryption, the others are only used to decrypt values
+// written before the key was rotated.
+func LoadKeyring(fileName string) (*Keyring, error) {
+	content, err := ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	primary := ""
+	keys := make(map[string][]byte)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, encoded, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid line in key file %s, expected <key id>:<base64 key>", fileName)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %s: %w", id, err)
+		}
+
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+
+	if primary == "" {
+		return nil, fmt.Errorf("no keys found in key file %s", fileName)
+	}
+	return NewKeyring(primary, keys)
+}
+
+// LoadKeyringFromEnv loads the key file named by ETCD_ENCRYPTION_KEY_FILE, or returns nil
+// when encryption is not configured.
+func LoadKeyringFromEnv() (*Keyring, error) {
+	keyFile := os.Getenv("ETCD_ENCRYPTION_KEY_FILE")
+	if keyFile == "" {
+		return nil, nil
+	}
+	return LoadKeyring(keyFile)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext with a fresh data key and returns the envelope string.
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataAEAD, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + k.primary + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens an envelope created by Encrypt with any of the keys in the keyring.
+func (k *Keyring) Decrypt(envelope string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(envelope, encryptedPrefix), ":")
+	if !IsEncrypted(envelope) || len(parts) != 3 {
+		return nil, errors.New("malformed encrypted value")
+	}
+
+	keyAEAD, ok := k.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key id %s", parts[0])
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := open(keyAEAD, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(dataAEAD, sealed)
+}
+
+// IsEncrypted reports whether value is an envelope created by a Keyring.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// EncryptFields encrypts, in place, all string values of fields tagged with `encrypt:"true"`.
+// target must be a pointer. Tagged maps and slices have their string values encrypted.
+func (k *Keyring) EncryptFields(target any) error {
+	return transformFields(reflect.ValueOf(target), false, func(value string) (string, error) {
+		if value == "" || IsEncrypted(value) {
+			return value, nil
+		}
+		return k.Encrypt([]byte(value))
+	})
+}
+
+// DecryptFields is the inverse of EncryptFields, plaintext values are left untouched.
+func (k *Keyring) DecryptFields(target any) error {
+	return transformFields(reflect.ValueOf(target), false, func(value string) (string, error) {
+		if !IsEncrypted(value) {
+			return value, nil
+		}
+		plaintext, err := k.Decrypt(value)
+		return string(plaintext), err
+	})
+}
+
+func transformFields(v reflect.Value, tagged bool, transform func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return transformFields(v.Elem(), tagged, transform)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if err := transformFields(v.Field(i), tagged || field.Tag.Get("encrypt") == "true", transform); err != nil {
+				return fmt.Errorf("%s: %w", field.Name, err)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := transformFields(v.Index(i), tagged, transform); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			// Map values are not addressable, transform a copy and write it back
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			if err := transformFields(value, tagged, transform); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.String:
+		if !tagged || !v.CanSet() {
+			return nil
+		}
+		transformed, err := transform(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(transformed)
+	}
+
+	return nil
+}
+
+// hasEncryptedFields reports whether t, or any type nested in it, has a field tagged with `encrypt:"true"`.
+func hasEncryptedFields(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return hasEncryptedFields(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.IsExported() && (field.Tag.Get("encrypt") == "true" || hasEncryptedFields(field.Type, visited)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encryptJSON marshals target and encrypts either its tagged fields or, if it has none, the whole document.
+// target itself is never modified.
+func (k *Keyring) encryptJSON(target any) ([]byte, error) {
+	jsonRep, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+
+	t := reflect.TypeOf(target)
+	if t == nil || !hasEncryptedFields(t, map[reflect.Type]bool{}) {
+		envelope, err := k.Encrypt(jsonRep)
+		return []byte(envelope), err
+	}
+
+	// Work on a copy so the caller keeps its plaintext values
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	copied := reflect.New(t)
+	if err := json.Unmarshal(jsonRep, copied.Interface()); err != nil {
+		return nil, err
+	}
+	if err := k.EncryptFields(copied.Interface()); err != nil {
+		return nil, err
+	}
+	return json.Marshal(copied.Interface())
+}
+
+// decryptJSON unmarshals a value written by encryptJSON into target. keyring may be nil
+// as long as the value does not contain encrypted data.
+func decryptJSON(keyring *Keyring, data []byte, target any) error {
+	if IsEncrypted(string(data)) {
+		if keyring == nil {
+			return ErrNoKeyring
+		}
+		plaintext, err := keyring.Decrypt(string(data))
+		if err != nil {
+			return err
+		}
+		data = plaintext
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return err
+	}
+
+	if keyring == nil {
+		if bytes.Contains(data, []byte(encryptedPrefix)) && hasEncryptedFields(reflect.TypeOf(target), map[reflect.Type]bool{}) {
+			return ErrNoKeyring
+		}
+		return nil
+	}
+	return keyring.DecryptFields(target)
+}
+
+type etcdOptions struct {
+	keyring   *Keyring
+	stackOpts []StackOption
+}
+
+type EtcdOption func(*etcdOptions)
+
+// WithEncryption encrypts values before they are written to etcd and decrypts them when read.
+// A nil keyring disables encryption, so the result of LoadKeyringFromEnv can be passed as is.
+func WithEncryption(keyring *Keyring) EtcdOption {
+	return func(options *etcdOptions) {
+		options.keyring = keyring
+	}
+}
+
+func applyEtcdOptions(opts []EtcdOption) etcdOptions {
+	options := etcdOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+func marshalForEtcd(target any, options etcdOptions) ([]byte, error) {
+	if options.keyring == nil {
+		return json.Marshal(target)
+	}
+	return options.keyring.encryptJSON(target)
+}
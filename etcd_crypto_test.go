@@ -0,0 +1,85 @@
+package GoLib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupKeyring(t *testing.T, lines ...string) *Keyring {
+	keyFile := filepath.Join(t.TempDir(), "etcd_encryption_key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(strings.Join(lines, "\n")), 0600))
+
+	keyring, err := LoadKeyring(keyFile)
+	require.NoError(t, err)
+	return keyring
+}
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestSaveStructToEtcdEncryptsTaggedFields(t *testing.T) {
+	cli := setupEtcdClient(t)
+	keyring := setupKeyring(t, "2023-05:"+testKey(1))
+
+	details := MicroServiceDetails{
+		Image:   "query_service",
+		EnvVars: map[string]string{"DB_PASSWORD": "secret"},
+	}
+	require.NoError(t, SaveStructToEtcd(cli, "/microservices/query_service", details, WithEncryption(keyring)))
+	assert.Equal(t, "secret", details.EnvVars["DB_PASSWORD"], "the caller's struct must not be modified")
+
+	stored, err := GetValueFromEtcd(cli, "/microservices/query_service")
+	require.NoError(t, err)
+	assert.NotContains(t, stored, "secret")
+	assert.Contains(t, stored, `"Image":"query_service"`)
+
+	var decrypted MicroServiceDetails
+	_, err = GetAndUnmarshalJSON(cli, "/microservices/query_service", &decrypted, WithEncryption(keyring))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", decrypted.EnvVars["DB_PASSWORD"])
+
+	var encrypted MicroServiceDetails
+	_, err = GetAndUnmarshalJSON(cli, "/microservices/query_service", &encrypted)
+	assert.ErrorIs(t, err, ErrNoKeyring)
+}
+
+func TestSaveStructToEtcdEncryptsUntaggedStructs(t *testing.T) {
+	cli := setupEtcdClient(t)
+	keyring := setupKeyring(t, "old:"+testKey(1))
+
+	requestor := Requestor{Name: "jorrit", AllowedPartners: []string{"VU"}}
+	require.NoError(t, SaveStructToEtcd(cli, "/requestors/jorrit", requestor, WithEncryption(keyring)))
+
+	stored, err := GetValueFromEtcd(cli, "/requestors/jorrit")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(stored))
+
+	// After rotating, values written with the old key remain readable
+	rotated := setupKeyring(t, "new:"+testKey(2), "old:"+testKey(1))
+	result, err := GetAndUnmarshalJSONMap[Requestor](cli, "/requestors/", WithEncryption(rotated))
+	require.NoError(t, err)
+	assert.Equal(t, requestor, result["jorrit"])
+
+	_, err = GetAndUnmarshalJSONMap[Requestor](cli, "/requestors/", WithEncryption(setupKeyring(t, "new:"+testKey(2))))
+	assert.Error(t, err)
+}
+
+func TestRepositoryEncryption(t *testing.T) {
+	keyring := setupKeyring(t, "k1:"+testKey(3))
+	repo := NewRepository[*AgentDetails](setupEtcdClient(t), "/agents", RepositoryEncryption(keyring))
+
+	agent := &AgentDetails{Name: "agent1", AgentDetails: MicroServiceDetails{EnvVars: map[string]string{"AMQ_USER": "normal_user"}}}
+	require.NoError(t, repo.Create(agent))
+
+	got, err := repo.Get("agent1")
+	require.NoError(t, err)
+	assert.Equal(t, "normal_user", got.AgentDetails.EnvVars["AMQ_USER"])
+}
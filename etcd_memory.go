@@ -0,0 +1,959 @@
+package GoLib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+var _ EtcdClient = (*MemoryEtcdClient)(nil)
+
+// MemoryEtcdClient is an in-memory implementation of EtcdClient, meant for hermetic tests.
+// It keeps a revision history (so WithRev reads and watches work), supports range and prefix
+// queries, transactions, leases that expire after their TTL and watch events.
+type MemoryEtcdClient struct {
+	mu          sync.Mutex
+	revision    int64
+	compacted   int64
+	base        map[string]*mvccpb.KeyValue // state at the compacted revision
+	kvs         map[string]*mvccpb.KeyValue
+	history     []*clientv3.Event
+	leases      map[clientv3.LeaseID]*memoryLease
+	nextLeaseID clientv3.LeaseID
+	watchers    map[*memoryWatcher]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+type memoryLease struct {
+	ttl     int64
+	granted int64
+	expires time.Time
+	keys    map[string]struct{}
+	timer   *time.Timer
+}
+
+type memoryWatcher struct {
+	key, end     []byte
+	prevKV       bool
+	filterPut    bool
+	filterDelete bool
+
+	mu      sync.Mutex
+	queue   []clientv3.WatchResponse
+	notify  chan struct{}
+	stopped chan struct{}
+}
+
+func NewMemoryEtcdClient() *MemoryEtcdClient {
+	return &MemoryEtcdClient{
+		base:     make(map[string]*mvccpb.KeyValue),
+		kvs:      make(map[string]*mvccpb.KeyValue),
+		leases:   make(map[clientv3.LeaseID]*memoryLease),
+		watchers: make(map[*memoryWatcher]struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Close stops all lease timers and closes every open watch channel.
+func (m *MemoryEtcdClient) Close() error {
+	m.closeOnce.Do(func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		close(m.done)
+		for _, lease := range m.leases {
+			lease.timer.Stop()
+		}
+		for w := range m.watchers {
+			w.stop()
+		}
+		m.watchers = map[*memoryWatcher]struct{}{}
+	})
+	return nil
+}
+
+func (m *MemoryEtcdClient) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	resp, err := m.Do(ctx, clientv3.OpPut(key, val, opts...))
+	return resp.Put(), err
+}
+
+func (m *MemoryEtcdClient) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp, err := m.Do(ctx, clientv3.OpGet(key, opts...))
+	return resp.Get(), err
+}
+
+func (m *MemoryEtcdClient) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	resp, err := m.Do(ctx, clientv3.OpDelete(key, opts...))
+	return resp.Del(), err
+}
+
+// Compact drops the history before rev, later reads and watches on older revisions fail with ErrCompacted.
+func (m *MemoryEtcdClient) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rev <= m.compacted {
+		return nil, rpctypes.ErrCompacted
+	}
+	if rev > m.revision {
+		return nil, rpctypes.ErrFutureRev
+	}
+
+	i := 0
+	for ; i < len(m.history) && m.history[i].Kv.ModRevision < rev; i++ {
+		applyEvent(m.base, m.history[i])
+	}
+	m.history = m.history[i:]
+	m.compacted = rev
+
+	return &clientv3.CompactResponse{Header: m.header()}, nil
+}
+
+func (m *MemoryEtcdClient) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return clientv3.OpResponse{}, err
+	}
+
+	request, err := opRequest(op)
+	if err != nil {
+		return clientv3.OpResponse{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := request.Request.(*pb.RequestOp_RequestRange); ok {
+		resp, err := m.rangeOp(r.RequestRange)
+		if err != nil {
+			return clientv3.OpResponse{}, err
+		}
+		return resp.OpResponse(), nil
+	}
+
+	// All writes of a single request share one revision, a failing request is rolled back entirely.
+	rev := m.revision + 1
+	snapshot := m.snapshot()
+	var events []*clientv3.Event
+	var result clientv3.OpResponse
+
+	switch r := request.Request.(type) {
+	case *pb.RequestOp_RequestPut:
+		resp, event, err := m.putOp(r.RequestPut, rev)
+		if err != nil {
+			return clientv3.OpResponse{}, err
+		}
+		events, result = []*clientv3.Event{event}, resp.OpResponse()
+	case *pb.RequestOp_RequestDeleteRange:
+		resp, deleted := m.deleteOp(r.RequestDeleteRange, rev)
+		events, result = deleted, resp.OpResponse()
+	case *pb.RequestOp_RequestTxn:
+		resp, written, err := m.txnOp(r.RequestTxn, rev)
+		if err != nil {
+			m.restore(snapshot)
+			return clientv3.OpResponse{}, err
+		}
+		events, result = written, resp.OpResponse()
+	}
+
+	m.commit(rev, events)
+	return result, nil
+}
+
+func (m *MemoryEtcdClient) Txn(ctx context.Context) clientv3.Txn {
+	return &memoryTxn{ctx: ctx, client: m}
+}
+
+type memoryTxn struct {
+	ctx     context.Context
+	client  *MemoryEtcdClient
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+}
+
+func (t *memoryTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *memoryTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thenOps = append(t.thenOps, ops...)
+	return t
+}
+
+func (t *memoryTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elseOps = append(t.elseOps, ops...)
+	return t
+}
+
+func (t *memoryTxn) Commit() (*clientv3.TxnResponse, error) {
+	resp, err := t.client.Do(t.ctx, clientv3.OpTxn(t.cmps, t.thenOps, t.elseOps))
+	return resp.Txn(), err
+}
+
+func (m *MemoryEtcdClient) rangeOp(req *pb.RangeRequest) (*clientv3.GetResponse, error) {
+	state := m.kvs
+	if rev := req.Revision; rev > 0 {
+		if rev < m.compacted {
+			return nil, rpctypes.ErrCompacted
+		}
+		if rev > m.revision {
+			return nil, rpctypes.ErrFutureRev
+		}
+		state = m.stateAt(rev)
+	}
+
+	kvs := []*mvccpb.KeyValue{}
+	for key, kv := range state {
+		if !inRange([]byte(key), req.Key, req.RangeEnd) {
+			continue
+		}
+		if (req.MinModRevision > 0 && kv.ModRevision < req.MinModRevision) ||
+			(req.MaxModRevision > 0 && kv.ModRevision > req.MaxModRevision) ||
+			(req.MinCreateRevision > 0 && kv.CreateRevision < req.MinCreateRevision) ||
+			(req.MaxCreateRevision > 0 && kv.CreateRevision > req.MaxCreateRevision) {
+			continue
+		}
+		kvs = append(kvs, copyKeyValue(kv))
+	}
+	sortKeyValues(kvs, req.SortTarget, req.SortOrder)
+
+	resp := &clientv3.GetResponse{Header: m.header(), Count: int64(len(kvs))}
+	if req.CountOnly {
+		return resp, nil
+	}
+
+	if limit := req.Limit; limit > 0 && int64(len(kvs)) > limit {
+		kvs = kvs[:limit]
+		resp.More = true
+	}
+	if req.KeysOnly {
+		for _, kv := range kvs {
+			kv.Value = nil
+		}
+	}
+	resp.Kvs = kvs
+
+	return resp, nil
+}
+
+func (m *MemoryEtcdClient) putOp(req *pb.PutRequest, rev int64) (*clientv3.PutResponse, *clientv3.Event, error) {
+	key := string(req.Key)
+	prev := m.kvs[key]
+
+	value := req.Value
+	if req.IgnoreValue {
+		if prev == nil {
+			return nil, nil, rpctypes.ErrKeyNotFound
+		}
+		value = prev.Value
+	}
+
+	leaseID := clientv3.LeaseID(req.Lease)
+	if req.IgnoreLease {
+		if prev == nil {
+			return nil, nil, rpctypes.ErrKeyNotFound
+		}
+		leaseID = clientv3.LeaseID(prev.Lease)
+	}
+	if _, ok := m.leases[leaseID]; leaseID != clientv3.NoLease && !ok {
+		return nil, nil, rpctypes.ErrLeaseNotFound
+	}
+
+	kv := &mvccpb.KeyValue{
+		Key:            []byte(key),
+		Value:          append([]byte(nil), value...),
+		CreateRevision: rev,
+		ModRevision:    rev,
+		Version:        1,
+		Lease:          int64(leaseID),
+	}
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+		m.detachLease(prev)
+	}
+	if lease, ok := m.leases[leaseID]; ok {
+		lease.keys[key] = struct{}{}
+	}
+	m.kvs[key] = kv
+
+	resp := &clientv3.PutResponse{Header: m.pendingHeader(rev)}
+	if prev != nil && req.PrevKv {
+		resp.PrevKv = copyKeyValue(prev)
+	}
+
+	return resp, &clientv3.Event{Type: clientv3.EventTypePut, Kv: copyKeyValue(kv), PrevKv: copyKeyValue(prev)}, nil
+}
+
+func (m *MemoryEtcdClient) deleteOp(req *pb.DeleteRangeRequest, rev int64) (*clientv3.DeleteResponse, []*clientv3.Event) {
+	keys := []string{}
+	for key := range m.kvs {
+		if inRange([]byte(key), req.Key, req.RangeEnd) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	resp := &clientv3.DeleteResponse{Header: m.pendingHeader(rev), Deleted: int64(len(keys))}
+	events := []*clientv3.Event{}
+	for _, key := range keys {
+		prev := m.kvs[key]
+		if req.PrevKv {
+			resp.PrevKvs = append(resp.PrevKvs, copyKeyValue(prev))
+		}
+		events = append(events, m.deleteKey(key, rev))
+	}
+
+	return resp, events
+}
+
+func (m *MemoryEtcdClient) txnOp(req *pb.TxnRequest, rev int64) (*clientv3.TxnResponse, []*clientv3.Event, error) {
+	succeeded := true
+	for _, cmp := range req.Compare {
+		if !m.compare(cmp) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := req.Success
+	if !succeeded {
+		ops = req.Failure
+	}
+
+	resp := &clientv3.TxnResponse{Header: m.pendingHeader(rev), Succeeded: succeeded}
+	events := []*clientv3.Event{}
+	for _, nested := range ops {
+		switch request := nested.Request.(type) {
+		case *pb.RequestOp_RequestRange:
+			r, err := m.rangeOp(request.RequestRange)
+			if err != nil {
+				return nil, nil, err
+			}
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{ResponseRange: (*pb.RangeResponse)(r)}})
+		case *pb.RequestOp_RequestPut:
+			r, event, err := m.putOp(request.RequestPut, rev)
+			if err != nil {
+				return nil, nil, err
+			}
+			events = append(events, event)
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: (*pb.PutResponse)(r)}})
+		case *pb.RequestOp_RequestDeleteRange:
+			r, deleted := m.deleteOp(request.RequestDeleteRange, rev)
+			events = append(events, deleted...)
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: (*pb.DeleteRangeResponse)(r)}})
+		case *pb.RequestOp_RequestTxn:
+			r, written, err := m.txnOp(request.RequestTxn, rev)
+			if err != nil {
+				return nil, nil, err
+			}
+			events = append(events, written...)
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseTxn{ResponseTxn: (*pb.TxnResponse)(r)}})
+		}
+	}
+
+	return resp, events, nil
+}
+
+// compare evaluates a single transaction condition, a range condition must hold for every key in the range.
+func (m *MemoryEtcdClient) compare(cmp *pb.Compare) bool {
+	var kvs []*mvccpb.KeyValue
+	if len(cmp.RangeEnd) == 0 {
+		kv, ok := m.kvs[string(cmp.Key)]
+		if !ok {
+			// Missing keys compare as zero, but never match a value comparison
+			if cmp.Target == pb.Compare_VALUE {
+				return false
+			}
+			kv = &mvccpb.KeyValue{Key: cmp.Key}
+		}
+		kvs = append(kvs, kv)
+	} else {
+		for key, kv := range m.kvs {
+			if inRange([]byte(key), cmp.Key, cmp.RangeEnd) {
+				kvs = append(kvs, kv)
+			}
+		}
+	}
+
+	for _, kv := range kvs {
+		var result int
+		switch target := cmp.TargetUnion.(type) {
+		case *pb.Compare_Version:
+			result = compareInt64(kv.Version, target.Version)
+		case *pb.Compare_CreateRevision:
+			result = compareInt64(kv.CreateRevision, target.CreateRevision)
+		case *pb.Compare_ModRevision:
+			result = compareInt64(kv.ModRevision, target.ModRevision)
+		case *pb.Compare_Lease:
+			result = compareInt64(kv.Lease, target.Lease)
+		case *pb.Compare_Value:
+			result = bytes.Compare(kv.Value, target.Value)
+		}
+
+		var ok bool
+		switch cmp.Result {
+		case pb.Compare_EQUAL:
+			ok = result == 0
+		case pb.Compare_NOT_EQUAL:
+			ok = result != 0
+		case pb.Compare_GREATER:
+			ok = result > 0
+		case pb.Compare_LESS:
+			ok = result < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *MemoryEtcdClient) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextLeaseID++
+	id := m.nextLeaseID
+	lease := &memoryLease{
+		ttl:     ttl,
+		granted: ttl,
+		expires: time.Now().Add(time.Duration(ttl) * time.Second),
+		keys:    make(map[string]struct{}),
+	}
+	lease.timer = time.AfterFunc(time.Duration(ttl)*time.Second, func() { m.expire(id) })
+	m.leases[id] = lease
+
+	return &clientv3.LeaseGrantResponse{ResponseHeader: m.header(), ID: id, TTL: ttl}, nil
+}
+
+func (m *MemoryEtcdClient) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.leases[id]; !ok {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	m.revoke(id)
+
+	return &clientv3.LeaseRevokeResponse{Header: m.header()}, nil
+}
+
+func (m *MemoryEtcdClient) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resp := &clientv3.LeaseTimeToLiveResponse{ResponseHeader: m.header(), ID: id, TTL: -1}
+	lease, ok := m.leases[id]
+	if !ok {
+		return resp, nil
+	}
+
+	resp.TTL = int64(time.Until(lease.expires).Seconds())
+	resp.GrantedTTL = lease.granted
+
+	leaseOp := &clientv3.LeaseOp{}
+	for _, opt := range opts {
+		opt(leaseOp)
+	}
+	attachedKeys, err := structField(reflect.ValueOf(leaseOp).Elem(), "attachedKeys", reflect.Bool)
+	if err != nil {
+		return nil, err
+	}
+	if attachedKeys.Bool() {
+		for key := range lease.keys {
+			resp.Keys = append(resp.Keys, []byte(key))
+		}
+		sort.Slice(resp.Keys, func(i, j int) bool { return bytes.Compare(resp.Keys[i], resp.Keys[j]) < 0 })
+	}
+
+	return resp, nil
+}
+
+func (m *MemoryEtcdClient) Leases(ctx context.Context) (*clientv3.LeaseLeasesResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resp := &clientv3.LeaseLeasesResponse{ResponseHeader: m.header()}
+	for id := range m.leases {
+		resp.Leases = append(resp.Leases, clientv3.LeaseStatus{ID: id})
+	}
+	sort.Slice(resp.Leases, func(i, j int) bool { return resp.Leases[i].ID < resp.Leases[j].ID })
+
+	return resp, nil
+}
+
+// KeepAlive refreshes the lease every third of its TTL until ctx is done or the lease is gone.
+func (m *MemoryEtcdClient) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	first, err := m.KeepAliveOnce(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(chan *clientv3.LeaseKeepAliveResponse, 16)
+	responses <- first
+
+	go func() {
+		defer close(responses)
+
+		interval := time.Duration(first.TTL) * time.Second / 3
+		if interval <= 0 {
+			interval = 100 * time.Millisecond
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.done:
+				return
+			case <-ticker.C:
+				resp, err := m.KeepAliveOnce(ctx, id)
+				if err != nil {
+					return
+				}
+				select {
+				case responses <- resp:
+				default:
+					// Like the real client, drop responses nobody is reading
+				}
+			}
+		}
+	}()
+
+	return responses, nil
+}
+
+func (m *MemoryEtcdClient) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease, ok := m.leases[id]
+	if !ok {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	lease.expires = time.Now().Add(time.Duration(lease.ttl) * time.Second)
+	lease.timer.Reset(time.Duration(lease.ttl) * time.Second)
+
+	return &clientv3.LeaseKeepAliveResponse{ResponseHeader: m.header(), ID: id, TTL: lease.ttl}, nil
+}
+
+func (m *MemoryEtcdClient) expire(id clientv3.LeaseID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The timer may fire right before a concurrent keepalive reset it
+	if lease, ok := m.leases[id]; ok && !time.Now().Before(lease.expires) {
+		m.revoke(id)
+	}
+}
+
+// revoke removes the lease and deletes all keys attached to it in a single revision.
+func (m *MemoryEtcdClient) revoke(id clientv3.LeaseID) {
+	lease := m.leases[id]
+	lease.timer.Stop()
+	delete(m.leases, id)
+
+	keys := []string{}
+	for key := range lease.keys {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	rev := m.revision + 1
+	events := []*clientv3.Event{}
+	for _, key := range keys {
+		events = append(events, m.deleteKey(key, rev))
+	}
+	m.commit(rev, events)
+}
+
+func (m *MemoryEtcdClient) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	op := clientv3.OpGet(key, opts...)
+	responses := make(chan clientv3.WatchResponse)
+
+	options, err := watchOptions(op)
+	w := &memoryWatcher{
+		key:          op.KeyBytes(),
+		end:          op.RangeBytes(),
+		prevKV:       options["prevKV"],
+		filterPut:    options["filterPut"],
+		filterDelete: options["filterDelete"],
+		notify:       make(chan struct{}, 1),
+		stopped:      make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	select {
+	case <-m.done:
+		m.mu.Unlock()
+		close(responses)
+		return responses
+	default:
+	}
+
+	if err != nil {
+		// Like a watch the server refuses, send a single canceled response and close the channel
+		log.Errorf("Failed to read the watch options of %s: %v", key, err)
+		w.enqueue(clientv3.WatchResponse{Header: *m.header(), Canceled: true})
+		w.stop()
+	} else if rev := op.Rev(); rev > 0 && rev < m.compacted {
+		w.enqueue(clientv3.WatchResponse{Header: *m.header(), Canceled: true, CompactRevision: m.compacted})
+		w.stop()
+	} else {
+		if options["createdNotify"] {
+			w.enqueue(clientv3.WatchResponse{Header: *m.header(), Created: true})
+		}
+		if rev > 0 {
+			replay := []*clientv3.Event{}
+			for _, event := range m.history {
+				if event.Kv.ModRevision >= rev {
+					replay = append(replay, event)
+				}
+			}
+			w.send(m.revision, replay)
+		}
+		m.watchers[w] = struct{}{}
+	}
+	m.mu.Unlock()
+
+	go func() {
+		defer close(responses)
+		defer func() {
+			m.mu.Lock()
+			delete(m.watchers, w)
+			m.mu.Unlock()
+		}()
+
+		for {
+			w.mu.Lock()
+			pending := w.queue
+			w.queue = nil
+			w.mu.Unlock()
+
+			for _, resp := range pending {
+				select {
+				case responses <- resp:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-w.notify:
+			case <-w.stopped:
+				w.mu.Lock()
+				drained := len(w.queue) == 0
+				w.mu.Unlock()
+				if drained {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return responses
+}
+
+// RequestProgress sends an empty response with the current revision to all watchers.
+func (m *MemoryEtcdClient) RequestProgress(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for w := range m.watchers {
+		w.enqueue(clientv3.WatchResponse{Header: *m.header()})
+	}
+	return nil
+}
+
+func (w *memoryWatcher) send(revision int64, events []*clientv3.Event) {
+	matched := []*clientv3.Event{}
+	for _, event := range events {
+		if !inRange(event.Kv.Key, w.key, w.end) ||
+			(w.filterPut && event.Type == clientv3.EventTypePut) ||
+			(w.filterDelete && event.Type == clientv3.EventTypeDelete) {
+			continue
+		}
+		copied := &clientv3.Event{Type: event.Type, Kv: copyKeyValue(event.Kv)}
+		if w.prevKV {
+			copied.PrevKv = copyKeyValue(event.PrevKv)
+		}
+		matched = append(matched, copied)
+	}
+
+	if len(matched) > 0 {
+		w.enqueue(clientv3.WatchResponse{Header: pb.ResponseHeader{Revision: revision}, Events: matched})
+	}
+}
+
+func (w *memoryWatcher) enqueue(resp clientv3.WatchResponse) {
+	w.mu.Lock()
+	w.queue = append(w.queue, resp)
+	w.mu.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) stop() {
+	close(w.stopped)
+}
+
+func (m *MemoryEtcdClient) deleteKey(key string, rev int64) *clientv3.Event {
+	prev := m.kvs[key]
+	m.detachLease(prev)
+	delete(m.kvs, key)
+
+	return &clientv3.Event{
+		Type:   clientv3.EventTypeDelete,
+		Kv:     &mvccpb.KeyValue{Key: []byte(key), ModRevision: rev},
+		PrevKv: copyKeyValue(prev),
+	}
+}
+
+func (m *MemoryEtcdClient) detachLease(kv *mvccpb.KeyValue) {
+	if lease, ok := m.leases[clientv3.LeaseID(kv.Lease)]; ok {
+		delete(lease.keys, string(kv.Key))
+	}
+}
+
+// commit records the events of a write under rev and forwards them to the watchers.
+func (m *MemoryEtcdClient) commit(rev int64, events []*clientv3.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	m.revision = rev
+	m.history = append(m.history, events...)
+	for w := range m.watchers {
+		w.send(rev, events)
+	}
+}
+
+type memorySnapshot struct {
+	kvs    map[string]*mvccpb.KeyValue
+	leases map[clientv3.LeaseID]map[string]struct{}
+}
+
+func (m *MemoryEtcdClient) snapshot() memorySnapshot {
+	s := memorySnapshot{
+		kvs:    make(map[string]*mvccpb.KeyValue, len(m.kvs)),
+		leases: make(map[clientv3.LeaseID]map[string]struct{}, len(m.leases)),
+	}
+	for key, kv := range m.kvs {
+		s.kvs[key] = kv
+	}
+	for id, lease := range m.leases {
+		keys := make(map[string]struct{}, len(lease.keys))
+		for key := range lease.keys {
+			keys[key] = struct{}{}
+		}
+		s.leases[id] = keys
+	}
+	return s
+}
+
+func (m *MemoryEtcdClient) restore(s memorySnapshot) {
+	m.kvs = s.kvs
+	for id, keys := range s.leases {
+		m.leases[id].keys = keys
+	}
+}
+
+// stateAt rebuilds the key space as it was at revision rev.
+func (m *MemoryEtcdClient) stateAt(rev int64) map[string]*mvccpb.KeyValue {
+	state := make(map[string]*mvccpb.KeyValue, len(m.base))
+	for key, kv := range m.base {
+		state[key] = kv
+	}
+	for _, event := range m.history {
+		if event.Kv.ModRevision > rev {
+			break
+		}
+		applyEvent(state, event)
+	}
+	return state
+}
+
+func (m *MemoryEtcdClient) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: m.revision}
+}
+
+func (m *MemoryEtcdClient) pendingHeader(rev int64) *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: rev}
+}
+
+func applyEvent(state map[string]*mvccpb.KeyValue, event *clientv3.Event) {
+	if event.Type == clientv3.EventTypeDelete {
+		delete(state, string(event.Kv.Key))
+		return
+	}
+	state[string(event.Kv.Key)] = event.Kv
+}
+
+// inRange follows the etcd range semantics: an empty end matches key exactly,
+// an end of "\x00" matches every key from key onwards.
+func inRange(k, key, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return bytes.Equal(k, key)
+	case len(end) == 1 && end[0] == 0:
+		return bytes.Compare(k, key) >= 0
+	default:
+		return bytes.Compare(k, key) >= 0 && bytes.Compare(k, end) < 0
+	}
+}
+
+func sortKeyValues(kvs []*mvccpb.KeyValue, target pb.RangeRequest_SortTarget, order pb.RangeRequest_SortOrder) {
+	less := func(a, b *mvccpb.KeyValue) bool {
+		switch target {
+		case pb.RangeRequest_VERSION:
+			return a.Version < b.Version
+		case pb.RangeRequest_CREATE:
+			return a.CreateRevision < b.CreateRevision
+		case pb.RangeRequest_MOD:
+			return a.ModRevision < b.ModRevision
+		case pb.RangeRequest_VALUE:
+			return bytes.Compare(a.Value, b.Value) < 0
+		default:
+			return bytes.Compare(a.Key, b.Key) < 0
+		}
+	}
+
+	sort.SliceStable(kvs, func(i, j int) bool { return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0 })
+	if order == pb.RangeRequest_DESCEND {
+		sort.SliceStable(kvs, func(i, j int) bool { return less(kvs[j], kvs[i]) })
+	} else if order == pb.RangeRequest_ASCEND {
+		sort.SliceStable(kvs, func(i, j int) bool { return less(kvs[i], kvs[j]) })
+	}
+}
+
+func copyKeyValue(kv *mvccpb.KeyValue) *mvccpb.KeyValue {
+	if kv == nil {
+		return nil
+	}
+	copied := *kv
+	copied.Key = append([]byte(nil), kv.Key...)
+	copied.Value = append([]byte(nil), kv.Value...)
+	return &copied
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// opRequest converts op into the request the etcd client sends to the server, by running it
+// through a KV client of etcd itself. Unlike clientv3.Op, the request exposes every option,
+// like the limit of a get or the lease of a put.
+func opRequest(op clientv3.Op) (*pb.RequestOp, error) {
+	if !op.IsGet() && !op.IsPut() && !op.IsDelete() && !op.IsTxn() {
+		return nil, fmt.Errorf("unsupported etcd operation %v", op)
+	}
+
+	recorder := &requestRecorder{}
+	if _, err := clientv3.NewKVFromKVClient(recorder, nil).Do(context.Background(), op); err != nil {
+		return nil, err
+	}
+	return recorder.request, nil
+}
+
+// requestRecorder is a pb.KVClient that only remembers the last request it received.
+type requestRecorder struct {
+	request *pb.RequestOp
+}
+
+func (r *requestRecorder) Range(ctx context.Context, in *pb.RangeRequest, opts ...grpc.CallOption) (*pb.RangeResponse, error) {
+	r.request = &pb.RequestOp{Request: &pb.RequestOp_RequestRange{RequestRange: in}}
+	return &pb.RangeResponse{}, nil
+}
+
+func (r *requestRecorder) Put(ctx context.Context, in *pb.PutRequest, opts ...grpc.CallOption) (*pb.PutResponse, error) {
+	r.request = &pb.RequestOp{Request: &pb.RequestOp_RequestPut{RequestPut: in}}
+	return &pb.PutResponse{}, nil
+}
+
+func (r *requestRecorder) DeleteRange(ctx context.Context, in *pb.DeleteRangeRequest, opts ...grpc.CallOption) (*pb.DeleteRangeResponse, error) {
+	r.request = &pb.RequestOp{Request: &pb.RequestOp_RequestDeleteRange{RequestDeleteRange: in}}
+	return &pb.DeleteRangeResponse{}, nil
+}
+
+func (r *requestRecorder) Txn(ctx context.Context, in *pb.TxnRequest, opts ...grpc.CallOption) (*pb.TxnResponse, error) {
+	r.request = &pb.RequestOp{Request: &pb.RequestOp_RequestTxn{RequestTxn: in}}
+	return &pb.TxnResponse{}, nil
+}
+
+func (r *requestRecorder) Compact(ctx context.Context, in *pb.CompactionRequest, opts ...grpc.CallOption) (*pb.CompactionResponse, error) {
+	return nil, fmt.Errorf("compaction is not an operation")
+}
+
+// watchOptionFields are the options of a watch that etcd only keeps in unexported fields of clientv3.Op,
+// the watch request is built inside the gRPC stream of the client. They are read by reflection,
+// TestWatchOptions checks them against the etcd client in use.
+var watchOptionFields = []string{"prevKV", "filterPut", "filterDelete", "createdNotify"}
+
+func watchOptions(op clientv3.Op) (map[string]bool, error) {
+	options := make(map[string]bool, len(watchOptionFields))
+	for _, name := range watchOptionFields {
+		field, err := structField(reflect.ValueOf(op), name, reflect.Bool)
+		if err != nil {
+			return nil, err
+		}
+		options[name] = field.Bool()
+	}
+	return options, nil
+}
+
+// structField reads a field of a struct by name. It fails when the field does not exist or has
+// another kind, so a renamed field of a newer etcd client is not read as its zero value.
+func structField(value reflect.Value, name string, kind reflect.Kind) (reflect.Value, error) {
+	field := value.FieldByName(name)
+	if !field.IsValid() || field.Kind() != kind {
+		return reflect.Value{}, fmt.Errorf("%s has no %s field %s, the etcd client is not supported by the in-memory client", value.Type(), kind, name)
+	}
+	return field, nil
+}
@@ -0,0 +1,196 @@
+package GoLib
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestMemoryEtcdRevisions(t *testing.T) {
+	cli := setupEtcdClient(t)
+	ctx := context.Background()
+
+	first, err := cli.Put(ctx, "/microservices/a", "1")
+	require.NoError(t, err)
+	_, err = cli.Put(ctx, "/microservices/a", "2")
+	require.NoError(t, err)
+
+	resp, err := cli.Get(ctx, "/microservices/a")
+	require.NoError(t, err)
+	require.Len(t, resp.Kvs, 1)
+	assert.Equal(t, "2", string(resp.Kvs[0].Value))
+	assert.Equal(t, int64(2), resp.Kvs[0].Version)
+	assert.Equal(t, first.Header.Revision, resp.Kvs[0].CreateRevision)
+
+	old, err := cli.Get(ctx, "/microservices/a", clientv3.WithRev(first.Header.Revision))
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(old.Kvs[0].Value))
+
+	_, err = cli.Compact(ctx, resp.Header.Revision)
+	require.NoError(t, err)
+	_, err = cli.Get(ctx, "/microservices/a", clientv3.WithRev(first.Header.Revision))
+	assert.ErrorIs(t, err, rpctypes.ErrCompacted)
+}
+
+func TestMemoryEtcdPrefix(t *testing.T) {
+	cli := setupEtcdClient(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"/microservices/b", "/microservices/a", "/microservicesx", "/agents/a"} {
+		_, err := cli.Put(ctx, key, key)
+		require.NoError(t, err)
+	}
+
+	resp, err := cli.Get(ctx, "/microservices/", clientv3.WithPrefix())
+	require.NoError(t, err)
+	require.Len(t, resp.Kvs, 2)
+	assert.Equal(t, "/microservices/a", string(resp.Kvs[0].Key))
+	assert.Equal(t, "/microservices/b", string(resp.Kvs[1].Key))
+
+	count, err := cli.Get(ctx, "/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), count.Count)
+	assert.Empty(t, count.Kvs)
+
+	del, err := cli.Delete(ctx, "/microservices/", clientv3.WithPrefix())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), del.Deleted)
+}
+
+func TestMemoryEtcdTxn(t *testing.T) {
+	cli := setupEtcdClient(t)
+	ctx := context.Background()
+
+	create := func() bool {
+		resp, err := cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision("/lock"), "=", 0)).
+			Then(clientv3.OpPut("/lock", "owner")).
+			Else(clientv3.OpGet("/lock")).
+			Commit()
+		require.NoError(t, err)
+		return resp.Succeeded
+	}
+
+	assert.True(t, create())
+	assert.False(t, create())
+
+	_, err := cli.Txn(ctx).Then(clientv3.OpPut("/a", "1"), clientv3.OpPut("/b", "2", clientv3.WithLease(42))).Commit()
+	assert.ErrorIs(t, err, rpctypes.ErrLeaseNotFound)
+
+	resp, err := cli.Get(ctx, "/a")
+	require.NoError(t, err)
+	assert.Empty(t, resp.Kvs, "a failing transaction must not leave partial writes")
+}
+
+func TestMemoryEtcdLeaseExpiry(t *testing.T) {
+	cli := setupEtcdClient(t)
+	ctx := context.Background()
+
+	lease, err := cli.Grant(ctx, 1)
+	require.NoError(t, err)
+	_, err = cli.Put(ctx, "/agents/agent1", "alive", clientv3.WithLease(lease.ID))
+	require.NoError(t, err)
+
+	ttl, err := cli.TimeToLive(ctx, lease.ID, clientv3.WithAttachedKeys())
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("/agents/agent1")}, ttl.Keys)
+
+	require.Eventually(t, func() bool {
+		resp, err := cli.Get(ctx, "/agents/agent1")
+		return err == nil && len(resp.Kvs) == 0
+	}, 3*time.Second, 50*time.Millisecond)
+
+	_, err = cli.KeepAliveOnce(ctx, lease.ID)
+	assert.ErrorIs(t, err, rpctypes.ErrLeaseNotFound)
+}
+
+func TestMemoryEtcdWatch(t *testing.T) {
+	cli := setupEtcdClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	put, err := cli.Put(ctx, "/microservices/a", "1")
+	require.NoError(t, err)
+
+	watch := cli.Watch(ctx, "/microservices/", clientv3.WithPrefix(), clientv3.WithRev(put.Header.Revision), clientv3.WithPrevKV())
+	_, err = cli.Put(ctx, "/other", "ignored")
+	require.NoError(t, err)
+	_, err = cli.Delete(ctx, "/microservices/a")
+	require.NoError(t, err)
+
+	events := []*clientv3.Event{}
+	for len(events) < 2 {
+		select {
+		case resp := <-watch:
+			require.NoError(t, resp.Err())
+			events = append(events, resp.Events...)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for watch events")
+		}
+	}
+
+	assert.True(t, events[0].IsCreate())
+	assert.Equal(t, clientv3.EventTypeDelete, events[1].Type)
+	assert.Equal(t, "1", string(events[1].PrevKv.Value))
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, open := <-watch
+		return !open
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOpRequest(t *testing.T) {
+	get, err := opRequest(clientv3.OpGet("/a", clientv3.WithPrefix(), clientv3.WithLimit(3), clientv3.WithSort(clientv3.SortByValue, clientv3.SortDescend)))
+	require.NoError(t, err)
+	rangeRequest := get.GetRequestRange()
+	require.NotNil(t, rangeRequest)
+	assert.Equal(t, "/b", string(rangeRequest.RangeEnd))
+	assert.Equal(t, int64(3), rangeRequest.Limit)
+
+	kvs := []*mvccpb.KeyValue{{Key: []byte("/a"), Value: []byte("1")}, {Key: []byte("/b"), Value: []byte("2")}}
+	sortKeyValues(kvs, rangeRequest.SortTarget, rangeRequest.SortOrder)
+	assert.Equal(t, "/b", string(kvs[0].Key))
+
+	put, err := opRequest(clientv3.OpPut("/a", "1", clientv3.WithLease(7), clientv3.WithPrevKV(), clientv3.WithIgnoreValue()))
+	require.NoError(t, err)
+	putRequest := put.GetRequestPut()
+	require.NotNil(t, putRequest)
+	assert.Equal(t, int64(7), putRequest.Lease)
+	assert.True(t, putRequest.PrevKv)
+	assert.True(t, putRequest.IgnoreValue)
+
+	txn, err := opRequest(clientv3.OpTxn(nil, []clientv3.Op{clientv3.OpDelete("/a", clientv3.WithPrevKV())}, nil))
+	require.NoError(t, err)
+	require.Len(t, txn.GetRequestTxn().Success, 1)
+	assert.True(t, txn.GetRequestTxn().Success[0].GetRequestDeleteRange().PrevKv)
+
+	_, err = opRequest(clientv3.Op{})
+	assert.Error(t, err)
+}
+
+// TestWatchOptions fails when an etcd client upgrade renames an option that the in-memory client reads by reflection.
+func TestWatchOptions(t *testing.T) {
+	op := clientv3.OpGet("/a", clientv3.WithPrevKV(), clientv3.WithFilterPut(), clientv3.WithFilterDelete(), clientv3.WithCreatedNotify())
+	options, err := watchOptions(op)
+	require.NoError(t, err)
+	for _, name := range watchOptionFields {
+		assert.True(t, options[name], name)
+	}
+
+	leaseOp := &clientv3.LeaseOp{}
+	clientv3.WithAttachedKeys()(leaseOp)
+	attachedKeys, err := structField(reflect.ValueOf(leaseOp).Elem(), "attachedKeys", reflect.Bool)
+	require.NoError(t, err)
+	assert.True(t, attachedKeys.Bool())
+
+	_, err = structField(reflect.ValueOf(op), "renamed", reflect.Bool)
+	assert.ErrorContains(t, err, "has no bool field renamed")
+}
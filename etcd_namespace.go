@@ -0,0 +1,58 @@
+package GoLib
+
+import (
+	"os"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+)
+
+var _ EtcdClient = (*NamespacedEtcdClient)(nil)
+
+// NamespacedEtcdClient prefixes every key with a namespace, so several deployments can share one
+// etcd cluster. Keys in responses and watch events have the namespace stripped again, a
+// namespaced client for "staging" sees "/staging/microservices/x" as "/microservices/x".
+type NamespacedEtcdClient struct {
+	clientv3.KV
+	clientv3.Lease
+	clientv3.Watcher
+	client    EtcdClient
+	namespace string
+}
+
+// NewNamespacedEtcdClient wraps etcdClient, "staging", "/staging" and "/staging/" are all
+// stored under the "/staging" prefix.
+func NewNamespacedEtcdClient(etcdClient EtcdClient, ns string) *NamespacedEtcdClient {
+	prefix := "/" + strings.Trim(ns, "/")
+
+	return &NamespacedEtcdClient{
+		KV:        namespace.NewKV(etcdClient, prefix),
+		Lease:     namespace.NewLease(etcdClient, prefix),
+		Watcher:   namespace.NewWatcher(etcdClient, prefix),
+		client:    etcdClient,
+		namespace: prefix,
+	}
+}
+
+// NewNamespacedEtcdClientFromEnv namespaces etcdClient with the ETCD_NAMESPACE environment
+// variable, or returns it unchanged if the variable is not set.
+func NewNamespacedEtcdClientFromEnv(etcdClient EtcdClient) EtcdClient {
+	ns := strings.Trim(os.Getenv("ETCD_NAMESPACE"), "/")
+	if ns == "" {
+		return etcdClient
+	}
+
+	return NewNamespacedEtcdClient(etcdClient, ns)
+}
+
+// Namespace returns the prefix added to every key.
+func (n *NamespacedEtcdClient) Namespace() string {
+	return n.namespace
+}
+
+// Close stops the namespaced watchers and closes the underlying client.
+func (n *NamespacedEtcdClient) Close() error {
+	n.Watcher.Close()
+	return n.client.Close()
+}
@@ -0,0 +1,61 @@
+package GoLib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestNamespacedEtcdClient(t *testing.T) {
+	cli := setupEtcdClient(t)
+	staging := NewNamespacedEtcdClient(cli, "staging/")
+	production := NewNamespacedEtcdClient(cli, "/production")
+	assert.Equal(t, "/staging", staging.Namespace())
+
+	require.NoError(t, SaveStructToEtcd(staging, "/microservices/query_service", MicroServiceDetails{Tag: "dev"}))
+	require.NoError(t, SaveStructToEtcd(production, "/microservices/query_service", MicroServiceDetails{Tag: "1.0"}))
+
+	services, err := GetAndUnmarshalJSONMap[MicroServiceDetails](staging, "/microservices/")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]MicroServiceDetails{"query_service": {Tag: "dev"}}, services)
+
+	raw, err := cli.Get(context.Background(), "/", clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	require.NoError(t, err)
+	require.Len(t, raw.Kvs, 2)
+	assert.Equal(t, "/production/microservices/query_service", string(raw.Kvs[0].Key))
+	assert.Equal(t, "/staging/microservices/query_service", string(raw.Kvs[1].Key))
+}
+
+func TestNamespacedEtcdClientWatch(t *testing.T) {
+	staging := NewNamespacedEtcdClient(setupEtcdClient(t), "staging")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watch := staging.Watch(ctx, "/microservices/", clientv3.WithPrefix())
+	_, err := staging.Put(ctx, "/microservices/anonymize_service", "{}")
+	require.NoError(t, err)
+
+	select {
+	case resp := <-watch:
+		require.Len(t, resp.Events, 1)
+		assert.Equal(t, "/microservices/anonymize_service", string(resp.Events[0].Kv.Key))
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for watch event")
+	}
+}
+
+func TestNewNamespacedEtcdClientFromEnv(t *testing.T) {
+	cli := setupEtcdClient(t)
+
+	t.Setenv("ETCD_NAMESPACE", "")
+	assert.Equal(t, EtcdClient(cli), NewNamespacedEtcdClientFromEnv(cli))
+
+	t.Setenv("ETCD_NAMESPACE", "tenant1")
+	namespaced, ok := NewNamespacedEtcdClientFromEnv(cli).(*NamespacedEtcdClient)
+	require.True(t, ok)
+	assert.Equal(t, "/tenant1", namespaced.Namespace())
+}
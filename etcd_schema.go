@@ -0,0 +1,379 @@
+package GoLib
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is a JSON Schema generated from a Go type by GenerateJSONSchema. Marshal it to
+// publish the schema, or call Validate to check documents against it.
+type JSONSchema struct {
+	Schema     string                 `json:"$schema,omitempty"`
+	Title      string                 `json:"title,omitempty"`
+	Types      []string               `json:"-"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	// AdditionalProperties is false for structs, the schema of the values for maps
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema `json:"items,omitempty"`
+	Minimum              *float64    `json:"minimum,omitempty"`
+	MinLength            *int        `json:"minLength,omitempty"`
+}
+
+// MarshalJSON writes Types as "type", a single type as a string.
+func (s *JSONSchema) MarshalJSON() ([]byte, error) {
+	type schema JSONSchema
+	out := struct {
+		Type interface{} `json:"type,omitempty"`
+		*schema
+	}{schema: (*schema)(s)}
+
+	switch len(s.Types) {
+	case 0:
+	case 1:
+		out.Type = s.Types[0]
+	default:
+		out.Type = s.Types
+	}
+	return json.Marshal(out)
+}
+
+// SchemaViolation is a part of a document that does not match its schema. Pointer is the JSON
+// pointer (RFC 6901) of the value, "" for the whole document.
+type SchemaViolation struct {
+	Pointer string
+	Message string
+}
+
+func (v SchemaViolation) String() string {
+	if v.Pointer == "" {
+		return "(root): " + v.Message
+	}
+	return v.Pointer + ": " + v.Message
+}
+
+// SchemaValidationError holds every violation found in a document.
+type SchemaValidationError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaValidationError) Error() string {
+	lines := make([]string, 0, len(e.Violations)+1)
+	lines = append(lines, fmt.Sprintf("document does not match schema, %d violation(s):", len(e.Violations)))
+	for _, violation := range e.Violations {
+		lines = append(lines, "  "+violation.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// JSONSchemaFor generates the JSON Schema of T, see GenerateJSONSchema.
+func JSONSchemaFor[T any]() (*JSONSchema, error) {
+	return GenerateJSONSchema(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// GenerateJSONSchema generates the JSON Schema of the JSON encoding of a Go type. Properties are
+// named after the json tags of fields, unknown properties are not allowed. Fields tagged with
+// `jsonschema:"required"` must be present, with `jsonschema:"nonempty"` strings may not be empty.
+// Nil slices, maps and pointers are encoded as null, so they also allow null.
+func GenerateJSONSchema(t reflect.Type) (*JSONSchema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	generator := schemaGenerator{visiting: make(map[reflect.Type]bool)}
+	schema, err := generator.schema(t)
+	if err != nil {
+		return nil, err
+	}
+	schema.Schema = jsonSchemaDraft
+	schema.Title = t.Name()
+	return schema, nil
+}
+
+var schemaCache sync.Map
+
+// cachedJSONSchema returns the schema of a type, generated once. Callers may not change it.
+func cachedJSONSchema(t reflect.Type) (*JSONSchema, error) {
+	if schema, ok := schemaCache.Load(t); ok {
+		return schema.(*JSONSchema), nil
+	}
+	schema, err := GenerateJSONSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	schemaCache.Store(t, schema)
+	return schema, nil
+}
+
+// ValidateJSONFor checks a JSON document against the schema of T, for example before storing
+// a document received over HTTP. Violations are returned as a *SchemaValidationError.
+func ValidateJSONFor[T any](data []byte) error {
+	schema, err := cachedJSONSchema(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+	return schema.Validate(data)
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+type schemaGenerator struct {
+	visiting map[reflect.Type]bool
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) (*JSONSchema, error) {
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return &JSONSchema{Types: []string{"string"}}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(schema), nil
+
+	case reflect.Struct:
+		if g.visiting[t] {
+			return nil, fmt.Errorf("type %s is recursive", t)
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+
+		schema := &JSONSchema{Types: []string{"object"}, Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+		if err := g.addFields(schema, t); err != nil {
+			return nil, err
+		}
+		return schema, nil
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map %s does not have string keys", t)
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &JSONSchema{Types: []string{"object", "null"}, AdditionalProperties: values}, nil
+
+	case reflect.Slice, reflect.Array:
+		// Byte slices are encoded as base64 strings
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Types: []string{"string", "null"}}, nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		schema := &JSONSchema{Types: []string{"array"}, Items: items}
+		if t.Kind() == reflect.Slice {
+			schema = nullable(schema)
+		}
+		return schema, nil
+
+	case reflect.String:
+		return &JSONSchema{Types: []string{"string"}}, nil
+	case reflect.Bool:
+		return &JSONSchema{Types: []string{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &JSONSchema{Types: []string{"integer"}}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := 0.0
+		return &JSONSchema{Types: []string{"integer"}, Minimum: &minimum}, nil
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Types: []string{"number"}}, nil
+	case reflect.Interface:
+		return &JSONSchema{}, nil
+	default:
+		return nil, fmt.Errorf("type %s can not be described by a JSON schema", t)
+	}
+}
+
+// addFields adds the fields of a struct as properties, fields of embedded structs without a json name are added as well.
+func (g *schemaGenerator) addFields(schema *JSONSchema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if err := g.addFields(schema, fieldType); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := g.schema(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		for _, option := range strings.Split(field.Tag.Get("jsonschema"), ",") {
+			switch option {
+			case "required":
+				schema.Required = append(schema.Required, name)
+			case "nonempty":
+				minLength := 1
+				property.MinLength = &minLength
+			}
+		}
+		schema.Properties[name] = property
+	}
+	return nil
+}
+
+func nullable(schema *JSONSchema) *JSONSchema {
+	for _, schemaType := range schema.Types {
+		if schemaType == "null" {
+			return schema
+		}
+	}
+	if len(schema.Types) > 0 {
+		schema.Types = append(schema.Types, "null")
+	}
+	return schema
+}
+
+// Validate checks a JSON document against the schema and returns every violation as a
+// *SchemaValidationError. It can be passed to WithValidator.
+func (s *JSONSchema) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	violations := []SchemaViolation{}
+	s.validate(document, "", &violations)
+	if len(violations) > 0 {
+		return &SchemaValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validate(value interface{}, pointer string, violations *[]SchemaViolation) {
+	report := func(format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	valueType := jsonType(value)
+	if len(s.Types) > 0 && !s.allows(valueType) {
+		report("expected %s, got %s", strings.Join(s.Types, " or "), valueType)
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				report("missing required property %q", name)
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			child := pointer + "/" + escapeJSONPointer(name)
+			if property, ok := s.Properties[name]; ok {
+				property.validate(value[name], child, violations)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					*violations = append(*violations, SchemaViolation{Pointer: child, Message: fmt.Sprintf("unknown property %q", name)})
+				}
+			case *JSONSchema:
+				additional.validate(value[name], child, violations)
+			}
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				s.Items.validate(item, fmt.Sprintf("%s/%d", pointer, i), violations)
+			}
+		}
+
+	case string:
+		if s.MinLength != nil && utf8.RuneCountInString(value) < *s.MinLength {
+			report("must be at least %d characters long", *s.MinLength)
+		}
+
+	case json.Number:
+		if number, err := value.Float64(); err == nil && s.Minimum != nil && number < *s.Minimum {
+			report("must be at least %v", *s.Minimum)
+		}
+	}
+}
+
+func (s *JSONSchema) allows(valueType string) bool {
+	for _, schemaType := range s.Types {
+		if schemaType == valueType || (schemaType == "number" && valueType == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		// Only integer literals are integers: encoding/json does not decode 2.0 or 1e3 into an
+		// integer field, so the schema rejects them as well
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		if _, err := strconv.ParseUint(value.String(), 10, 64); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func escapeJSONPointer(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
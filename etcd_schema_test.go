@@ -0,0 +1,172 @@
+package GoLib
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateJSONSchema(t *testing.T) {
+	schema, err := JSONSchemaFor[ArcheTypes]()
+	require.NoError(t, err)
+
+	data, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "ArcheTypes",
+		"type": "object",
+		"additionalProperties": false,
+		"required": ["archetypes"],
+		"properties": {
+			"archetypes": {
+				"type": ["array", "null"],
+				"items": {
+					"type": "object",
+					"additionalProperties": false,
+					"required": ["name"],
+					"properties": {
+						"name": {"type": "string", "minLength": 1},
+						"request_type": {"type": "string"},
+						"io_config": {
+							"type": "object",
+							"additionalProperties": false,
+							"properties": {
+								"service_io": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+								"finish": {"type": "string"},
+								"third_party_name": {"type": "string"},
+								"third_party": {"type": ["object", "null"], "additionalProperties": {"type": "string"}}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`, string(data))
+
+	// Embedded structs are flattened like encoding/json does
+	schema, err = JSONSchemaFor[MicroServiceDetails]()
+	require.NoError(t, err)
+	assert.Contains(t, schema.Properties, "healthcheck")
+	assert.Equal(t, []string{"Image"}, schema.Required)
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	err := ValidateJSONFor[ArcheTypes]([]byte(`{
+		"archetypes": [
+			{"name": "computeToData", "request_type": "sqlDataRequest", "io_config": {"service_io": {"query/service": "anonymize"}}},
+			{"name": "", "request_typ": "sqlDataRequest", "io_config": {"service_io": {"query": 1}, "finish": ["query"]}}
+		],
+		"version": 2
+	}`))
+	require.Error(t, err)
+
+	var schemaErr *SchemaValidationError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, []SchemaViolation{
+		{Pointer: "/archetypes/1/io_config/finish", Message: "expected string, got array"},
+		{Pointer: "/archetypes/1/io_config/service_io/query", Message: "expected string, got integer"},
+		{Pointer: "/archetypes/1/name", Message: "must be at least 1 characters long"},
+		{Pointer: "/archetypes/1/request_typ", Message: `unknown property "request_typ"`},
+		{Pointer: "/version", Message: `unknown property "version"`},
+	}, schemaErr.Violations)
+
+	err = ValidateJSONFor[RequestorConfig]([]byte(`{}`))
+	assert.ErrorContains(t, err, `(root): missing required property "requestor_config"`)
+
+	assert.NoError(t, ValidateJSONFor[RequestorConfig]([]byte(`{"requestor_config": [{"name": "partnerA", "allowed_partners": null}]}`)))
+	assert.ErrorContains(t, ValidateJSONFor[RequestorConfig]([]byte(`{"requestor_config": `)), "invalid JSON")
+}
+
+func TestRegisterJSONArraySchema(t *testing.T) {
+	cli := setupEtcdClient(t)
+
+	err := RegisterJSONArray[ArcheTypes]([]byte(`{"archetypes": [
+		{"name": "computeToData", "request_type": "sqlDataRequest"},
+		{"name": "dataThroughTtp", "requestType": "sqlDataRequest"}
+	]}`), &ArcheTypes{}, cli, "/archetypes")
+	assert.ErrorContains(t, err, `/archetypes/1/requestType: unknown property "requestType"`)
+
+	// Nothing is stored when any element is invalid
+	resp, err := cli.Get(context.Background(), "/archetypes/computeToData")
+	require.NoError(t, err)
+	assert.Empty(t, resp.Kvs)
+
+	err = RegisterJSONArray[ArcheTypes]([]byte(`{"archetypes": [{"name": "computeToData", "request_type": "sqlDataRequest"}]}`), &ArcheTypes{}, cli, "/archetypes")
+	require.NoError(t, err)
+	archetype, err := NewRepository[*ArcheType](cli, "/archetypes").Get("computeToData")
+	require.NoError(t, err)
+	assert.Equal(t, "sqlDataRequest", archetype.RequestType)
+}
+
+func TestRepositorySchemaValidator(t *testing.T) {
+	schema, err := JSONSchemaFor[ArcheType]()
+	require.NoError(t, err)
+
+	repo := NewRepository[*ArcheType](setupEtcdClient(t), "/archetypes", WithValidator(schema.Validate))
+	assert.NoError(t, repo.Create(&ArcheType{Name: "computeToData"}))
+
+	// Empty names never reach the validator
+	assert.ErrorIs(t, repo.Create(&ArcheType{}), ErrInvalidName)
+
+	err = schema.Validate([]byte(`{"name": ""}`))
+	var schemaErr *SchemaValidationError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, "/name", schemaErr.Violations[0].Pointer)
+}
+
+// scaledServices is an Iterable with an integer field, to check the schema and the decoder agree
+type scaledServices struct {
+	Contents []scaledService `json:"services" jsonschema:"required"`
+}
+
+type scaledService struct {
+	Name     string `json:"name" jsonschema:"required,nonempty"`
+	Replicas uint64 `json:"replicas"`
+}
+
+func (c *scaledServices) Len() int {
+	return len(c.Contents)
+}
+
+func (c *scaledServices) Get(index int) interface{} {
+	return &c.Contents[index]
+}
+
+func (s *scaledService) GetName() string {
+	return s.Name
+}
+
+func TestJSONSchemaIntegers(t *testing.T) {
+	// encoding/json only decodes integer literals into integer fields, so 2.0 and 1e3 are numbers
+	err := ValidateJSONFor[MicroServiceDetails]([]byte(`{"Image": "query_service", "Deploy": {"replicas": 2.0}}`))
+	assert.ErrorContains(t, err, "/Deploy/replicas: expected integer or null, got number")
+	err = ValidateJSONFor[MicroServiceDetails]([]byte(`{"Image": "query_service", "Deploy": {"replicas": 1e3}}`))
+	assert.ErrorContains(t, err, "/Deploy/replicas: expected integer or null, got number")
+	err = ValidateJSONFor[MicroServiceDetails]([]byte(`{"Image": "query_service", "Deploy": {"replicas": 2.5}}`))
+	assert.ErrorContains(t, err, "/Deploy/replicas: expected integer or null, got number")
+	err = ValidateJSONFor[MicroServiceDetails]([]byte(`{"Image": "query_service", "Deploy": {"replicas": -1}}`))
+	assert.ErrorContains(t, err, "/Deploy/replicas: must be at least 0")
+	assert.NoError(t, ValidateJSONFor[MicroServiceDetails]([]byte(`{"Image": "query_service", "Deploy": {"replicas": 18446744073709551615}}`)))
+}
+
+func TestRegisterJSONArrayIntegers(t *testing.T) {
+	cli := setupEtcdClient(t)
+
+	// What the schema accepts is loaded, what it rejects never reaches the decoder
+	err := RegisterJSONArray[scaledServices]([]byte(`{"services": [{"name": "query", "replicas": 2}]}`), &scaledServices{}, cli, "/scaled")
+	require.NoError(t, err)
+	service, err := NewRepository[*scaledService](cli, "/scaled").Get("query")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), service.Replicas)
+
+	for _, replicas := range []string{"2.0", "1e3"} {
+		err := RegisterJSONArray[scaledServices]([]byte(`{"services": [{"name": "query", "replicas": `+replicas+`}]}`), &scaledServices{}, cli, "/scaled")
+		var schemaErr *SchemaValidationError
+		require.ErrorAs(t, err, &schemaErr, replicas)
+		assert.Equal(t, "/services/0/replicas", schemaErr.Violations[0].Pointer)
+	}
+}
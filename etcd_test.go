@@ -1,4 +1,4 @@
-package lib
+package GoLib
 
 import (
 	"context"
@@ -7,36 +7,20 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func setupEtcdClient(t *testing.T) *clientv3.Client {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   []string{"localhost:2379"},
-		DialTimeout: 5 * time.Second,
-	})
-	require.NoError(t, err)
+func setupEtcdClient(t *testing.T) *MemoryEtcdClient {
+	cli := NewMemoryEtcdClient()
+	t.Cleanup(func() { cli.Close() })
 	return cli
 }
 
-type mockEtcdClient struct {
-	data map[string]string
-}
-
-func (m *mockEtcdClient) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
-	m.data[key] = val
-	return nil, nil
-}
-
 // main_test.go
 func TestSetMicroservicesEtcd(t *testing.T) {
-	// Mock the etcd client
-	mockClient := &mockEtcdClient{
-		data: make(map[string]string),
-	}
+	mockClient := setupEtcdClient(t)
 
-	// Call SetMicroservicesEtcd with the mock client
-	processedServices, err := SetMicroservicesEtcd(mockClient, "./microservices_test.yaml", "")
+	// Call SetMicroservicesEtcd with the in-memory client
+	processedServices, err := SetMicroservicesEtcd(mockClient, "./microservices_test.yml", "")
 	if err != nil {
 		t.Fatalf("Error setting microservices in etcd: %v", err)
 	}
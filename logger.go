@@ -9,7 +9,8 @@ import (
 )
 
 var (
-	log     *logrus.Entry
+	// log defaults to the standard logrus logger, so the library can log before InitLogger is called.
+	log     = logrus.NewEntry(logrus.StandardLogger())
 	logFile *os.File
 )
 
@@ -0,0 +1,555 @@
+package GoLib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/sirupsen/logrus"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// ServiceNameLabel holds the name of the service in etcd the Swarm service was created from.
+	ServiceNameLabel = "com.golib.service"
+	// SpecHashLabel holds a hash of the MicroServiceDetails the service was last created or updated from.
+	SpecHashLabel = "com.golib.spec-hash"
+)
+
+// Payload converts the details stored in etcd to the payload used to create a service spec.
+func (d MicroServiceDetails) Payload() CreateServicePayload {
+	imageName, tag, digest := d.Image, d.Tag, d.Digest
+	if tag == "" && digest == "" {
+		if image, err := ParseImageReference(d.Image); err == nil {
+			imageName, tag, digest = image.Name(), image.Tag, image.Digest
+		}
+		if tag == "" && digest == "" {
+			tag = DefaultImageTag
+		}
+	}
+
+	networks := make([]string, 0, len(d.Networks))
+	var aliases map[string][]string
+	for network, options := range d.Networks {
+		networks = append(networks, network)
+		if len(options.Aliases) > 0 {
+			if aliases == nil {
+				aliases = make(map[string][]string)
+			}
+			aliases[network] = options.Aliases
+		}
+	}
+	sort.Strings(networks)
+
+	return CreateServicePayload{
+		ImageName:      imageName,
+		Tag:            tag,
+		Digest:         digest,
+		EnvVars:        d.EnvVars,
+		Networks:       networks,
+		NetworkAliases: aliases,
+		Secrets:        d.Secrets,
+		SecretRefs:     d.SecretRefs,
+		Configs:        d.Configs,
+		Volumes:        d.Volumes,
+		Ports:          d.Ports,
+		PortConfigs:    d.PortConfigs,
+		Mounts:         d.Mounts,
+		Deploy:         d.Deploy,
+
+		ContainerOptions: d.ContainerOptions,
+	}
+}
+
+// SpecHash returns a short hash of the details, used to detect changes of the details in etcd.
+func (d MicroServiceDetails) SpecHash() (string, error) {
+	// encoding/json sorts map keys, so equal details always give the same hash
+	data, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+type DriftAction string
+
+const (
+	DriftCreate DriftAction = "create"
+	DriftUpdate DriftAction = "update"
+	DriftRemove DriftAction = "remove"
+)
+
+// Drift is a difference between etcd and Swarm for a single service.
+type Drift struct {
+	Service string
+	Action  DriftAction
+	Reason  string
+	// Err is set when the change could not be worked out or applying it failed.
+	Err error
+}
+
+// DriftReport lists the services that differed between etcd and Swarm during a reconcile.
+type DriftReport struct {
+	DryRun bool
+	Drift  []Drift
+	InSync []string
+}
+
+// String renders the report with + for created, ~ for updated and - for removed services.
+func (r DriftReport) String() string {
+	var sb strings.Builder
+
+	symbols := map[DriftAction]string{DriftCreate: "+", DriftUpdate: "~", DriftRemove: "-"}
+	for _, drift := range r.Drift {
+		sb.WriteString(fmt.Sprintf("%s %s (%s)", symbols[drift.Action], drift.Service, drift.Reason))
+		if drift.Err != nil {
+			sb.WriteString(fmt.Sprintf(": failed: %v", drift.Err))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("%d in sync, %d drifted\n", len(r.InSync), len(r.Drift)))
+
+	return sb.String()
+}
+
+// Failed returns the changes that could not be applied.
+func (r DriftReport) Failed() []Drift {
+	failed := []Drift{}
+	for _, drift := range r.Drift {
+		if drift.Err != nil {
+			failed = append(failed, drift)
+		}
+	}
+	return failed
+}
+
+type reconcilerOptions struct {
+	prefix      string
+	dryRun      bool
+	rateLimit   time.Duration
+	resync      time.Duration
+	debounce    time.Duration
+	etcdOpts    []EtcdOption
+	onReconcile func(DriftReport, error)
+}
+
+type ReconcilerOption func(*reconcilerOptions)
+
+// ReconcilePrefix sets the etcd prefix holding the services, default /microservices.
+func ReconcilePrefix(prefix string) ReconcilerOption {
+	return func(options *reconcilerOptions) {
+		options.prefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// ReconcileDryRun only reports drift, no services are created, updated or removed.
+func ReconcileDryRun() ReconcilerOption {
+	return func(options *reconcilerOptions) {
+		options.dryRun = true
+	}
+}
+
+// ReconcileRateLimit sets the minimum time between two changes to Swarm, default 1 second.
+func ReconcileRateLimit(interval time.Duration) ReconcilerOption {
+	return func(options *reconcilerOptions) {
+		options.rateLimit = interval
+	}
+}
+
+// ReconcileResync sets how often Run reconciles without a change in etcd, to repair drift
+// caused by changes made directly in Swarm, like docker service update --image. Default 5
+// minutes, 0 disables it.
+func ReconcileResync(interval time.Duration) ReconcilerOption {
+	return func(options *reconcilerOptions) {
+		options.resync = interval
+	}
+}
+
+// ReconcileEtcdOptions passes options, like WithEncryption, used to read the services from etcd.
+func ReconcileEtcdOptions(opts ...EtcdOption) ReconcilerOption {
+	return func(options *reconcilerOptions) {
+		options.etcdOpts = append(options.etcdOpts, opts...)
+	}
+}
+
+// OnReconcile is called by Run with the result of every reconcile.
+func OnReconcile(handler func(DriftReport, error)) ReconcilerOption {
+	return func(options *reconcilerOptions) {
+		options.onReconcile = handler
+	}
+}
+
+// Reconciler keeps the Swarm services in line with the MicroServiceDetails stored in etcd.
+// Services are matched on ServiceNameLabel, only services created by a Reconciler are updated or removed.
+type Reconciler struct {
+	etcdClient EtcdClient
+	cli        DockerClient
+	options    reconcilerOptions
+}
+
+func NewReconciler(etcdClient EtcdClient, cli DockerClient, opts ...ReconcilerOption) *Reconciler {
+	options := reconcilerOptions{
+		prefix:    "/microservices",
+		rateLimit: time.Second,
+		resync:    5 * time.Minute,
+		debounce:  500 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Reconciler{etcdClient: etcdClient, cli: cli, options: options}
+}
+
+// Run reconciles once, then again after every change under the prefix and on every resync,
+// until ctx is cancelled. Bursts of changes are combined into a single reconcile.
+func (r *Reconciler) Run(ctx context.Context) error {
+	// Watch before the first reconcile, so no change made in between is missed
+	watchChan := r.etcdClient.Watch(ctx, r.options.prefix+"/", clientv3.WithPrefix())
+	r.reconcileAndReport(ctx)
+
+	var resync <-chan time.Time
+	if r.options.resync > 0 {
+		ticker := time.NewTicker(r.options.resync)
+		defer ticker.Stop()
+		resync = ticker.C
+	}
+
+	debounce := time.NewTimer(0)
+	if !debounce.Stop() {
+		<-debounce.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case resp, ok := <-watchChan:
+			if !ok {
+				return fmt.Errorf("watch on %s closed", r.options.prefix)
+			}
+			if err := resp.Err(); err != nil {
+				return fmt.Errorf("watch on %s failed: %w", r.options.prefix, err)
+			}
+			debounce.Reset(r.options.debounce)
+		case <-debounce.C:
+			r.reconcileAndReport(ctx)
+		case <-resync:
+			r.reconcileAndReport(ctx)
+		}
+	}
+}
+
+func (r *Reconciler) reconcileAndReport(ctx context.Context) {
+	report, err := r.Reconcile(ctx)
+	if err != nil {
+		log.Errorf("Reconcile failed: %v", err)
+	} else if len(report.Drift) > 0 {
+		log.WithFields(logrus.Fields{
+			"dryRun":  report.DryRun,
+			"drifted": len(report.Drift),
+			"failed":  len(report.Failed()),
+		}).Infof("Reconciled services\n%s", report)
+	}
+
+	if r.options.onReconcile != nil {
+		r.options.onReconcile(report, err)
+	}
+}
+
+// Reconcile compares etcd with Swarm once and, unless in dry-run mode, creates, updates and
+// removes services to match. Failing changes are recorded in the report, they do not stop the others.
+func (r *Reconciler) Reconcile(ctx context.Context) (DriftReport, error) {
+	report := DriftReport{DryRun: r.options.dryRun}
+
+	desired, err := GetAndUnmarshalJSONMap[MicroServiceDetails](r.etcdClient, r.options.prefix+"/", r.options.etcdOpts...)
+	if err != nil {
+		return report, fmt.Errorf("failed to read services from etcd: %w", err)
+	}
+
+	services, err := r.cli.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", ManagedByLabel+"="+ManagedByValue),
+			filters.Arg("label", ServiceNameLabel),
+		),
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	running := make(map[string]swarm.Service)
+	for _, service := range services {
+		running[service.Spec.Labels[ServiceNameLabel]] = service
+	}
+
+	// Services are created after the services they depend on. A service with a missing dependency
+	// or in a cycle is reported as failed, the other services are still reconciled.
+	names, invalid := startupOrder(desired)
+	for _, name := range sortedServiceNames(desired) {
+		if err, ok := invalid[name]; ok {
+			report.Drift = append(report.Drift, Drift{Service: name, Action: driftAction(running, name), Reason: "invalid dependencies", Err: err})
+		}
+	}
+
+	for _, name := range names {
+		hash, err := desired[name].SpecHash()
+		if err != nil {
+			report.Drift = append(report.Drift, Drift{Service: name, Action: driftAction(running, name), Reason: "invalid spec", Err: err})
+			continue
+		}
+
+		service, exists := running[name]
+		switch {
+		case !exists:
+			report.Drift = append(report.Drift, Drift{Service: name, Action: DriftCreate, Reason: "not running"})
+		case service.Spec.Labels[SpecHashLabel] != hash:
+			report.Drift = append(report.Drift, Drift{Service: name, Action: DriftUpdate, Reason: "spec changed"})
+		default:
+			changed, err := r.changedInSwarm(ctx, service, desired[name])
+			if err != nil {
+				report.Drift = append(report.Drift, Drift{Service: name, Action: DriftUpdate, Reason: "invalid spec", Err: err})
+			} else if changed {
+				report.Drift = append(report.Drift, Drift{Service: name, Action: DriftUpdate, Reason: "changed in Swarm"})
+			} else {
+				report.InSync = append(report.InSync, name)
+			}
+		}
+	}
+
+	removed := []string{}
+	for name := range running {
+		if _, ok := desired[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		report.Drift = append(report.Drift, Drift{Service: name, Action: DriftRemove, Reason: "not in etcd"})
+	}
+
+	if r.options.dryRun {
+		return report, nil
+	}
+
+	applied := 0
+	for i := range report.Drift {
+		drift := &report.Drift[i]
+		if drift.Err != nil {
+			continue
+		}
+
+		if applied > 0 && r.options.rateLimit > 0 {
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-time.After(r.options.rateLimit):
+			}
+		}
+		applied++
+
+		switch drift.Action {
+		case DriftCreate:
+			drift.Err = r.create(ctx, drift.Service, desired[drift.Service])
+		case DriftUpdate:
+			drift.Err = r.update(ctx, running[drift.Service].ID, drift.Service, desired[drift.Service])
+		case DriftRemove:
+			drift.Err = RemoveService(r.cli, running[drift.Service].ID)
+		}
+	}
+
+	return report, nil
+}
+
+// driftAction returns the action that brings a service in etcd to Swarm.
+func driftAction(running map[string]swarm.Service, name string) DriftAction {
+	if _, ok := running[name]; ok {
+		return DriftUpdate
+	}
+	return DriftCreate
+}
+
+func (r *Reconciler) create(ctx context.Context, name string, details MicroServiceDetails) error {
+	spec, err := CreateServiceSpecFromPayload(details.Payload(), r.cli)
+	if err != nil {
+		return err
+	}
+
+	labels, err := managedLabels(name, details)
+	if err != nil {
+		return err
+	}
+	spec.Name = name
+	for k, v := range labels {
+		spec.Labels[k] = v
+	}
+
+	response, err := r.cli.ServiceCreate(ctx, spec, types.ServiceCreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %w", name, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"service":    name,
+		"responseId": response.ID,
+	}).Info("Service created")
+	return nil
+}
+
+// update applies the details to a running service. Swarm can not change the mode of a service,
+// so a service that switches between replicated and global is removed and created again.
+func (r *Reconciler) update(ctx context.Context, serviceID string, name string, details MicroServiceDetails) error {
+	labels, err := managedLabels(name, details)
+	if err != nil {
+		return err
+	}
+
+	_, err = updateServiceFromPayload(r.cli, serviceID, details.Payload(), labels)
+	if !errors.Is(err, ErrServiceModeChanged) {
+		return err
+	}
+
+	log.Warnf("Recreating service %s: %v", name, err)
+	if err := RemoveService(r.cli, serviceID); err != nil {
+		return err
+	}
+	return r.create(ctx, name, details)
+}
+
+// changedInSwarm reports whether the fields of a service that an update sets, see applyServiceDiff,
+// differ from the details in etcd. The spec hash label only changes with the details, so changes
+// made directly in Swarm are found this way.
+func (r *Reconciler) changedInSwarm(ctx context.Context, service swarm.Service, details MicroServiceDetails) (bool, error) {
+	desired, err := CreateServiceSpecFromPayload(details.Payload(), r.cli)
+	if err != nil {
+		return false, err
+	}
+
+	// Swarm stores the networks of a service by ID
+	for i, network := range desired.TaskTemplate.Networks {
+		resource, err := r.cli.NetworkInspect(ctx, network.Target, types.NetworkInspectOptions{})
+		if err != nil {
+			continue
+		}
+		for _, attached := range service.Spec.TaskTemplate.Networks {
+			if attached.Target == resource.ID {
+				desired.TaskTemplate.Networks[i].Target = resource.ID
+			}
+		}
+	}
+
+	keepReplicas := details.Deploy.Replicas == nil
+	want := ownedSpec(desired, keepReplicas)
+	live := ownedSpec(service.Spec, keepReplicas)
+
+	// Options that are not set in etcd are left to Swarm, which may fill in its defaults
+	if want.TaskTemplate.Placement == nil {
+		live.TaskTemplate.Placement = nil
+	}
+	if want.TaskTemplate.Resources == nil {
+		live.TaskTemplate.Resources = nil
+	}
+	if want.TaskTemplate.RestartPolicy == nil {
+		live.TaskTemplate.RestartPolicy = nil
+	}
+	if want.UpdateConfig == nil {
+		live.UpdateConfig = nil
+	}
+	if want.RollbackConfig == nil {
+		live.RollbackConfig = nil
+	}
+	// Swarm may pin the image to the digest it resolved
+	wantImage, liveImage := want.TaskTemplate.ContainerSpec, live.TaskTemplate.ContainerSpec
+	if !strings.Contains(wantImage.Image, "@") {
+		liveImage.Image, _, _ = strings.Cut(liveImage.Image, "@")
+	}
+
+	liveJSON, err := json.Marshal(live)
+	if err != nil {
+		return false, err
+	}
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(liveJSON, wantJSON), nil
+}
+
+// ownedSpec returns only the fields of spec that are set from the details in etcd, see
+// applyServiceDiff. They are normalized like Swarm stores them: lists are sorted, the default
+// endpoint and port modes are filled in and with keepReplicas the number of replicas is left out.
+func ownedSpec(spec swarm.ServiceSpec, keepReplicas bool) swarm.ServiceSpec {
+	copied := copySpec(spec)
+	if copied.TaskTemplate.ContainerSpec == nil {
+		copied.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{}
+	}
+	owned := swarm.ServiceSpec{}
+	applyServiceDiff(&owned, copied, false)
+
+	containerSpec := owned.TaskTemplate.ContainerSpec
+	sort.Strings(containerSpec.Env)
+	sort.Slice(containerSpec.Mounts, func(i, j int) bool { return containerSpec.Mounts[i].Target < containerSpec.Mounts[j].Target })
+	sort.Slice(containerSpec.Secrets, func(i, j int) bool { return containerSpec.Secrets[i].SecretName < containerSpec.Secrets[j].SecretName })
+	sort.Slice(containerSpec.Configs, func(i, j int) bool { return containerSpec.Configs[i].ConfigName < containerSpec.Configs[j].ConfigName })
+
+	networks := owned.TaskTemplate.Networks
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Target < networks[j].Target })
+
+	if resources := owned.TaskTemplate.Resources; resources != nil && resources.Limits == nil && resources.Reservations == nil {
+		owned.TaskTemplate.Resources = nil
+	}
+
+	if owned.EndpointSpec == nil {
+		owned.EndpointSpec = &swarm.EndpointSpec{}
+	}
+	if owned.EndpointSpec.Mode == "" {
+		owned.EndpointSpec.Mode = swarm.ResolutionModeVIP
+	}
+	ports := owned.EndpointSpec.Ports
+	for i := range ports {
+		if ports[i].Protocol == "" {
+			ports[i].Protocol = swarm.PortConfigProtocolTCP
+		}
+		if ports[i].PublishMode == "" {
+			ports[i].PublishMode = swarm.PortConfigPublishModeIngress
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].PublishedPort != ports[j].PublishedPort {
+			return ports[i].PublishedPort < ports[j].PublishedPort
+		}
+		if ports[i].TargetPort != ports[j].TargetPort {
+			return ports[i].TargetPort < ports[j].TargetPort
+		}
+		return ports[i].Protocol < ports[j].Protocol
+	})
+
+	if keepReplicas && owned.Mode.Replicated != nil {
+		owned.Mode.Replicated.Replicas = nil
+	}
+	return owned
+}
+
+func managedLabels(name string, details MicroServiceDetails) (map[string]string, error) {
+	hash, err := details.SpecHash()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		ManagedByLabel:   ManagedByValue,
+		ServiceNameLabel: name,
+		SpecHashLabel:    hash,
+	}, nil
+}
@@ -0,0 +1,292 @@
+package GoLib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMicroServiceDetailsPayload(t *testing.T) {
+	details := MicroServiceDetails{
+		Image:    "registry.example.com/query:1.2",
+		EnvVars:  map[string]string{"A": "1"},
+		Networks: map[string]Network{"core": {}, "backend": {}},
+		Deploy:   Deploy{Replicas: NewReplicas(2)},
+
+		ContainerOptions: ContainerOptions{User: "nobody"},
+	}
+
+	payload := details.Payload()
+	assert.Equal(t, "registry.example.com/query", payload.ImageName)
+	assert.Equal(t, "1.2", payload.Tag)
+	assert.Equal(t, []string{"backend", "core"}, payload.Networks)
+	assert.Equal(t, uint64(2), *payload.Deploy.Replicas)
+	assert.Equal(t, "nobody", payload.User)
+}
+
+func TestMicroServiceDetailsSpecHash(t *testing.T) {
+	details := MicroServiceDetails{Image: "query", EnvVars: map[string]string{"A": "1", "B": "2"}}
+
+	hash, err := details.SpecHash()
+	require.NoError(t, err)
+	again, err := details.SpecHash()
+	require.NoError(t, err)
+	assert.Equal(t, hash, again)
+
+	details.EnvVars["B"] = "3"
+	changed, err := details.SpecHash()
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+}
+
+func TestDriftReportString(t *testing.T) {
+	report := DriftReport{
+		Drift: []Drift{
+			{Service: "query", Action: DriftCreate, Reason: "not running"},
+			{Service: "old", Action: DriftRemove, Reason: "not in etcd", Err: errors.New("boom")},
+		},
+		InSync: []string{"agent"},
+	}
+
+	assert.Equal(t, "+ query (not running)\n- old (not in etcd): failed: boom\n1 in sync, 2 drifted\n", report.String())
+	assert.Len(t, report.Failed(), 1)
+}
+
+func TestReconcile(t *testing.T) {
+	etcdClient := setupEtcdClient(t)
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	query := MicroServiceDetails{Image: "query_service", Tag: "1.0", Deploy: Deploy{Replicas: NewReplicas(2)}}
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/query", query))
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/anonymize", MicroServiceDetails{Image: "anonymize_service"}))
+
+	// Services not created by the reconciler are never touched
+	createFakeService(t, fake, CreateServicePayload{ImageName: "unmanaged"})
+
+	reconciler := NewReconciler(etcdClient, fake, ReconcileRateLimit(0))
+
+	report, err := reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Drift{
+		{Service: "anonymize", Action: DriftCreate, Reason: "not running"},
+		{Service: "query", Action: DriftCreate, Reason: "not running"},
+	}, report.Drift)
+
+	service, _, err := fake.ServiceInspectWithRaw(ctx, "query", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io/library/query_service:1.0", service.Spec.TaskTemplate.ContainerSpec.Image)
+	assert.Equal(t, ManagedByValue, service.Spec.Labels[ManagedByLabel])
+
+	report, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, report.Drift)
+	assert.Equal(t, []string{"anonymize", "query"}, report.InSync)
+
+	query.Tag = "1.1"
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/query", query))
+	_, err = etcdClient.Delete(ctx, "/microservices/anonymize")
+	require.NoError(t, err)
+
+	report, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Drift{
+		{Service: "query", Action: DriftUpdate, Reason: "spec changed"},
+		{Service: "anonymize", Action: DriftRemove, Reason: "not in etcd"},
+	}, report.Drift)
+
+	services, err := fake.ServiceList(ctx, types.ServiceListOptions{})
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+	assert.Equal(t, "query", services[0].Spec.Name)
+	assert.Equal(t, "docker.io/library/query_service:1.1", services[0].Spec.TaskTemplate.ContainerSpec.Image)
+	assert.Equal(t, "unmanaged", services[1].Spec.Name)
+}
+
+func TestReconcileChangedInSwarm(t *testing.T) {
+	etcdClient := setupEtcdClient(t)
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	network, err := fake.NetworkCreate(ctx, "core", types.NetworkCreate{Driver: "overlay"})
+	require.NoError(t, err)
+
+	query := MicroServiceDetails{Image: "query_service", Tag: "1.0", Networks: map[string]Network{"core": {}}, Deploy: Deploy{Replicas: NewReplicas(2)}}
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/query", query))
+
+	reconciler := NewReconciler(etcdClient, fake, ReconcileRateLimit(0))
+	_, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+
+	// Swarm stores networks by ID, that is not a change
+	_, err = updateService(fake, "query", types.ServiceUpdateOptions{}, func(service swarm.Service) (swarm.ServiceSpec, error) {
+		service.Spec.TaskTemplate.Networks[0].Target = network.ID
+		return service.Spec, nil
+	})
+	require.NoError(t, err)
+	report, err := reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"query"}, report.InSync)
+
+	// Like docker service update --image query_service:debug --replicas 5
+	_, err = updateService(fake, "query", types.ServiceUpdateOptions{}, func(service swarm.Service) (swarm.ServiceSpec, error) {
+		service.Spec.TaskTemplate.ContainerSpec.Image = "query_service:debug"
+		scaled := uint64(5)
+		service.Spec.Mode.Replicated.Replicas = &scaled
+		return service.Spec, nil
+	})
+	require.NoError(t, err)
+
+	report, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Drift{{Service: "query", Action: DriftUpdate, Reason: "changed in Swarm"}}, report.Drift)
+
+	service, _, err := fake.ServiceInspectWithRaw(ctx, "query", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "docker.io/library/query_service:1.0", service.Spec.TaskTemplate.ContainerSpec.Image)
+	assert.Equal(t, uint64(2), *service.Spec.Mode.Replicated.Replicas)
+
+	// Without replicas in etcd the scale is left to Swarm
+	query.Deploy.Replicas = nil
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/query", query))
+	_, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	require.NoError(t, ScaleService(fake, "query", 5))
+	report, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"query"}, report.InSync)
+}
+
+func TestReconcileModeChange(t *testing.T) {
+	etcdClient := setupEtcdClient(t)
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	collector := MicroServiceDetails{Image: "log_collector"}
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/collector", collector))
+	reconciler := NewReconciler(etcdClient, fake, ReconcileRateLimit(0))
+	_, err := reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	before, _, err := fake.ServiceInspectWithRaw(ctx, "collector", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+
+	_, err = UpdateDockerService(fake, "collector", CreateServicePayload{ImageName: "log_collector", Deploy: Deploy{Mode: "global"}})
+	assert.ErrorIs(t, err, ErrServiceModeChanged)
+
+	// Swarm can not update the mode, the reconciler creates the service again
+	collector.Deploy.Mode = "global"
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/collector", collector))
+	report, err := reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Drift, 1)
+	assert.NoError(t, report.Drift[0].Err)
+
+	after, _, err := fake.ServiceInspectWithRaw(ctx, "collector", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.NotEqual(t, before.ID, after.ID)
+	assert.NotNil(t, after.Spec.Mode.Global)
+
+	report, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"collector"}, report.InSync)
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	etcdClient := setupEtcdClient(t)
+	fake := NewFakeSwarm()
+
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/query", MicroServiceDetails{Image: "query_service"}))
+
+	report, err := NewReconciler(etcdClient, fake, ReconcileDryRun()).Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Len(t, report.Drift, 1)
+
+	services, err := fake.ServiceList(context.Background(), types.ServiceListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+func TestReconcileUnchangedService(t *testing.T) {
+	etcdClient := setupEtcdClient(t)
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	query := MicroServiceDetails{
+		Image:   "query_service",
+		Tag:     "1.0",
+		EnvVars: map[string]string{"A": "1", "B": "2", "C": "3", "D": "4", "E": "5"},
+		Ports:   map[string]string{"8080": "80", "8443": "443", "9090": "9090"},
+		Volumes: map[string]string{"data": "/data", "logs": "/logs", "cache": "/cache"},
+	}
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/query", query))
+
+	reconciler := NewReconciler(etcdClient, fake, ReconcileRateLimit(0))
+	report, err := reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Drift, 1)
+
+	created, _, err := fake.ServiceInspectWithRaw(ctx, "query", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+
+	// Maps are walked in random order, a single run could pass by chance
+	for i := 0; i < 20; i++ {
+		report, err = reconciler.Reconcile(ctx)
+		require.NoError(t, err)
+		require.Empty(t, report.Drift)
+		assert.Equal(t, []string{"query"}, report.InSync)
+	}
+
+	// Defaults filled in by Swarm are not a change either
+	_, err = updateService(fake, "query", types.ServiceUpdateOptions{}, func(service swarm.Service) (swarm.ServiceSpec, error) {
+		spec := service.Spec
+		spec.TaskTemplate.ContainerSpec.Image += "@sha256:" + strings.Repeat("a", 64)
+		env := spec.TaskTemplate.ContainerSpec.Env
+		env[0], env[len(env)-1] = env[len(env)-1], env[0]
+		for i := range spec.EndpointSpec.Ports {
+			spec.EndpointSpec.Ports[i].PublishMode = swarm.PortConfigPublishModeIngress
+		}
+		spec.UpdateConfig = &swarm.UpdateConfig{Parallelism: 1, FailureAction: swarm.UpdateFailureActionPause}
+		spec.TaskTemplate.RestartPolicy = &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionAny}
+		return spec, nil
+	})
+	require.NoError(t, err)
+
+	report, err = reconciler.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, report.Drift)
+
+	service, _, err := fake.ServiceInspectWithRaw(ctx, "query", types.ServiceInspectOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, created.Version.Index+1, service.Version.Index, "only the update of the test itself")
+}
+
+func TestReconcileInvalidDependencies(t *testing.T) {
+	etcdClient := setupEtcdClient(t)
+	fake := NewFakeSwarm()
+	ctx := context.Background()
+
+	broken := MicroServiceDetails{Image: "query_service", DependsOn: map[string]Dependency{"missing": {}}}
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/query", broken))
+	require.NoError(t, SaveStructToEtcd(etcdClient, "/microservices/anonymize", MicroServiceDetails{Image: "anonymize_service"}))
+
+	report, err := NewReconciler(etcdClient, fake, ReconcileRateLimit(0)).Reconcile(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Drift, 2)
+	assert.Equal(t, "query", report.Drift[0].Service)
+	assert.Equal(t, DriftCreate, report.Drift[0].Action)
+	assert.ErrorContains(t, report.Drift[0].Err, "depends on undefined service missing")
+	assert.Equal(t, Drift{Service: "anonymize", Action: DriftCreate, Reason: "not running"}, report.Drift[1])
+
+	services, err := fake.ServiceList(ctx, types.ServiceListOptions{})
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "anonymize", services[0].Spec.Name)
+}
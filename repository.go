@@ -0,0 +1,320 @@
+package GoLib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// ErrNotFound is returned when no value is stored under the requested key.
+	ErrNotFound = errors.New("key not found in etcd")
+	// ErrAlreadyExists is returned by Create when the key is already in use.
+	ErrAlreadyExists = errors.New("key already exists in etcd")
+	// ErrInvalidName is returned for names that are empty or contain a '/', as they would be stored outside the prefix.
+	ErrInvalidName = errors.New("invalid name for etcd key")
+)
+
+type repositoryOptions struct {
+	timeout  time.Duration
+	validate func([]byte) error
+	keyring  *Keyring
+}
+
+type RepositoryOption func(*repositoryOptions)
+
+// RepositoryTimeout overrides the default 5 second timeout used for every etcd call.
+func RepositoryTimeout(timeout time.Duration) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.timeout = timeout
+	}
+}
+
+// WithValidator runs validate against the JSON representation of an element
+// before it is written to etcd, for example to check it against a JSON schema.
+func WithValidator(validate func([]byte) error) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.validate = validate
+	}
+}
+
+// RepositoryEncryption encrypts elements with keyring, see SaveStructToEtcd and WithEncryption.
+func RepositoryEncryption(keyring *Keyring) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.keyring = keyring
+	}
+}
+
+// Repository stores elements of type T as JSON documents under a single etcd prefix,
+// using the GetName() of every element as the last part of its key. Names that are empty or
+// contain a '/' are rejected with ErrInvalidName.
+//
+//	archetypes := NewRepository[*ArcheType](etcdClient, "/archetypes")
+//	archetype, err := archetypes.Get("computeToData")
+//	if errors.Is(err, ErrNotFound) { ... }
+type Repository[T NameGetter] struct {
+	etcdClient EtcdClient
+	prefix     string
+	options    repositoryOptions
+}
+
+// NewRepository returns a Repository bound to prefix, e.g. "/microservices".
+func NewRepository[T NameGetter](etcdClient EtcdClient, prefix string, opts ...RepositoryOption) *Repository[T] {
+	options := repositoryOptions{
+		timeout: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &Repository[T]{
+		etcdClient: etcdClient,
+		prefix:     strings.TrimSuffix(prefix, "/"),
+		options:    options,
+	}
+}
+
+// Key returns the full etcd key an element with the given name is stored under.
+func (r *Repository[T]) Key(name string) string {
+	return fmt.Sprintf("%s/%s", r.prefix, name)
+}
+
+func (r *Repository[T]) validKey(name string) (string, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return r.Key(name), nil
+}
+
+// Create stores element, failing with ErrAlreadyExists if its key is already in use.
+func (r *Repository[T]) Create(element T) error {
+	key, err := r.validKey(element.GetName())
+	if err != nil {
+		return err
+	}
+	value, err := r.encode(element)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.timeout)
+	defer cancel()
+
+	resp, err := r.etcdClient.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("failed to create %s in etcd: %w", key, err)
+	}
+
+	if !resp.Succeeded {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, key)
+	}
+	return nil
+}
+
+// Get returns the element stored under name, or an error wrapping ErrNotFound.
+func (r *Repository[T]) Get(name string) (T, error) {
+	var element T
+	key, err := r.validKey(name)
+	if err != nil {
+		return element, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.timeout)
+	defer cancel()
+
+	resp, err := r.etcdClient.Get(ctx, key)
+	if err != nil {
+		return element, fmt.Errorf("failed to get key %s from etcd: %w", key, err)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return element, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return r.decode(key, resp.Kvs[0].Value)
+}
+
+// Update overwrites an existing element, failing with ErrNotFound if it was never created.
+func (r *Repository[T]) Update(element T) error {
+	key, err := r.validKey(element.GetName())
+	if err != nil {
+		return err
+	}
+	value, err := r.encode(element)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.timeout)
+	defer cancel()
+
+	resp, err := r.etcdClient.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(key, value)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("failed to update %s in etcd: %w", key, err)
+	}
+
+	if !resp.Succeeded {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return nil
+}
+
+// Delete removes the element stored under name, or returns an error wrapping ErrNotFound.
+func (r *Repository[T]) Delete(name string) error {
+	key, err := r.validKey(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.timeout)
+	defer cancel()
+
+	resp, err := r.etcdClient.Delete(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete key %s from etcd: %w", key, err)
+	}
+
+	if resp.Deleted == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return nil
+}
+
+// Exists reports whether an element is stored under name.
+func (r *Repository[T]) Exists(name string) (bool, error) {
+	key, err := r.validKey(name)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.timeout)
+	defer cancel()
+
+	resp, err := r.etcdClient.Get(ctx, key, clientv3.WithCountOnly())
+	if err != nil {
+		return false, fmt.Errorf("failed to get key %s from etcd: %w", key, err)
+	}
+
+	return resp.Count > 0, nil
+}
+
+// List returns all elements under the prefix, keyed by name.
+func (r *Repository[T]) List() (map[string]T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.options.timeout)
+	defer cancel()
+
+	resp, err := r.etcdClient.Get(ctx, r.prefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get values with prefix %s from etcd: %w", r.prefix, err)
+	}
+
+	result := make(map[string]T, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		element, err := r.decode(string(kv.Key), kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		result[r.name(string(kv.Key))] = element
+	}
+
+	return result, nil
+}
+
+type RepositoryEventType int
+
+const (
+	RepositoryEventPut RepositoryEventType = iota
+	RepositoryEventDelete
+)
+
+// RepositoryEvent describes a single change under the prefix of a Repository.
+// Value is the zero value for deletes, Err is set when the stored JSON could not be decoded.
+type RepositoryEvent[T NameGetter] struct {
+	Type  RepositoryEventType
+	Name  string
+	Value T
+	Err   error
+}
+
+// Watch streams changes under the prefix until ctx is cancelled, after which the channel is closed.
+func (r *Repository[T]) Watch(ctx context.Context) <-chan RepositoryEvent[T] {
+	events := make(chan RepositoryEvent[T])
+	watchChan := r.etcdClient.Watch(ctx, r.prefix+"/", clientv3.WithPrefix())
+
+	go func() {
+		defer close(events)
+
+		for watchResp := range watchChan {
+			if err := watchResp.Err(); err != nil {
+				log.Errorf("failed watching prefix %s: %v", r.prefix, err)
+				continue
+			}
+
+			for _, ev := range watchResp.Events {
+				key := string(ev.Kv.Key)
+				event := RepositoryEvent[T]{Name: r.name(key)}
+
+				if ev.Type == clientv3.EventTypeDelete {
+					event.Type = RepositoryEventDelete
+				} else {
+					event.Type = RepositoryEventPut
+					event.Value, event.Err = r.decode(key, ev.Kv.Value)
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events
+}
+
+func (r *Repository[T]) name(key string) string {
+	return strings.TrimPrefix(key, r.prefix+"/")
+}
+
+func (r *Repository[T]) encode(element T) (string, error) {
+	jsonRep, err := json.Marshal(element)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s: %w", element.GetName(), err)
+	}
+
+	if r.options.validate != nil {
+		if err := r.options.validate(jsonRep); err != nil {
+			return "", fmt.Errorf("validation of %s failed: %w", element.GetName(), err)
+		}
+	}
+
+	if r.options.keyring != nil {
+		jsonRep, err = r.options.keyring.encryptJSON(element)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt %s: %w", element.GetName(), err)
+		}
+	}
+
+	return string(jsonRep), nil
+}
+
+func (r *Repository[T]) decode(key string, data []byte) (T, error) {
+	var element T
+	if err := decryptJSON(r.options.keyring, data, &element); err != nil {
+		return element, fmt.Errorf("failed to unmarshal JSON for key %s: %w", key, err)
+	}
+	return element, nil
+}
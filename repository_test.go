@@ -0,0 +1,113 @@
+package GoLib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryKey(t *testing.T) {
+	repo := NewRepository[*Requestor](nil, "/reasoner/requestor_config/")
+
+	assert.Equal(t, "/reasoner/requestor_config/jorrit", repo.Key("jorrit"))
+	assert.Equal(t, "jorrit", repo.name("/reasoner/requestor_config/jorrit"))
+}
+
+func TestRepositoryEncode(t *testing.T) {
+	repo := NewRepository[*Requestor](nil, "/reasoner/requestor_config")
+	requestor := &Requestor{Name: "jorrit", CurrentArchetype: "computeToData", AllowedPartners: []string{"VU"}}
+
+	value, err := repo.encode(requestor)
+	require.NoError(t, err)
+
+	decoded, err := repo.decode(repo.Key("jorrit"), []byte(value))
+	require.NoError(t, err)
+	assert.Equal(t, requestor, decoded)
+
+	_, err = repo.decode(repo.Key("jorrit"), []byte("{"))
+	assert.ErrorContains(t, err, "/reasoner/requestor_config/jorrit")
+}
+
+func TestRepositoryCRUD(t *testing.T) {
+	repo := NewRepository[*Requestor](setupEtcdClient(t), "/reasoner/requestor_config/")
+
+	requestor := &Requestor{Name: "jorrit", CurrentArchetype: "computeToData", AllowedPartners: []string{"VU"}}
+	require.NoError(t, repo.Create(requestor))
+	assert.ErrorIs(t, repo.Create(requestor), ErrAlreadyExists)
+
+	got, err := repo.Get("jorrit")
+	require.NoError(t, err)
+	assert.Equal(t, requestor, got)
+
+	requestor.CurrentArchetype = "dataThroughTtp"
+	require.NoError(t, repo.Update(requestor))
+	assert.ErrorIs(t, repo.Update(&Requestor{Name: "unknown"}), ErrNotFound)
+
+	list, err := repo.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*Requestor{"jorrit": requestor}, list)
+
+	require.NoError(t, repo.Delete("jorrit"))
+	exists, err := repo.Exists("jorrit")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = repo.Get("jorrit")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, repo.Delete("jorrit"), ErrNotFound)
+}
+
+func TestRepositoryValidator(t *testing.T) {
+	errInvalid := errors.New("invalid")
+	repo := NewRepository[*ArcheType](setupEtcdClient(t), "/archetypes", WithValidator(func(data []byte) error {
+		return errInvalid
+	}))
+
+	assert.ErrorIs(t, repo.Create(&ArcheType{Name: "computeToData"}), errInvalid)
+}
+
+func TestRepositoryWatch(t *testing.T) {
+	repo := NewRepository[*ArcheType](setupEtcdClient(t), "/archetypes")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := repo.Watch(ctx)
+	require.NoError(t, repo.Create(&ArcheType{Name: "computeToData", RequestType: "sqlDataRequest"}))
+	require.NoError(t, repo.Delete("computeToData"))
+
+	for _, expected := range []RepositoryEventType{RepositoryEventPut, RepositoryEventDelete} {
+		select {
+		case event := <-events:
+			require.NoError(t, event.Err)
+			assert.Equal(t, expected, event.Type)
+			assert.Equal(t, "computeToData", event.Name)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for repository event")
+		}
+	}
+}
+
+func TestRepositoryInvalidName(t *testing.T) {
+	etcdClient := setupEtcdClient(t)
+	repo := NewRepository[*Requestor](etcdClient, "/reasoner/requestor_config")
+	other := NewRepository[*Requestor](etcdClient, "/reasoner")
+
+	for _, name := range []string{"", "../jorrit", "team/jorrit"} {
+		assert.ErrorIs(t, repo.Create(&Requestor{Name: name}), ErrInvalidName, name)
+		assert.ErrorIs(t, repo.Update(&Requestor{Name: name}), ErrInvalidName, name)
+		assert.ErrorIs(t, repo.Delete(name), ErrInvalidName, name)
+
+		_, err := repo.Get(name)
+		assert.ErrorIs(t, err, ErrInvalidName, name)
+		_, err = repo.Exists(name)
+		assert.ErrorIs(t, err, ErrInvalidName, name)
+	}
+
+	list, err := other.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
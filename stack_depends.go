@@ -0,0 +1,123 @@
+package GoLib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Conditions of a dependency, like in compose.
+const (
+	// DependencyStarted waits until the tasks of the dependency are running, it is the default.
+	DependencyStarted = "service_started"
+	// DependencyHealthy waits until the tasks are healthy. Swarm only reports a task with a
+	// healthcheck as running once it is healthy, so this is the same as DependencyStarted.
+	DependencyHealthy = "service_healthy"
+	// DependencyCompleted waits until a task of the dependency exited successfully.
+	DependencyCompleted = "service_completed_successfully"
+)
+
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// StartupOrder returns the names of the services so that every service comes after the services
+// it depends on. Services that do not depend on each other are sorted by name. Dependencies that
+// are not required may be missing, a missing required dependency or a cycle is an error.
+func StartupOrder(services map[string]MicroServiceDetails) ([]string, error) {
+	order, failed := startupOrder(services)
+	for _, name := range sortedServiceNames(services) {
+		if err, ok := failed[name]; ok {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// startupOrder orders the services like StartupOrder, but leaves out the services with a missing
+// dependency or in a cycle, and the services depending on them, with the error for each of them.
+func startupOrder(services map[string]MicroServiceDetails) ([]string, map[string]error) {
+	order := make([]string, 0, len(services))
+	failed := make(map[string]error)
+	// A service is visiting while its dependencies are added, done once it is added itself
+	const visiting, done = 1, 2
+	state := make(map[string]int)
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if err, ok := failed[name]; ok {
+			return err
+		}
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(append(path[start:], name), " -> "))
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dependency := range services[name].dependencyNames() {
+			if _, ok := services[dependency]; !ok {
+				if services[name].DependsOn[dependency].required() {
+					failed[name] = fmt.Errorf("service %s depends on undefined service %s", name, dependency)
+					return failed[name]
+				}
+				continue
+			}
+			if err := visit(dependency, path); err != nil {
+				failed[name] = err
+				return err
+			}
+		}
+
+		state[name] = done
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range sortedServiceNames(services) {
+		if err := visit(name, nil); err != nil {
+			failed[name] = err
+		}
+	}
+	return order, failed
+}
+
+func sortedServiceNames(services map[string]MicroServiceDetails) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WaitForDependency blocks until a service (by name or ID) meets the condition of a dependency on it.
+func WaitForDependency(ctx context.Context, cli DockerClient, serviceID string, condition string, opts ...WaitOption) error {
+	switch condition {
+	case DependencyStarted, DependencyHealthy, "":
+		return WaitForService(ctx, cli, serviceID, opts...)
+	case DependencyCompleted:
+		return WaitForServiceCompletion(ctx, cli, serviceID, opts...)
+	default:
+		return fmt.Errorf("unknown dependency condition %q", condition)
+	}
+}
+
+func (d MicroServiceDetails) dependencyNames() []string {
+	names := make([]string, 0, len(d.DependsOn))
+	for name := range d.DependsOn {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (d Dependency) required() bool {
+	return d.Required == nil || *d.Required
+}
@@ -0,0 +1,169 @@
+package GoLib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupOrder(t *testing.T) {
+	optional := false
+	services := map[string]MicroServiceDetails{
+		"query":     {DependsOn: map[string]Dependency{"mysql": {Condition: DependencyHealthy}, "rabbitmq": {}}},
+		"anonymize": {DependsOn: map[string]Dependency{"query": {}, "metrics": {Required: &optional}}},
+		"rabbitmq":  {},
+		"mysql":     {DependsOn: map[string]Dependency{"migrate": {Condition: DependencyCompleted}}},
+		"migrate":   {},
+	}
+
+	order, err := StartupOrder(services)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"migrate", "mysql", "rabbitmq", "query", "anonymize"}, order)
+
+	services["migrate"] = MicroServiceDetails{DependsOn: map[string]Dependency{"query": {}}}
+	_, err = StartupOrder(services)
+	assert.ErrorIs(t, err, ErrDependencyCycle)
+	assert.ErrorContains(t, err, "query -> mysql -> migrate -> query")
+
+	services["migrate"] = MicroServiceDetails{DependsOn: map[string]Dependency{"schema": {}}}
+	_, err = StartupOrder(services)
+	assert.ErrorContains(t, err, "service migrate depends on undefined service schema")
+}
+
+func TestUnmarshalDependsOn(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": `version: '3.9'
+services:
+  query:
+    image: query_service
+    depends_on:
+      mysql:
+        condition: service_healthy
+      rabbitmq:
+        required: false
+  anonymize:
+    image: anonymize_service
+    depends_on: [query]
+  mysql:
+    image: mysql
+`,
+	})
+	stackFile := filepath.Join(dir, "docker-compose.yml")
+
+	stack, err := UnmarshalStackFile(stackFile)
+	require.NoError(t, err)
+	optional := false
+	assert.Equal(t, map[string]Dependency{
+		"mysql":    {Condition: DependencyHealthy},
+		"rabbitmq": {Condition: DependencyStarted, Required: &optional},
+	}, stack.Services["query"].DependsOn)
+	assert.Equal(t, map[string]Dependency{"query": {Condition: DependencyStarted}}, stack.Services["anonymize"].DependsOn)
+
+	// Both forms are written back as they were read
+	require.NoError(t, WriteStackFile(stackFile, stack, ExternalDockerConfig{}))
+	written, err := UnmarshalStackFile(stackFile)
+	require.NoError(t, err)
+	assert.Equal(t, stack, written)
+}
+
+func TestValidateDependsOn(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": `services:
+  query:
+    image: query_service
+    depends_on:
+      mysql:
+        condition: service_ready
+      query:
+        condition: service_started
+  anonymize:
+    image: anonymize_service
+    depends_on: [rabbitmq]
+`,
+	})
+
+	err := ValidateStackFile(filepath.Join(dir, "docker-compose.yml"))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `:6:9: service query: depends_on.mysql: unknown condition "service_ready"`)
+	assert.ErrorContains(t, err, ":5:7: service query: depends_on: service mysql is not defined")
+	assert.ErrorContains(t, err, ":7:7: service query: depends_on: service can not depend on itself")
+	assert.ErrorContains(t, err, ":11:18: service anonymize: depends_on: service rabbitmq is not defined")
+}
+
+func TestDeployStackDependsOn(t *testing.T) {
+	stackFile := filepath.Join(t.TempDir(), "stack.yml")
+	require.NoError(t, os.WriteFile(stackFile, []byte(`
+version: '3.9'
+services:
+  anonymize:
+    image: anonymize_service
+    depends_on: [query]
+  query:
+    image: query_service
+    depends_on:
+      rabbitmq:
+        condition: service_healthy
+  rabbitmq:
+    image: rabbitmq
+`), 0644))
+
+	fake := NewFakeSwarm()
+	require.NoError(t, DeployStack(fake, stackFile, "demo", StackWaitForDependencies(WaitTimeout(time.Second), WaitPollInterval(10*time.Millisecond))))
+
+	// Fake IDs are increasing, so they show the order services were created in
+	services, err := fake.ServiceList(context.Background(), types.ServiceListOptions{})
+	require.NoError(t, err)
+	sort.Slice(services, func(i, j int) bool { return services[i].ID < services[j].ID })
+	names := []string{}
+	for _, service := range services {
+		names = append(names, service.Spec.Name)
+	}
+	assert.Equal(t, []string{"demo_rabbitmq", "demo_query", "demo_anonymize"}, names)
+
+	// A dependency that does not get ready stops the deploy before its dependents are created
+	require.NoError(t, os.WriteFile(stackFile, []byte(`
+version: '3.9'
+services:
+  migrate:
+    image: migrate
+  report:
+    image: report_service
+    depends_on:
+      migrate:
+        condition: service_completed_successfully
+`), 0644))
+	err = DeployStack(fake, stackFile, "demo", StackWaitForDependencies(WaitTimeout(50*time.Millisecond), WaitPollInterval(10*time.Millisecond)))
+	assert.ErrorIs(t, err, ErrServiceNotConverged)
+	assert.ErrorContains(t, err, "service report: dependency demo_migrate did not become ready")
+	_, _, err = fake.ServiceInspectWithRaw(context.Background(), "demo_report", types.ServiceInspectOptions{})
+	assert.Error(t, err)
+}
+
+func TestWaitForServiceCompletion(t *testing.T) {
+	fake := NewFakeSwarm()
+	id := createFakeService(t, fake, CreateServicePayload{ImageName: "migrate"})
+
+	err := WaitForDependency(context.Background(), fake, id, DependencyCompleted, WaitTimeout(50*time.Millisecond), WaitPollInterval(10*time.Millisecond))
+	assert.ErrorIs(t, err, ErrServiceNotConverged)
+
+	require.NoError(t, fake.UpdateTasks(id, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateComplete
+	}))
+	err = WaitForDependency(context.Background(), fake, id, DependencyCompleted, WaitTimeout(time.Second), WaitPollInterval(10*time.Millisecond))
+	assert.NoError(t, err)
+
+	require.NoError(t, fake.UpdateTasks(id, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateFailed
+		task.Status.Err = "task: non-zero exit (1)"
+	}))
+	err = WaitForServiceCompletion(context.Background(), fake, id, WaitTimeout(time.Second), WaitPollInterval(10*time.Millisecond), WaitMaxTaskFailures(1))
+	assert.ErrorIs(t, err, ErrTaskFailed)
+}
@@ -0,0 +1,667 @@
+package GoLib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+type StackOption func(*stackOptions)
+
+type stackOptions struct {
+	env       map[string]string
+	envFile   string
+	overrides []string
+	// profiles is nil when no profiles are selected, then COMPOSE_PROFILES is used
+	profiles []string
+	enable   []string
+	disable  []string
+	// waitOpts are used by DeployStack when waitForDependencies is set
+	waitForDependencies bool
+	waitOpts            []WaitOption
+}
+
+// StackEnvironment sets the variables used for interpolation, instead of the environment of the process.
+func StackEnvironment(env map[string]string) StackOption {
+	return func(o *stackOptions) {
+		o.env = env
+	}
+}
+
+// StackEnvFile reads default values for interpolation from another file than the .env next to the stack file.
+func StackEnvFile(fileName string) StackOption {
+	return func(o *stackOptions) {
+		o.envFile = fileName
+	}
+}
+
+// StackOverrideFiles merges files over the stack file, in order, like passing several files to
+// docker compose. See LoadStackFiles for how files are merged.
+func StackOverrideFiles(fileNames ...string) StackOption {
+	return func(o *stackOptions) {
+		o.overrides = append(o.overrides, fileNames...)
+	}
+}
+
+// StackWaitForDependencies makes DeployStack wait until the dependencies of a service meet their
+// condition before deploying it. Every wait times out after 2 minutes, unless opts set another timeout.
+func StackWaitForDependencies(opts ...WaitOption) StackOption {
+	return func(o *stackOptions) {
+		o.waitForDependencies = true
+		o.waitOpts = append([]WaitOption{WaitTimeout(2 * time.Minute)}, opts...)
+	}
+}
+
+// stackDocument is a loaded stack file, origins holds the file every node was read from.
+type stackDocument struct {
+	root    *yamlv3.Node
+	origins map[*yamlv3.Node]string
+}
+
+// loadStackFile reads and validates a stack file, prepared like compose before it is parsed.
+// The returned YAML is empty for an empty stack file.
+func loadStackFile(fileLocation string, opts ...StackOption) ([]byte, error) {
+	document, err := loadStackDocument(fileLocation, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if document.root == nil {
+		return nil, nil
+	}
+
+	if err := validateStackDocument(document); err != nil {
+		return nil, err
+	}
+	return yamlv3.Marshal(document.root)
+}
+
+// loadStackDocument reads a stack file and prepares it like compose: variables in values are
+// interpolated, services that extend other services are resolved, override files are merged,
+// services that are not selected are removed and the env_file entries of services are added to
+// their environment.
+// Variables come from the process environment, or StackEnvironment, with the .env file next to
+// the stack file providing defaults. Relative paths are relative to the directory of the stack file,
+// except for env_file entries which are relative to the file that declares them.
+func loadStackDocument(fileLocation string, opts ...StackOption) (stackDocument, error) {
+	options := stackOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	workingDir := filepath.Dir(fileLocation)
+	variables, err := stackVariables(workingDir, options)
+	if err != nil {
+		return stackDocument{}, err
+	}
+
+	document := stackDocument{origins: make(map[*yamlv3.Node]string)}
+	for _, fileName := range append([]string{fileLocation}, options.overrides...) {
+		root, err := readStackDocument(fileName, variables, document.origins)
+		if err != nil {
+			return stackDocument{}, err
+		}
+		if root == nil {
+			continue
+		}
+
+		resolver := extendsResolver{
+			variables: variables,
+			documents: map[string]*yamlv3.Node{fileName: root},
+			origins:   document.origins,
+		}
+		if err := resolver.resolveAll(fileName); err != nil {
+			return stackDocument{}, fmt.Errorf("failed to resolve extends in stack file %s: %w", fileName, err)
+		}
+		document.root = mergeStackNodes(document.root, root, nil)
+	}
+
+	// An empty file has no content to prepare
+	if document.root == nil {
+		return document, nil
+	}
+
+	if err := selectServices(document.root, options, variables); err != nil {
+		return stackDocument{}, fmt.Errorf("failed to select services of stack file %s: %w", fileLocation, err)
+	}
+	lookup := environmentLookup(variables)
+	resolveEnvironment(document.root, lookup)
+	if err := addEnvFiles(document, workingDir, lookup); err != nil {
+		return stackDocument{}, fmt.Errorf("failed to load env files of stack file %s: %w", fileLocation, err)
+	}
+	return document, nil
+}
+
+// readStackDocument reads and interpolates a stack file, it returns the top level mapping or nil
+// for an empty file. The file of every node is added to origins.
+func readStackDocument(fileLocation string, variables map[string]string, origins map[*yamlv3.Node]string) (*yamlv3.Node, error) {
+	data, err := os.ReadFile(fileLocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stack file %s: %w", fileLocation, err)
+	}
+
+	document := yamlv3.Node{}
+	if err := yamlv3.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse stack file %s: %w", fileLocation, err)
+	}
+	if document.Kind == 0 {
+		return nil, nil
+	}
+
+	root := expandAliases(document.Content[0])
+	if root.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("stack file %s must contain a mapping", fileLocation)
+	}
+
+	lookup := func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	}
+	if err := interpolateNode(root, lookup); err != nil {
+		return nil, fmt.Errorf("failed to interpolate stack file %s: %w", fileLocation, err)
+	}
+
+	addOrigins(root, fileLocation, origins)
+	return root, nil
+}
+
+// expandAliases replaces aliases by copies of the nodes they refer to and applies merge keys ("<<"),
+// so the nodes of every service can be merged and validated on their own.
+func expandAliases(node *yamlv3.Node) *yamlv3.Node {
+	if node.Kind == yamlv3.AliasNode {
+		node = copyNode(node.Alias, nil)
+	}
+	node.Anchor = ""
+	for i, child := range node.Content {
+		node.Content[i] = expandAliases(child)
+	}
+	if node.Kind != yamlv3.MappingNode {
+		return node
+	}
+
+	var content, merged []*yamlv3.Node
+	keys := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Tag != "!!merge" && key.Value != "<<" {
+			content = append(content, key, value)
+			keys[key.Value] = true
+			continue
+		}
+
+		sources := []*yamlv3.Node{value}
+		if value.Kind == yamlv3.SequenceNode {
+			sources = value.Content
+		}
+		merged = append(merged, sources...)
+	}
+
+	// Keys of the mapping itself win over merged keys, earlier merged mappings over later ones
+	for _, source := range merged {
+		for i := 0; i+1 < len(source.Content); i += 2 {
+			if !keys[source.Content[i].Value] {
+				content = append(content, copyNode(source.Content[i], nil), copyNode(source.Content[i+1], nil))
+				keys[source.Content[i].Value] = true
+			}
+		}
+	}
+	node.Content = content
+	return node
+}
+
+func addOrigins(node *yamlv3.Node, fileLocation string, origins map[*yamlv3.Node]string) {
+	origins[node] = fileLocation
+	for _, child := range node.Content {
+		addOrigins(child, fileLocation, origins)
+	}
+}
+
+func stackVariables(workingDir string, options stackOptions) (map[string]string, error) {
+	envFile, required := options.envFile, true
+	if envFile == "" {
+		envFile, required = filepath.Join(workingDir, ".env"), false
+	}
+
+	variables, err := ReadEnvFile(envFile)
+	if os.IsNotExist(err) && !required {
+		variables, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	env := options.env
+	if env == nil {
+		env = make(map[string]string)
+		for _, variable := range os.Environ() {
+			if name, value, ok := strings.Cut(variable, "="); ok {
+				env[name] = value
+			}
+		}
+	}
+	for name, value := range env {
+		variables[name] = value
+	}
+	return variables, nil
+}
+
+// interpolateNode interpolates all scalar values, keys of mappings are left as they are. Unquoted
+// values get their type from the interpolated value, so "replicas: ${REPLICAS}" becomes a number.
+func interpolateNode(node *yamlv3.Node, lookup func(string) (string, bool)) error {
+	switch node.Kind {
+	case yamlv3.ScalarNode:
+		value, err := Interpolate(node.Value, lookup)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		if value != node.Value {
+			node.Value = value
+			if node.Style&(yamlv3.SingleQuotedStyle|yamlv3.DoubleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+				node.Tag = ""
+			}
+		}
+
+	case yamlv3.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolateNode(node.Content[i], lookup); err != nil {
+				return err
+			}
+		}
+
+	case yamlv3.DocumentNode, yamlv3.SequenceNode:
+		for _, child := range node.Content {
+			if err := interpolateNode(child, lookup); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Interpolate replaces variables in a value following the compose rules:
+// $VAR and ${VAR} are replaced by the value of VAR, or nothing when it is not set;
+// ${VAR:-default} and ${VAR-default} use the default when VAR is unset or empty, or only when unset;
+// ${VAR:?error} and ${VAR?error} fail with the error when VAR is unset or empty, or only when unset;
+// ${VAR:+replacement} and ${VAR+replacement} use the replacement when VAR is set and not empty, or set;
+// and $$ is a literal $. Defaults, errors and replacements are interpolated as well.
+func Interpolate(value string, lookup func(string) (string, bool)) (string, error) {
+	var result strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' {
+			result.WriteByte(value[i])
+			continue
+		}
+		if i+1 == len(value) {
+			result.WriteByte('$')
+			break
+		}
+
+		switch next := value[i+1]; {
+		case next == '$':
+			result.WriteByte('$')
+			i++
+
+		case next == '{':
+			end, err := closingBrace(value, i+2)
+			if err != nil {
+				return "", err
+			}
+			replaced, err := substitute(value[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(replaced)
+			i = end
+
+		case isNameStart(next):
+			end := i + 2
+			for end < len(value) && isNameChar(value[end]) {
+				end++
+			}
+			variable, _ := lookup(value[i+1 : end])
+			result.WriteString(variable)
+			i = end - 1
+
+		default:
+			return "", fmt.Errorf("invalid interpolation format in %q, use $$ for a literal $", value)
+		}
+	}
+
+	return result.String(), nil
+}
+
+// closingBrace finds the } closing the ${ before start, skipping over nested ${...}.
+func closingBrace(value string, start int) (int, error) {
+	depth := 1
+	for i := start; i < len(value); i++ {
+		switch {
+		case value[i] == '$' && i+1 < len(value) && value[i+1] == '$':
+			i++
+		case value[i] == '$' && i+1 < len(value) && value[i+1] == '{':
+			depth++
+			i++
+		case value[i] == '}':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid interpolation format in %q, missing }", value)
+}
+
+// substitute resolves the expression between ${ and }.
+func substitute(expression string, lookup func(string) (string, bool)) (string, error) {
+	end := 0
+	for end < len(expression) && isNameChar(expression[end]) {
+		end++
+	}
+	name, operator := expression[:end], expression[end:]
+	if name == "" || !isNameStart(name[0]) {
+		return "", fmt.Errorf("invalid interpolation format in ${%s}", expression)
+	}
+
+	variable, set := lookup(name)
+	if operator == "" {
+		return variable, nil
+	}
+
+	// Operators with a colon also treat an empty variable as unset
+	unset := !set
+	if strings.HasPrefix(operator, ":") {
+		unset = !set || variable == ""
+		operator = operator[1:]
+	}
+	if operator == "" {
+		return "", fmt.Errorf("invalid interpolation format in ${%s}", expression)
+	}
+
+	argument := func() (string, error) {
+		return Interpolate(operator[1:], lookup)
+	}
+	switch operator[0] {
+	case '-':
+		if unset {
+			return argument()
+		}
+		return variable, nil
+	case '?':
+		if unset {
+			message, err := argument()
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("required variable %s is missing a value: %s", name, message)
+		}
+		return variable, nil
+	case '+':
+		if !unset {
+			return argument()
+		}
+		return "", nil
+	default:
+		return "", fmt.Errorf("invalid interpolation format in ${%s}", expression)
+	}
+}
+
+func isName(name string) bool {
+	if name == "" || !isNameStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// environmentLookup looks up the value of an environment variable without a value, like "- FOO".
+// The stack variables come first, then the process environment.
+func environmentLookup(variables map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if value, ok := variables[name]; ok {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}
+}
+
+// resolveEnvironment sets the value of the environment variables of services that are listed
+// without a value. Variables that are not set anywhere are left out of the environment.
+func resolveEnvironment(root *yamlv3.Node, lookup func(string) (string, bool)) {
+	services := mappingValue(root, "services")
+	if services == nil || services.Kind != yamlv3.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		environment := mappingValue(services.Content[i+1], "environment")
+		if environment == nil {
+			continue
+		}
+
+		switch environment.Kind {
+		case yamlv3.SequenceNode:
+			content := environment.Content[:0]
+			for _, item := range environment.Content {
+				if !strings.Contains(item.Value, "=") {
+					value, ok := lookup(item.Value)
+					if !ok {
+						continue
+					}
+					item = stringNode(item.Value + "=" + value)
+				}
+				content = append(content, item)
+			}
+			environment.Content = content
+		case yamlv3.MappingNode:
+			content := environment.Content[:0]
+			for j := 0; j+1 < len(environment.Content); j += 2 {
+				name, value := environment.Content[j], environment.Content[j+1]
+				if value.ShortTag() == "!!null" {
+					resolved, ok := lookup(name.Value)
+					if !ok {
+						continue
+					}
+					value = stringNode(resolved)
+				}
+				content = append(content, name, value)
+			}
+			environment.Content = content
+		}
+	}
+}
+
+// addEnvFiles adds the variables of the env_file entries of every service to its environment,
+// variables set in environment take precedence. The environment is rewritten in list form.
+// Relative env_file paths are relative to the file the entry was read from, which can be an
+// override file or a file extended by the service.
+func addEnvFiles(document stackDocument, workingDir string, lookup func(string) (string, bool)) error {
+	services := mappingValue(document.root, "services")
+	if services == nil || services.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		serviceName, service := services.Content[i].Value, services.Content[i+1]
+		envFile := mappingValue(service, "env_file")
+		if envFile == nil || envFile.ShortTag() == "!!null" {
+			continue
+		}
+
+		entries := []*yamlv3.Node{envFile}
+		if envFile.Kind == yamlv3.SequenceNode {
+			entries = envFile.Content
+		}
+
+		variables := make(map[string]string)
+		for _, entry := range entries {
+			if entry.Kind != yamlv3.ScalarNode {
+				return fmt.Errorf("service %s: env_file must be a file name or a list of file names", serviceName)
+			}
+
+			fileName := entry.Value
+			if !filepath.IsAbs(fileName) {
+				dir := workingDir
+				if origin, ok := document.origins[entry]; ok {
+					dir = filepath.Dir(origin)
+				}
+				fileName = filepath.Join(dir, fileName)
+			}
+			fileVariables, err := readEnvFile(fileName, lookup)
+			if err != nil {
+				return fmt.Errorf("service %s: %w", serviceName, err)
+			}
+			for name, value := range fileVariables {
+				variables[name] = value
+			}
+		}
+
+		names := make([]string, 0, len(variables))
+		for name := range variables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		environment := &yamlv3.Node{Kind: yamlv3.SequenceNode}
+		for _, name := range names {
+			environment.Content = append(environment.Content, stringNode(name+"="+variables[name]))
+		}
+
+		// Later entries win when the list is parsed, so the environment of the service goes last
+		if existing := mappingValue(service, "environment"); existing != nil {
+			switch existing.Kind {
+			case yamlv3.SequenceNode:
+				environment.Content = append(environment.Content, existing.Content...)
+			case yamlv3.MappingNode:
+				for j := 0; j+1 < len(existing.Content); j += 2 {
+					name, value := existing.Content[j].Value, existing.Content[j+1]
+					if value.ShortTag() == "!!null" {
+						environment.Content = append(environment.Content, stringNode(name))
+					} else {
+						environment.Content = append(environment.Content, stringNode(name+"="+value.Value))
+					}
+				}
+			}
+		}
+
+		removeMappingKey(service, "env_file")
+		removeMappingKey(service, "environment")
+		service.Content = append(service.Content, stringNode("environment"), environment)
+	}
+
+	return nil
+}
+
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func removeMappingKey(node *yamlv3.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func stringNode(value string) *yamlv3.Node {
+	return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// ReadEnvFile reads a file with a "NAME=value" variable per line, like the .env and env_file files
+// of compose. Empty lines and lines starting with # are skipped, and a leading "export " is ignored.
+// Values in single quotes are taken literally, values in double quotes support Go escapes like \n
+// and \", and unquoted values end at " #".
+func ReadEnvFile(fileName string) (map[string]string, error) {
+	return readEnvFile(fileName, os.LookupEnv)
+}
+
+// readEnvFile reads an env file, the value of a name without a value is looked up with lookup.
+func readEnvFile(fileName string, lookup func(string) (string, bool)) (map[string]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	variables, err := parseEnvFile(file, lookup)
+	if err != nil {
+		return nil, fmt.Errorf("invalid env file %s: %w", fileName, err)
+	}
+	return variables, nil
+}
+
+func parseEnvFile(reader io.Reader, lookup func(string) (string, bool)) (map[string]string, error) {
+	variables := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !isName(name) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNumber, name)
+		}
+		if !ok {
+			// Like compose, a name without a value takes its value from the environment
+			if fromEnv, set := lookup(name); set {
+				variables[name] = fromEnv
+			}
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			value = unquoted
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		variables[name] = value
+	}
+
+	return variables, scanner.Err()
+}
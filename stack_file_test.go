@@ -0,0 +1,287 @@
+package GoLib
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"TAG": "1.2", "EMPTY": "", "NAME": "query"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	testCases := map[string]string{
+		"plain":                       "plain",
+		"image:$TAG":                  "image:1.2",
+		"image:${TAG}":                "image:1.2",
+		"${MISSING}":                  "",
+		"${MISSING:-latest}":          "latest",
+		"${EMPTY:-latest}":            "latest",
+		"${EMPTY-latest}":             "",
+		"${MISSING-latest}":           "latest",
+		"${TAG:-latest}":              "1.2",
+		"${MISSING:-${NAME}_default}": "query_default",
+		"${TAG:+set}":                 "set",
+		"${EMPTY:+set}":               "",
+		"${EMPTY+set}":                "set",
+		"$$TAG costs $$5":             "$TAG costs $5",
+		"${EMPTY?required}":           "",
+		"trailing $":                  "trailing $",
+	}
+	for value, expected := range testCases {
+		t.Run(value, func(t *testing.T) {
+			result, err := Interpolate(value, lookup)
+			require.NoError(t, err)
+			assert.Equal(t, expected, result)
+		})
+	}
+
+	_, err := Interpolate("${MISSING:?set MISSING to the host name}", lookup)
+	assert.ErrorContains(t, err, "set MISSING to the host name")
+	_, err = Interpolate("${EMPTY:?required}", lookup)
+	assert.Error(t, err)
+
+	for _, value := range []string{"${TAG", "$1", "${}", "${TAG:}", "${TAG!x}"} {
+		_, err := Interpolate(value, lookup)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	t.Setenv("GOLIB_TEST_FROM_ENV", "inherited")
+
+	variables, err := parseEnvFile(strings.NewReader(`
+# database settings
+DB_HOST=db
+export DB_PORT = 5432
+DB_NAME=mydb # inline comment
+SINGLE='literal $HOME \n'
+DOUBLE="line\nbreak"
+EMPTY=
+GOLIB_TEST_FROM_ENV
+GOLIB_TEST_NOT_SET
+`), os.LookupEnv)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"DB_HOST":             "db",
+		"DB_PORT":             "5432",
+		"DB_NAME":             "mydb",
+		"SINGLE":              `literal $HOME \n`,
+		"DOUBLE":              "line\nbreak",
+		"EMPTY":               "",
+		"GOLIB_TEST_FROM_ENV": "inherited",
+	}, variables)
+
+	_, err = parseEnvFile(strings.NewReader("1INVALID=x"), os.LookupEnv)
+	assert.Error(t, err)
+}
+
+func writeStackFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestUnmarshalStackFileInterpolation(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		".env":       "TAG=1.0\nREPLICAS=2\n",
+		"common.env": "LOG_LEVEL=info\nMODE=default\n",
+		"query.env":  "MODE=query\n",
+		"docker-compose.yml": `
+services:
+  query:
+    image: query_service:${TAG:-latest}
+    env_file:
+      - common.env
+      - query.env
+    environment:
+      DB_HOST: ${DB_HOST}
+      LOG_LEVEL: debug
+      PRICE: $$5
+    deploy:
+      replicas: ${REPLICAS}
+      labels:
+        version: "${TAG}"
+`,
+	})
+	stackFile := filepath.Join(dir, "docker-compose.yml")
+
+	stack, err := UnmarshalStackFile(stackFile, StackEnvironment(map[string]string{"DB_HOST": "db", "TAG": "1.1"}))
+	assert.NoError(t, err)
+	query := stack.Services["query"]
+	assert.Equal(t, "query_service", query.Image)
+	assert.Equal(t, "1.1", query.Tag)
+	assert.Equal(t, uint64(2), *query.Deploy.Replicas)
+	assert.Equal(t, Labels{"version": "1.1"}, query.Deploy.Labels)
+	assert.Equal(t, map[string]string{
+		"DB_HOST":   "db",
+		"LOG_LEVEL": "debug",
+		"MODE":      "query",
+		"PRICE":     "$5",
+	}, query.EnvVars)
+
+	// Without the environment the .env file provides the tag
+	stack, err = UnmarshalStackFile(stackFile, StackEnvironment(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0", stack.Services["query"].Tag)
+
+	_, err = loadStackFile(stackFile, StackEnvFile(filepath.Join(dir, "missing.env")))
+	assert.Error(t, err)
+}
+
+func TestUnmarshalStackFileEnvironmentWithoutValue(t *testing.T) {
+	t.Setenv("GOLIB_TEST_PROCESS", "process")
+	t.Setenv("GOLIB_TEST_OVERRIDDEN", "process")
+
+	dir := writeStackFiles(t, map[string]string{
+		"query.env": "GOLIB_TEST_FROM_FILE\n",
+		"docker-compose.yml": `
+services:
+  query:
+    image: query_service
+    env_file: query.env
+    environment:
+      - GOLIB_TEST_OVERRIDDEN
+      - GOLIB_TEST_PROCESS
+      - GOLIB_TEST_NOT_SET
+  worker:
+    image: worker
+    environment:
+      GOLIB_TEST_OVERRIDDEN:
+      GOLIB_TEST_NOT_SET:
+`,
+	})
+
+	stack, err := UnmarshalStackFile(filepath.Join(dir, "docker-compose.yml"), StackEnvironment(map[string]string{
+		"GOLIB_TEST_OVERRIDDEN": "stack",
+		"GOLIB_TEST_FROM_FILE":  "stack",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"GOLIB_TEST_FROM_FILE":  "stack",
+		"GOLIB_TEST_OVERRIDDEN": "stack",
+		"GOLIB_TEST_PROCESS":    "process",
+	}, stack.Services["query"].EnvVars)
+	assert.Equal(t, map[string]string{"GOLIB_TEST_OVERRIDDEN": "stack"}, stack.Services["worker"].EnvVars)
+}
+
+func TestUnmarshalStackFileEnvFileRelativeToDeclaringFile(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": "services:\n  query:\n    extends:\n      file: common/base.yml\n      service: base\n",
+	})
+	for name, content := range map[string]string{
+		"common/base.yml":       "services:\n  base:\n    image: query_service\n    env_file:\n      - base.env\n",
+		"common/base.env":       "FROM_BASE=base\n",
+		"override/stack.yml":    "services:\n  query:\n    env_file:\n      - override.env\n",
+		"override/override.env": "FROM_OVERRIDE=override\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	stack, err := UnmarshalStackFile(filepath.Join(dir, "docker-compose.yml"),
+		StackOverrideFiles(filepath.Join(dir, "override", "stack.yml")), StackEnvironment(map[string]string{}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"FROM_BASE":     "base",
+		"FROM_OVERRIDE": "override",
+	}, stack.Services["query"].EnvVars)
+}
+
+func TestLoadStackFileErrors(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"required.yml": "services:\n  query:\n    image: query_service:${TAG:?TAG must be set}\n",
+		"env_file.yml": "services:\n  query:\n    image: query_service\n    env_file: missing.env\n",
+	})
+
+	_, err := loadStackFile(filepath.Join(dir, "required.yml"), StackEnvironment(map[string]string{}))
+	assert.ErrorContains(t, err, "TAG must be set")
+	assert.ErrorContains(t, err, "line 3")
+
+	_, err = loadStackFile(filepath.Join(dir, "env_file.yml"))
+	assert.ErrorContains(t, err, "missing.env")
+}
+
+func TestUnmarshalStackFileDeploy(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": `services:
+  collector:
+    image: log_collector
+    deploy:
+      mode: global
+      endpoint_mode: dnsrr
+      placement:
+        constraints: [node.platform.os == linux]
+        preferences:
+          - spread: node.labels.zone
+      resources:
+        limits:
+          cpus: "0.25"
+          memory: 64M
+        reservations:
+          generic_resources:
+            - discrete_resource_spec:
+                kind: gpu
+                value: 1
+      restart_policy:
+        condition: on-failure
+        max_attempts: 3
+      update_config:
+        parallelism: 2
+        order: start-first
+      rollback_config:
+        parallelism: 0
+        failure_action: pause
+  query:
+    image: query_service
+    deploy:
+      replicas: 4
+      placement:
+        max_replicas_per_node: 2
+`,
+	})
+	stackFile := filepath.Join(dir, "docker-compose.yml")
+
+	stack, err := UnmarshalStackFile(stackFile)
+	require.NoError(t, err)
+
+	maxAttempts, parallelism, noParallelism := uint64(3), uint64(2), uint64(0)
+	assert.Equal(t, Deploy{
+		Mode:         "global",
+		EndpointMode: "dnsrr",
+		Placement: Placement{
+			Constraints: []string{"node.platform.os == linux"},
+			Preferences: []PlacementPreference{{Spread: "node.labels.zone"}},
+		},
+		Resources: Resources{
+			Limits: Resource{Cpus: "0.25", Memory: "64M"},
+			Reservations: Resource{GenericResources: []GenericResource{
+				{DiscreteResourceSpec: &DiscreteGenericResource{Kind: "gpu", Value: 1}},
+			}},
+		},
+		RestartPolicy:  &RestartPolicy{Condition: "on-failure", MaxAttempts: &maxAttempts},
+		UpdateConfig:   &UpdateConfig{Parallelism: &parallelism, Order: "start-first"},
+		RollbackConfig: &UpdateConfig{Parallelism: &noParallelism, FailureAction: "pause"},
+	}, stack.Services["collector"].Deploy)
+	assert.Equal(t, uint64(2), stack.Services["query"].Deploy.Placement.MaxReplicas)
+
+	// The full deploy section is kept when the services are stored and written back
+	data, err := json.Marshal(stack.Services["collector"])
+	require.NoError(t, err)
+	assert.NoError(t, ValidateJSONFor[MicroServiceDetails](data))
+	written := filepath.Join(dir, "written.yml")
+	require.NoError(t, WriteStackFile(written, stack, ExternalDockerConfig{}))
+	again, err := UnmarshalStackFile(written)
+	require.NoError(t, err)
+	assert.Equal(t, stack, again)
+}
@@ -0,0 +1,280 @@
+package GoLib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// LoadStackFiles reads a stack file with override files merged over it in order, like passing
+// several files to docker compose. Mappings are merged, values in later files win. Lists are
+// appended, without duplicates, except that ports and volumes replace the entry with the same
+// target and secrets and configs the entry with the same source. Command, entrypoint and the
+// healthcheck test are replaced as a whole. Environment, labels and networks are merged by name,
+// whether they are written as a list or as a map.
+// Within every file, services with extends are first merged over the service they extend, which
+// can be in another file.
+func LoadStackFiles(fileLocations []string, opts ...StackOption) (MicroServiceData, ExternalDockerConfig, error) {
+	if len(fileLocations) == 0 {
+		return MicroServiceData{}, ExternalDockerConfig{}, fmt.Errorf("no stack files given")
+	}
+
+	opts = append(opts, StackOverrideFiles(fileLocations[1:]...))
+	data, err := loadStackFile(fileLocations[0], opts...)
+	if err != nil {
+		return MicroServiceData{}, ExternalDockerConfig{}, err
+	}
+
+	stack := MicroServiceData{}
+	if err := yaml.Unmarshal(data, &stack); err != nil {
+		return MicroServiceData{}, ExternalDockerConfig{}, fmt.Errorf("failed to parse stack files: %w", err)
+	}
+	external := ExternalDockerConfig{}
+	if err := yaml.Unmarshal(data, &external); err != nil {
+		return MicroServiceData{}, ExternalDockerConfig{}, fmt.Errorf("failed to parse stack files: %w", err)
+	}
+
+	return stack, external, nil
+}
+
+// mergeStackNodes merges override into base and returns the result, base may be changed.
+// Path holds the keys leading to the nodes, to apply the rules of specific service fields.
+func mergeStackNodes(base *yamlv3.Node, override *yamlv3.Node, path []string) *yamlv3.Node {
+	if base == nil {
+		return override
+	}
+
+	field := serviceField(path)
+	switch field {
+	case "command", "entrypoint", "healthcheck.test":
+		return override
+	case "environment", "labels", "deploy.labels", "networks":
+		base, override = listToMapping(base, field), listToMapping(override, field)
+	}
+
+	switch {
+	case base.Kind == yamlv3.MappingNode && override.Kind == yamlv3.MappingNode:
+		for i := 0; i+1 < len(override.Content); i += 2 {
+			key, value := override.Content[i], override.Content[i+1]
+
+			merged := false
+			for j := 0; j+1 < len(base.Content); j += 2 {
+				if base.Content[j].Value == key.Value {
+					base.Content[j+1] = mergeStackNodes(base.Content[j+1], value, append(path[:len(path):len(path)], key.Value))
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				base.Content = append(base.Content, key, value)
+			}
+		}
+		return base
+
+	case base.Kind == yamlv3.SequenceNode && override.Kind == yamlv3.SequenceNode:
+		for _, item := range override.Content {
+			key := sequenceItemKey(field, item)
+
+			replaced := false
+			for j, existing := range base.Content {
+				if key != "" && sequenceItemKey(field, existing) == key {
+					base.Content[j] = item
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				base.Content = append(base.Content, item)
+			}
+		}
+		return base
+
+	default:
+		return override
+	}
+}
+
+// serviceField returns the dotted path within a service, like "deploy.labels", or "" outside of services.
+func serviceField(path []string) string {
+	if len(path) < 3 || path[0] != "services" {
+		return ""
+	}
+	return strings.Join(path[2:], ".")
+}
+
+// sequenceItemKey identifies the items of a list that replace each other when merging, items
+// without a key are always appended.
+func sequenceItemKey(field string, item *yamlv3.Node) string {
+	switch field {
+	case "ports":
+		if item.Kind == yamlv3.MappingNode {
+			return portKey(mappingScalar(item, "target"), mappingScalar(item, "protocol"))
+		}
+		if ports, err := ParsePortSpec(item.Value); err == nil && len(ports) == 1 {
+			return portKey(fmt.Sprint(ports[0].Target), ports[0].Protocol)
+		}
+		return item.Value
+
+	case "volumes":
+		if item.Kind == yamlv3.MappingNode {
+			return mappingScalar(item, "target")
+		}
+		if volume, err := ParseVolumeSpec(item.Value); err == nil {
+			return volume.Target
+		}
+		return item.Value
+
+	case "secrets", "configs":
+		if item.Kind == yamlv3.MappingNode {
+			return mappingScalar(item, "source")
+		}
+		return item.Value
+	}
+
+	if item.Kind == yamlv3.ScalarNode {
+		return item.Value
+	}
+	return ""
+}
+
+func portKey(target string, protocol string) string {
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return target + "/" + strings.ToLower(protocol)
+}
+
+func mappingScalar(node *yamlv3.Node, key string) string {
+	if value := mappingValue(node, key); value != nil && value.Kind == yamlv3.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// listToMapping converts the list form of environment and labels ("KEY=VALUE") and of networks
+// ("name") to the map form, so both forms can be merged.
+func listToMapping(node *yamlv3.Node, field string) *yamlv3.Node {
+	if node.Kind != yamlv3.SequenceNode {
+		return node
+	}
+
+	mapping := &yamlv3.Node{Kind: yamlv3.MappingNode, Line: node.Line, Column: node.Column}
+	for _, item := range node.Content {
+		key, value, ok := item.Value, "", false
+		if field != "networks" {
+			key, value, ok = strings.Cut(item.Value, "=")
+		}
+
+		// The item stays the key of networks, so problems found later point to the right place
+		keyNode, valueNode := item, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!null", Value: "null"}
+		if field != "networks" {
+			keyNode = &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key, Line: item.Line, Column: item.Column}
+		}
+		if ok {
+			valueNode = stringNode(value)
+		}
+		removeMappingKey(mapping, key)
+		mapping.Content = append(mapping.Content, keyNode, valueNode)
+	}
+	return mapping
+}
+
+// extendsResolver resolves the extends of services, documents caches the stack files by name.
+type extendsResolver struct {
+	variables map[string]string
+	documents map[string]*yamlv3.Node
+	origins   map[*yamlv3.Node]string
+}
+
+func (r *extendsResolver) resolveAll(fileLocation string) error {
+	services := mappingValue(r.documents[fileLocation], "services")
+	if services == nil || services.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		if _, err := r.resolve(fileLocation, services.Content[i].Value, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the service with its extends resolved, and stores it that way in its document.
+// Visiting holds the services being resolved, to detect cycles.
+func (r *extendsResolver) resolve(fileLocation string, name string, visiting []string) (*yamlv3.Node, error) {
+	document, ok := r.documents[fileLocation]
+	if !ok {
+		var err error
+		document, err = readStackDocument(fileLocation, r.variables, r.origins)
+		if err != nil {
+			return nil, err
+		}
+		if document == nil {
+			document = &yamlv3.Node{Kind: yamlv3.MappingNode}
+		}
+		r.documents[fileLocation] = document
+	}
+
+	services := mappingValue(document, "services")
+	service := mappingValue(services, name)
+	if services == nil || service == nil {
+		return nil, fmt.Errorf("service %s not found in %s", name, fileLocation)
+	}
+
+	extends := mappingValue(service, "extends")
+	if extends == nil {
+		return service, nil
+	}
+
+	id := fileLocation + ":" + name
+	for _, visited := range visiting {
+		if visited == id {
+			return nil, fmt.Errorf("service %s extends itself: %s", name, strings.Join(append(visiting, id), " -> "))
+		}
+	}
+
+	baseFile, baseName := fileLocation, extends.Value
+	if extends.Kind == yamlv3.MappingNode {
+		baseName = mappingScalar(extends, "service")
+		if file := mappingScalar(extends, "file"); file != "" {
+			baseFile = file
+			if !filepath.IsAbs(file) {
+				baseFile = filepath.Join(filepath.Dir(fileLocation), file)
+			}
+		}
+	}
+	if baseName == "" {
+		return nil, fmt.Errorf("service %s: extends requires a service", name)
+	}
+
+	base, err := r.resolve(baseFile, baseName, append(visiting, id))
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	removeMappingKey(service, "extends")
+	merged := mergeStackNodes(copyNode(base, r.origins), service, []string{"services", name})
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		if services.Content[i].Value == name {
+			services.Content[i+1] = merged
+		}
+	}
+	return merged, nil
+}
+
+// copyNode deep copies a node, as merging changes the base node. Copies keep the origin of the original.
+func copyNode(node *yamlv3.Node, origins map[*yamlv3.Node]string) *yamlv3.Node {
+	copied := *node
+	copied.Content = make([]*yamlv3.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child, origins)
+	}
+	if origin, ok := origins[node]; ok {
+		origins[&copied] = origin
+	}
+	return &copied
+}
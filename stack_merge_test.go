@@ -0,0 +1,143 @@
+package GoLib
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadStackFiles(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"base.yml": `
+services:
+  query:
+    image: query_service:1.0
+    command: ["serve", "--debug"]
+    environment:
+      - MODE=base
+      - DB_HOST=db
+    ports:
+      - "8080:80"
+      - "9090:90"
+    volumes:
+      - logs:/var/log
+    networks:
+      - core
+    deploy:
+      labels:
+        owner: team
+      placement:
+        constraints:
+          - node.role == worker
+networks:
+  core:
+    external: true
+`,
+		"prod.yml": `
+services:
+  query:
+    image: query_service:2.0
+    command: serve
+    environment:
+      MODE: prod
+    ports:
+      - target: 80
+        published: 80
+    volumes:
+      - /data/logs:/var/log
+    networks:
+      backend:
+        aliases: [api]
+    deploy:
+      labels:
+        - tier=prod
+      placement:
+        constraints:
+          - node.role == worker
+          - node.labels.zone == a
+  cache:
+    image: redis:7
+networks:
+  backend:
+`,
+	})
+
+	stack, external, err := LoadStackFiles([]string{filepath.Join(dir, "base.yml"), filepath.Join(dir, "prod.yml")})
+	require.NoError(t, err)
+
+	query := stack.Services["query"]
+	assert.Equal(t, "2.0", query.Tag)
+	assert.Equal(t, ShellCommand{"serve"}, query.Command)
+	assert.Equal(t, map[string]string{"MODE": "prod", "DB_HOST": "db"}, query.EnvVars)
+	assert.Equal(t, map[string]string{"9090": "90"}, query.Ports)
+	assert.Equal(t, []PortConfig{{Target: 80, Published: 80}}, query.PortConfigs)
+	assert.Empty(t, query.Volumes)
+	assert.Equal(t, []MountConfig{{Type: "bind", Source: "/data/logs", Target: "/var/log"}}, query.Mounts)
+	assert.Equal(t, map[string]Network{"core": {}, "backend": {Aliases: []string{"api"}}}, query.Networks)
+	assert.Equal(t, Labels{"owner": "team", "tier": "prod"}, query.Deploy.Labels)
+	assert.Equal(t, []string{"node.role == worker", "node.labels.zone == a"}, query.Deploy.Placement.Constraints)
+
+	assert.Equal(t, "redis", stack.Services["cache"].Image)
+
+	// Backend is declared by the override file without options, only core is external
+	sort.Strings(external.Networks)
+	assert.Equal(t, []string{"backend", "core"}, external.Networks)
+	assert.Equal(t, map[string]bool{"backend": false, "core": true}, external.ExternalNetworks)
+
+	_, _, err = LoadStackFiles(nil)
+	assert.Error(t, err)
+}
+
+func TestLoadStackFilesExtends(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"common.yml": `
+services:
+  base:
+    image: base_service:1.0
+    environment:
+      LOG_LEVEL: info
+    deploy:
+      replicas: 2
+`,
+		"docker-compose.yml": `
+services:
+  worker:
+    extends:
+      file: common.yml
+      service: base
+    environment:
+      QUEUE: jobs
+  debug_worker:
+    extends: worker
+    environment:
+      LOG_LEVEL: debug
+`,
+		"cycle.yml": `
+services:
+  a:
+    image: a
+    extends: b
+  b:
+    image: b
+    extends: a
+`,
+	})
+
+	stack, _, err := LoadStackFiles([]string{filepath.Join(dir, "docker-compose.yml")})
+	require.NoError(t, err)
+
+	worker := stack.Services["worker"]
+	assert.Equal(t, "base_service", worker.Image)
+	assert.Equal(t, uint64(2), *worker.Deploy.Replicas)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "info", "QUEUE": "jobs"}, worker.EnvVars)
+
+	debugWorker := stack.Services["debug_worker"]
+	assert.Equal(t, "base_service", debugWorker.Image)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "debug", "QUEUE": "jobs"}, debugWorker.EnvVars)
+
+	_, _, err = LoadStackFiles([]string{filepath.Join(dir, "cycle.yml")})
+	assert.ErrorContains(t, err, "extends itself")
+}
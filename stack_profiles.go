@@ -0,0 +1,152 @@
+package GoLib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// StackProfiles activates compose profiles. Services without profiles are always used, services
+// with profiles only when one of them is active. The profile "*" activates all profiles. Without
+// this option the profiles in the COMPOSE_PROFILES variable, separated by commas, are active.
+func StackProfiles(profiles ...string) StackOption {
+	return func(o *stackOptions) {
+		o.profiles = append([]string{}, profiles...)
+	}
+}
+
+// StackEnableServices uses services even when none of their profiles is active.
+func StackEnableServices(names ...string) StackOption {
+	return func(o *stackOptions) {
+		o.enable = append(o.enable, names...)
+	}
+}
+
+// StackDisableServices leaves services out, whatever their profiles are. Other services may not
+// require them.
+func StackDisableServices(names ...string) StackOption {
+	return func(o *stackOptions) {
+		o.disable = append(o.disable, names...)
+	}
+}
+
+// selectServices removes the services that are not selected by the profiles, enabled and disabled
+// services of options. Like compose, the services a selected service depends on are selected as well.
+func selectServices(root *yamlv3.Node, options stackOptions, variables map[string]string) error {
+	services := mappingValue(root, "services")
+	if services == nil || services.Kind != yamlv3.MappingNode {
+		return nil
+	}
+
+	profiles := options.profiles
+	if profiles == nil {
+		for _, profile := range strings.Split(variables["COMPOSE_PROFILES"], ",") {
+			if profile = strings.TrimSpace(profile); profile != "" {
+				profiles = append(profiles, profile)
+			}
+		}
+	}
+	active := make(map[string]bool)
+	for _, profile := range profiles {
+		active[profile] = true
+	}
+
+	disabled := make(map[string]bool)
+	for _, name := range options.disable {
+		disabled[name] = true
+	}
+
+	selected := make(map[string]bool)
+	queue := []string{}
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		name, service := services.Content[i].Value, services.Content[i+1]
+		if !disabled[name] && profileActive(service, active) {
+			selected[name] = true
+			queue = append(queue, name)
+		}
+	}
+	for _, name := range options.enable {
+		if mappingValue(services, name) == nil {
+			return fmt.Errorf("service %s to enable is not defined", name)
+		}
+		if disabled[name] {
+			return fmt.Errorf("service %s is both enabled and disabled", name)
+		}
+		if !selected[name] {
+			selected[name] = true
+			queue = append(queue, name)
+		}
+	}
+
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+
+		dependencies := serviceDependencies(mappingValue(services, name))
+		names := make([]string, 0, len(dependencies))
+		for dependency := range dependencies {
+			names = append(names, dependency)
+		}
+		sort.Strings(names)
+
+		for _, dependency := range names {
+			// Undefined dependencies are reported by the validator
+			if selected[dependency] || mappingValue(services, dependency) == nil {
+				continue
+			}
+			if disabled[dependency] {
+				if dependencies[dependency] {
+					return fmt.Errorf("service %s depends on service %s, which is disabled", name, dependency)
+				}
+				continue
+			}
+			selected[dependency] = true
+			queue = append(queue, dependency)
+		}
+	}
+
+	content := make([]*yamlv3.Node, 0, len(services.Content))
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		if selected[services.Content[i].Value] {
+			content = append(content, services.Content[i], services.Content[i+1])
+		}
+	}
+	services.Content = content
+	return nil
+}
+
+func profileActive(service *yamlv3.Node, active map[string]bool) bool {
+	profiles := mappingValue(service, "profiles")
+	if profiles == nil || profiles.Kind != yamlv3.SequenceNode || len(profiles.Content) == 0 {
+		return true
+	}
+	for _, profile := range profiles.Content {
+		if active[profile.Value] || active["*"] {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceDependencies returns the names in depends_on of a service, and whether they are required.
+func serviceDependencies(service *yamlv3.Node) map[string]bool {
+	dependencies := make(map[string]bool)
+	dependsOn := mappingValue(service, "depends_on")
+	if dependsOn == nil {
+		return dependencies
+	}
+
+	switch dependsOn.Kind {
+	case yamlv3.SequenceNode:
+		for _, item := range dependsOn.Content {
+			dependencies[item.Value] = true
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(dependsOn.Content); i += 2 {
+			dependencies[dependsOn.Content[i].Value] = mappingScalar(dependsOn.Content[i+1], "required") != "false"
+		}
+	}
+	return dependencies
+}
@@ -0,0 +1,86 @@
+package GoLib
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const profilesStackFile = `version: '3.9'
+services:
+  query:
+    image: query_service
+  debug:
+    image: debug_tools
+    profiles: [debug]
+  anonymize_partner_a:
+    image: anonymize_service
+    profiles: [partner_a]
+    depends_on: [key_store, query]
+  key_store:
+    image: key_store
+    profiles: [tools]
+`
+
+func TestStackProfiles(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{"docker-compose.yml": profilesStackFile})
+	stackFile := filepath.Join(dir, "docker-compose.yml")
+
+	testCases := []struct {
+		name     string
+		opts     []StackOption
+		expected []string
+	}{
+		{"no profiles", nil, []string{"query"}},
+		{"profile", []StackOption{StackProfiles("debug")}, []string{"debug", "query"}},
+		{"dependencies", []StackOption{StackProfiles("partner_a")}, []string{"anonymize_partner_a", "key_store", "query"}},
+		{"environment", []StackOption{StackEnvironment(map[string]string{"COMPOSE_PROFILES": "debug, partner_a"})}, []string{"anonymize_partner_a", "debug", "key_store", "query"}},
+		{"all", []StackOption{StackProfiles("*")}, []string{"anonymize_partner_a", "debug", "key_store", "query"}},
+		{"enable", []StackOption{StackEnableServices("debug")}, []string{"debug", "query"}},
+		{"disable", []StackOption{StackProfiles("debug"), StackDisableServices("debug")}, []string{"query"}},
+		{"profiles override environment", []StackOption{StackEnvironment(map[string]string{"COMPOSE_PROFILES": "debug"}), StackProfiles()}, []string{"query"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			opts := append([]StackOption{StackEnvironment(map[string]string{})}, testCase.opts...)
+			stack, err := UnmarshalStackFile(stackFile, opts...)
+			require.NoError(t, err)
+
+			names := []string{}
+			for name := range stack.Services {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			assert.Equal(t, testCase.expected, names)
+		})
+	}
+
+	stack, err := UnmarshalStackFile(stackFile, StackProfiles("debug"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debug"}, stack.Services["debug"].Profiles)
+
+	_, err = UnmarshalStackFile(stackFile, StackProfiles("partner_a"), StackDisableServices("key_store"))
+	assert.ErrorContains(t, err, "service anonymize_partner_a depends on service key_store, which is disabled")
+	_, err = UnmarshalStackFile(stackFile, StackEnableServices("missing"))
+	assert.ErrorContains(t, err, "service missing to enable is not defined")
+}
+
+func TestSetMicroservicesEtcdProfiles(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{"docker-compose.yml": profilesStackFile})
+	cli := setupEtcdClient(t)
+
+	processed, err := SetMicroservicesEtcd(cli, filepath.Join(dir, "docker-compose.yml"), "/microservices",
+		WithStackOptions(StackEnvironment(map[string]string{}), StackEnableServices("debug")))
+	require.NoError(t, err)
+	assert.Len(t, processed, 2)
+
+	services, err := GetAndUnmarshalJSONMap[MicroServiceDetails](cli, "/microservices/")
+	require.NoError(t, err)
+	assert.Contains(t, services, "query")
+	assert.Contains(t, services, "debug")
+	assert.NotContains(t, services, "anonymize_partner_a")
+}
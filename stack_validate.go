@@ -0,0 +1,624 @@
+package GoLib
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// StackProblem is a problem found in a stack file, at a line and column of the file.
+type StackProblem struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p StackProblem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// StackValidationError holds every problem found in a stack file and its override files.
+type StackValidationError struct {
+	Problems []StackProblem
+}
+
+func (e *StackValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems)+1)
+	lines = append(lines, fmt.Sprintf("stack file is invalid, %d problem(s):", len(e.Problems)))
+	for _, problem := range e.Problems {
+		lines = append(lines, "  "+problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateStackFile checks a stack file, with the same options as UnmarshalStackFile, without
+// parsing it. Problems in the content are returned together as a *StackValidationError.
+func ValidateStackFile(fileLocation string, opts ...StackOption) error {
+	_, err := loadStackFile(fileLocation, opts...)
+	return err
+}
+
+// stackKeys are the keys allowed in the mappings of a stack file, keys starting with "x-" are
+// always allowed. Keys of compose features Swarm ignores, like build, are allowed as well.
+var stackKeys = map[string][]string{
+	"stack": {"version", "name", "services", "networks", "volumes", "secrets", "configs"},
+	"service": {
+		"annotations", "attach", "blkio_config", "build", "cap_add", "cap_drop", "cgroup", "cgroup_parent",
+		"command", "configs", "container_name", "cpu_count", "cpu_percent", "cpu_period", "cpu_quota",
+		"cpu_rt_period", "cpu_rt_runtime", "cpu_shares", "cpus", "cpuset", "credential_spec", "depends_on",
+		"deploy", "device_cgroup_rules", "devices", "dns", "dns_opt", "dns_search", "domainname",
+		"entrypoint", "env_file", "environment", "expose", "extends", "external_links", "extra_hosts",
+		"group_add", "healthcheck", "hostname", "image", "init", "ipc", "isolation", "labels", "links",
+		"logging", "mac_address", "mem_limit", "mem_reservation", "mem_swappiness", "memswap_limit",
+		"network_mode", "networks", "oom_kill_disable", "oom_score_adj", "pid", "pids_limit", "platform",
+		"ports", "privileged", "profiles", "pull_policy", "read_only", "restart", "runtime", "scale",
+		"secrets", "security_opt", "shm_size", "stdin_open", "stop_grace_period", "stop_signal",
+		"storage_opt", "sysctls", "tmpfs", "tty", "ulimits", "user", "userns_mode", "uts", "volumes",
+		"volumes_from", "working_dir",
+	},
+	"deploy": {
+		"mode", "replicas", "labels", "placement", "resources", "restart_policy", "update_config",
+		"rollback_config", "endpoint_mode",
+	},
+	"placement":       {"constraints", "preferences", "max_replicas_per_node"},
+	"resources":       {"limits", "reservations"},
+	"resource":        {"cpus", "memory", "pids", "devices", "generic_resources"},
+	"restart_policy":  {"condition", "delay", "max_attempts", "window"},
+	"update_config":   {"parallelism", "delay", "failure_action", "monitor", "max_failure_ratio", "order"},
+	"preference":      {"spread"},
+	"generic":         {"discrete_resource_spec"},
+	"discrete":        {"kind", "value"},
+	"healthcheck":     {"test", "interval", "timeout", "start_period", "start_interval", "retries", "disable"},
+	"port":            {"target", "published", "protocol", "mode", "host_ip", "name", "app_protocol"},
+	"mount":           {"type", "source", "target", "read_only", "bind", "volume", "tmpfs", "consistency"},
+	"mount.bind":      {"propagation", "create_host_path", "selinux"},
+	"mount.volume":    {"nocopy", "labels", "driver", "driver_opts", "subpath"},
+	"mount.tmpfs":     {"size", "mode"},
+	"file_reference":  {"source", "target", "uid", "gid", "mode"},
+	"dependency":      {"condition", "required", "restart"},
+	"network_options": {"aliases", "ipv4_address", "ipv6_address", "link_local_ips", "priority", "mac_address"},
+	"network": {
+		"driver", "driver_opts", "external", "name", "attachable", "internal", "labels", "ipam", "enable_ipv6",
+	},
+	"volume": {"driver", "driver_opts", "external", "name", "labels"},
+	"secret": {"file", "environment", "external", "name", "labels", "driver", "driver_opts", "template_driver"},
+	"config": {"file", "content", "environment", "external", "name", "labels", "template_driver"},
+}
+
+var profilePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+type stackValidator struct {
+	origins  map[*yamlv3.Node]string
+	problems []StackProblem
+	// declared holds the names of the top level networks, volumes, secrets and configs
+	declared map[string]map[string]bool
+	services map[string]bool
+}
+
+// validateStackDocument reports every problem in a loaded stack file, before it is parsed.
+func validateStackDocument(document stackDocument) error {
+	v := stackValidator{origins: document.origins, declared: make(map[string]map[string]bool)}
+	v.inheritOrigins(document.root, "")
+	v.validateStack(document.root)
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		a, b := v.problems[i], v.problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return &StackValidationError{Problems: v.problems}
+}
+
+// inheritOrigins gives nodes created while loading, like the environment from env files, the file of their parent.
+func (v *stackValidator) inheritOrigins(node *yamlv3.Node, parent string) {
+	origin, ok := v.origins[node]
+	if !ok {
+		origin = parent
+		v.origins[node] = origin
+	}
+	for _, child := range node.Content {
+		v.inheritOrigins(child, origin)
+	}
+}
+
+func (v *stackValidator) report(node *yamlv3.Node, format string, args ...interface{}) {
+	v.problems = append(v.problems, StackProblem{
+		File:    v.origins[node],
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// decode decodes a node and reports when that fails, the messages of yaml already hold the line.
+func (v *stackValidator) decode(node *yamlv3.Node, target interface{}, what string) bool {
+	err := node.Decode(target)
+	if err == nil {
+		return true
+	}
+
+	var typeError *yamlv3.TypeError
+	if errors.As(err, &typeError) {
+		for _, message := range typeError.Errors {
+			if _, rest, ok := strings.Cut(message, ": "); ok && strings.HasPrefix(message, "line ") {
+				message = rest
+			}
+			v.report(node, "%s: %s", what, message)
+		}
+		return false
+	}
+	v.report(node, "%s: %v", what, err)
+	return false
+}
+
+// checkKeys reports keys that are not allowed in a mapping and returns whether node is a mapping.
+func (v *stackValidator) checkKeys(node *yamlv3.Node, kind string, what string) bool {
+	if node.Kind != yamlv3.MappingNode {
+		v.report(node, "%s must be a mapping", what)
+		return false
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if strings.HasPrefix(key.Value, "x-") || contains(stackKeys[kind], key.Value) {
+			continue
+		}
+		v.report(key, "%s: unknown key %q", what, key.Value)
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *stackValidator) validateStack(root *yamlv3.Node) {
+	v.checkKeys(root, "stack", "stack file")
+
+	for _, kind := range []string{"network", "volume", "secret", "config"} {
+		v.declared[kind] = make(map[string]bool)
+		resources := mappingValue(root, kind+"s")
+		if resources == nil || resources.ShortTag() == "!!null" {
+			continue
+		}
+		if resources.Kind != yamlv3.MappingNode {
+			v.report(resources, "%ss must be a mapping", kind)
+			continue
+		}
+
+		for i := 0; i+1 < len(resources.Content); i += 2 {
+			name, resource := resources.Content[i].Value, resources.Content[i+1]
+			v.declared[kind][name] = true
+			if resource.ShortTag() != "!!null" {
+				v.checkKeys(resource, kind, fmt.Sprintf("%s %s", kind, name))
+			}
+		}
+	}
+
+	services := mappingValue(root, "services")
+	if services == nil {
+		v.report(root, "stack file has no services")
+		return
+	}
+	if services.Kind != yamlv3.MappingNode {
+		v.report(services, "services must be a mapping")
+		return
+	}
+	v.services = make(map[string]bool)
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		v.services[services.Content[i].Value] = true
+	}
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		v.validateService(services.Content[i], services.Content[i+1])
+	}
+}
+
+func (v *stackValidator) validateService(nameNode *yamlv3.Node, service *yamlv3.Node) {
+	name := nameNode.Value
+	what := "service " + name
+	if !v.checkKeys(service, "service", what) {
+		return
+	}
+
+	if image := mappingValue(service, "image"); image == nil || image.Value == "" {
+		v.report(nameNode, "%s: image is required", what)
+	} else if _, err := ParseImageReference(image.Value); err != nil {
+		v.report(image, "%s: %v", what, err)
+	}
+
+	for i := 0; i+1 < len(service.Content); i += 2 {
+		key, value := service.Content[i].Value, service.Content[i+1]
+		field := what + ": " + key
+
+		switch key {
+		case "ports":
+			v.eachItem(value, field, func(item *yamlv3.Node) { v.validatePort(item, field) })
+		case "volumes":
+			v.eachItem(value, field, func(item *yamlv3.Node) { v.validateVolume(item, field) })
+		case "secrets", "configs":
+			kind := strings.TrimSuffix(key, "s")
+			v.eachItem(value, field, func(item *yamlv3.Node) { v.validateFileReference(item, kind, field) })
+		case "networks":
+			v.validateNetworks(value, field)
+		case "environment", "labels":
+			v.validateMapping(value, field)
+		case "command", "entrypoint":
+			v.decode(value, &ShellCommand{}, field)
+		case "healthcheck":
+			v.validateHealthcheck(value, field)
+		case "depends_on":
+			v.validateDependsOn(value, name, field)
+		case "profiles":
+			v.eachItem(value, field, func(item *yamlv3.Node) {
+				if item.Kind != yamlv3.ScalarNode || !profilePattern.MatchString(item.Value) {
+					v.report(item, "%s: invalid profile name %q", field, item.Value)
+				}
+			})
+		case "deploy":
+			v.validateDeploy(value, field, servicePorts(mappingValue(service, "ports")))
+		}
+	}
+}
+
+func (v *stackValidator) eachItem(node *yamlv3.Node, what string, validate func(item *yamlv3.Node)) {
+	if node.Kind != yamlv3.SequenceNode {
+		v.report(node, "%s must be a list", what)
+		return
+	}
+	for _, item := range node.Content {
+		validate(item)
+	}
+}
+
+// validateMapping checks environment and labels, which are a mapping or a list of "KEY=VALUE" strings.
+func (v *stackValidator) validateMapping(node *yamlv3.Node, what string) {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if node.Content[i].Kind != yamlv3.ScalarNode {
+				v.report(node.Content[i], "%s: value of %s must be a string, number or boolean", what, node.Content[i-1].Value)
+			}
+		}
+	case yamlv3.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind != yamlv3.ScalarNode {
+				v.report(item, "%s: items must be KEY=VALUE strings", what)
+			}
+		}
+	default:
+		v.report(node, "%s must be a mapping or a list", what)
+	}
+}
+
+func (v *stackValidator) validatePort(item *yamlv3.Node, what string) {
+	if item.Kind == yamlv3.ScalarNode {
+		if _, err := ParsePortSpec(item.Value); err != nil {
+			v.report(item, "%s: %v", what, err)
+		}
+		return
+	}
+
+	if !v.checkKeys(item, "port", what) {
+		return
+	}
+	port := PortConfig{}
+	if !v.decode(item, &port, what) {
+		return
+	}
+	if _, err := convertPortConfig(port); err != nil {
+		v.report(item, "%s: %v", what, err)
+	}
+}
+
+func (v *stackValidator) validateVolume(item *yamlv3.Node, what string) {
+	config := MountConfig{}
+	if item.Kind == yamlv3.ScalarNode {
+		parsed, err := ParseVolumeSpec(item.Value)
+		if err != nil {
+			v.report(item, "%s: %v", what, err)
+			return
+		}
+		config = parsed
+	} else {
+		if !v.checkKeys(item, "mount", what) {
+			return
+		}
+		for _, option := range []string{"bind", "volume", "tmpfs"} {
+			if options := mappingValue(item, option); options != nil {
+				v.checkKeys(options, "mount."+option, what+"."+option)
+			}
+		}
+		if !v.decode(item, &config, what) {
+			return
+		}
+		if _, err := convertMountConfig(config); err != nil {
+			v.report(item, "%s: %v", what, err)
+			return
+		}
+	}
+
+	if (config.Type == "" || config.Type == string(mount.TypeVolume)) && config.Source != "" && !v.declared["volume"][config.Source] {
+		v.report(item, "%s: volume %s is not declared in the top level volumes", what, config.Source)
+	}
+}
+
+func (v *stackValidator) validateFileReference(item *yamlv3.Node, kind string, what string) {
+	source := item.Value
+	if item.Kind != yamlv3.ScalarNode {
+		if !v.checkKeys(item, "file_reference", what) {
+			return
+		}
+		ref := FileReference{}
+		if !v.decode(item, &ref, what) {
+			return
+		}
+		source = ref.Source
+	}
+
+	if source == "" {
+		v.report(item, "%s: source is required", what)
+	} else if !v.declared[kind][source] {
+		v.report(item, "%s: %s %s is not declared in the top level %ss", what, kind, source, kind)
+	}
+}
+
+func (v *stackValidator) validateNetworks(node *yamlv3.Node, what string) {
+	check := func(nameNode *yamlv3.Node) {
+		// Like compose, every stack has a default network
+		if nameNode.Value != "default" && !v.declared["network"][nameNode.Value] {
+			v.report(nameNode, "%s: network %s is not declared in the top level networks", what, nameNode.Value)
+		}
+	}
+
+	switch node.Kind {
+	case yamlv3.SequenceNode:
+		for _, item := range node.Content {
+			check(item)
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			check(node.Content[i])
+			if options := node.Content[i+1]; options.ShortTag() != "!!null" {
+				v.checkKeys(options, "network_options", what+"."+node.Content[i].Value)
+			}
+		}
+	default:
+		v.report(node, "%s must be a mapping or a list", what)
+	}
+}
+
+func (v *stackValidator) validateDependsOn(node *yamlv3.Node, service string, what string) {
+	check := func(nameNode *yamlv3.Node, dependency Dependency) {
+		switch {
+		case nameNode.Value == service:
+			v.report(nameNode, "%s: service can not depend on itself", what)
+		case !v.services[nameNode.Value] && dependency.required():
+			v.report(nameNode, "%s: service %s is not defined", what, nameNode.Value)
+		}
+	}
+
+	switch node.Kind {
+	case yamlv3.SequenceNode:
+		for _, item := range node.Content {
+			check(item, Dependency{})
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			nameNode, options := node.Content[i], node.Content[i+1]
+			field := what + "." + nameNode.Value
+			if !v.checkKeys(options, "dependency", field) {
+				continue
+			}
+			dependency := Dependency{}
+			if !v.decode(options, &dependency, field) {
+				continue
+			}
+			switch dependency.Condition {
+			case "", DependencyStarted, DependencyHealthy, DependencyCompleted:
+			default:
+				v.report(options, "%s: unknown condition %q", field, dependency.Condition)
+			}
+			check(nameNode, dependency)
+		}
+	default:
+		v.report(node, "%s must be a mapping or a list", what)
+	}
+}
+
+func (v *stackValidator) validateHealthcheck(node *yamlv3.Node, what string) {
+	if !v.checkKeys(node, "healthcheck", what) {
+		return
+	}
+	healthcheck := Healthcheck{}
+	if !v.decode(node, &healthcheck, what) {
+		return
+	}
+	if _, err := convertHealthcheck(healthcheck); err != nil {
+		v.report(node, "%s: %v", what, err)
+	}
+}
+
+// servicePorts returns the valid ports of a service, invalid ports are reported by validatePort.
+func servicePorts(node *yamlv3.Node) []swarm.PortConfig {
+	ports := []swarm.PortConfig{}
+	if node == nil || node.Kind != yamlv3.SequenceNode {
+		return ports
+	}
+
+	for _, item := range node.Content {
+		configs := []PortConfig{}
+		if item.Kind == yamlv3.ScalarNode {
+			configs, _ = ParsePortSpec(item.Value)
+		} else {
+			port := PortConfig{}
+			if item.Decode(&port) == nil {
+				configs = append(configs, port)
+			}
+		}
+		for _, config := range configs {
+			if port, err := convertPortConfig(config); err == nil {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+// validateDeploy checks the deploy section of a service, ports are needed to check the endpoint mode.
+func (v *stackValidator) validateDeploy(node *yamlv3.Node, what string, ports []swarm.PortConfig) {
+	if !v.checkKeys(node, "deploy", what) {
+		return
+	}
+
+	deploy := Deploy{}
+	modeNode := mappingValue(node, "mode")
+	if modeNode != nil && !v.decode(modeNode, &deploy.Mode, what+".mode") {
+		modeNode = nil
+	}
+	if node := mappingValue(node, "replicas"); node != nil {
+		count := 0
+		if v.decode(node, &count, what+".replicas") {
+			if count < 0 {
+				v.report(node, "%s.replicas can not be negative", what)
+			} else {
+				deploy.Replicas = NewReplicas(uint64(count))
+			}
+		}
+	}
+	if modeNode != nil {
+		if _, err := convertServiceMode(deploy); err != nil {
+			v.report(modeNode, "%s: %v", what, err)
+		}
+	}
+
+	if node := mappingValue(node, "endpoint_mode"); node != nil {
+		if err := applyEndpointMode(&swarm.EndpointSpec{Ports: ports}, node.Value); err != nil {
+			v.report(node, "%s: %v", what, err)
+		}
+	}
+	if labels := mappingValue(node, "labels"); labels != nil {
+		v.validateMapping(labels, what+".labels")
+	}
+	if placement := mappingValue(node, "placement"); placement != nil && v.checkKeys(placement, "placement", what+".placement") {
+		v.validatePlacement(placement, what+".placement", deploy.Mode)
+	}
+
+	if resources := mappingValue(node, "resources"); resources != nil && v.checkKeys(resources, "resources", what+".resources") {
+		for _, kind := range []string{"limits", "reservations"} {
+			resource := mappingValue(resources, kind)
+			field := what + ".resources." + kind
+			if resource == nil || !v.checkKeys(resource, "resource", field) {
+				continue
+			}
+			if memory := mappingValue(resource, "memory"); memory != nil {
+				if _, err := ParseMemory(memory.Value); err != nil {
+					v.report(memory, "%s: %v", field, err)
+				}
+			}
+			if cpus := mappingValue(resource, "cpus"); cpus != nil {
+				if value, err := strconv.ParseFloat(cpus.Value, 64); err != nil || value < 0 {
+					v.report(cpus, "%s: invalid cpus %q", field, cpus.Value)
+				}
+			}
+			if generic := mappingValue(resource, "generic_resources"); generic != nil {
+				if kind == "limits" {
+					v.report(generic, "%s: generic_resources can only be reserved", field)
+					continue
+				}
+				v.validateGenericResources(generic, field+".generic_resources")
+			}
+		}
+	}
+
+	if node := mappingValue(node, "restart_policy"); node != nil && v.checkKeys(node, "restart_policy", what+".restart_policy") {
+		policy := RestartPolicy{}
+		if v.decode(node, &policy, what+".restart_policy") {
+			if _, err := convertRestartPolicy(policy); err != nil {
+				v.report(node, "%s.restart_policy: %v", what, err)
+			}
+		}
+	}
+
+	if node := mappingValue(node, "update_config"); node != nil && v.checkKeys(node, "update_config", what+".update_config") {
+		config := UpdateConfig{}
+		if v.decode(node, &config, what+".update_config") {
+			if _, err := convertUpdateConfig(config); err != nil {
+				v.report(node, "%s.update_config: %v", what, err)
+			}
+		}
+	}
+
+	if node := mappingValue(node, "rollback_config"); node != nil && v.checkKeys(node, "update_config", what+".rollback_config") {
+		config := UpdateConfig{}
+		if v.decode(node, &config, what+".rollback_config") {
+			if _, err := convertRollbackConfig(config); err != nil {
+				v.report(node, "%s.rollback_config: %v", what, err)
+			}
+		}
+	}
+}
+
+func (v *stackValidator) validatePlacement(node *yamlv3.Node, what string, mode string) {
+	if constraints := mappingValue(node, "constraints"); constraints != nil {
+		v.decode(constraints, &[]string{}, what+".constraints")
+	}
+
+	if preferences := mappingValue(node, "preferences"); preferences != nil {
+		field := what + ".preferences"
+		v.eachItem(preferences, field, func(item *yamlv3.Node) {
+			if !v.checkKeys(item, "preference", field) {
+				return
+			}
+			if spread := mappingValue(item, "spread"); spread == nil || spread.Value == "" {
+				v.report(item, "%s: preference without spread", field)
+			}
+		})
+	}
+
+	if maxReplicas := mappingValue(node, "max_replicas_per_node"); maxReplicas != nil {
+		count := uint64(0)
+		if v.decode(maxReplicas, &count, what+".max_replicas_per_node") && count > 0 && mode == "global" {
+			v.report(maxReplicas, "%s.max_replicas_per_node can not be used in global mode", what)
+		}
+	}
+}
+
+func (v *stackValidator) validateGenericResources(node *yamlv3.Node, what string) {
+	v.eachItem(node, what, func(item *yamlv3.Node) {
+		if !v.checkKeys(item, "generic", what) {
+			return
+		}
+		spec := mappingValue(item, "discrete_resource_spec")
+		if spec == nil {
+			v.report(item, "%s: generic resource without discrete_resource_spec", what)
+			return
+		}
+		resource := DiscreteGenericResource{}
+		if v.checkKeys(spec, "discrete", what+".discrete_resource_spec") && v.decode(spec, &resource, what+".discrete_resource_spec") {
+			if resource.Kind == "" || resource.Value < 0 {
+				v.report(spec, "%s: invalid generic resource %s=%d", what, resource.Kind, resource.Value)
+			}
+		}
+	})
+}
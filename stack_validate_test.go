@@ -0,0 +1,205 @@
+package GoLib
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateStackFile(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": `version: '3.9'
+services:
+  query:
+    image: query_service
+    restart: always
+    ports:
+      - "80:8080"
+      - "99999:80"
+      - target: 80
+        published: 8080
+        protocol: icmp
+    volumes:
+      - service_logs:/var/log
+      - undeclared:/data
+      - type: bind
+        source: /tmp
+        target: /tmp
+        bind:
+          propagation: rprivate
+          colour: blue
+    networks:
+      - unl_1
+      - unknown_net
+    secrets:
+      - db_password
+      - source: missing_secret
+    deploy:
+      replicas: 2
+      resources:
+        limits:
+          memory: 12 parsecs
+          cpus: "0.5"
+  anonymize:
+    environment:
+      MODE: anonymize
+    x-owner: team
+networks:
+  unl_1:
+    external: true
+volumes:
+  service_logs:
+secrets:
+  db_password:
+    external: true
+`,
+		"docker-compose.override.yml": `services:
+  query:
+    healthcheck:
+      test: ["CMD", "true"]
+      interval: soon
+`,
+	})
+	stackFile := filepath.Join(dir, "docker-compose.yml")
+	overrideFile := filepath.Join(dir, "docker-compose.override.yml")
+
+	err := ValidateStackFile(stackFile, StackOverrideFiles(overrideFile))
+	require.Error(t, err)
+
+	var validationErr *StackValidationError
+	require.True(t, errors.As(err, &validationErr))
+
+	type position struct {
+		file string
+		line int
+	}
+	problems := make(map[position]string)
+	for _, problem := range validationErr.Problems {
+		problems[position{filepath.Base(problem.File), problem.Line}] = problem.Message
+	}
+
+	assert.Contains(t, problems[position{"docker-compose.yml", 8}], "service query: ports")
+	assert.Contains(t, problems[position{"docker-compose.yml", 9}], "service query: ports")
+	assert.Contains(t, problems[position{"docker-compose.yml", 14}], "volume undeclared is not declared")
+	assert.Contains(t, problems[position{"docker-compose.yml", 20}], `unknown key "colour"`)
+	assert.Contains(t, problems[position{"docker-compose.yml", 23}], "network unknown_net is not declared")
+	assert.Contains(t, problems[position{"docker-compose.yml", 26}], "secret missing_secret is not declared")
+	assert.Contains(t, problems[position{"docker-compose.yml", 31}], "resources.limits")
+	assert.Equal(t, "service anonymize: image is required", problems[position{"docker-compose.yml", 33}])
+	assert.Contains(t, problems[position{"docker-compose.override.yml", 4}], "service query: healthcheck")
+	assert.Len(t, validationErr.Problems, 9)
+
+	// Problems are sorted by file and position, every problem is on a line of its own
+	assert.Contains(t, err.Error(), "9 problem(s)")
+	assert.Contains(t, err.Error(), stackFile+":14:9: service query: volumes: volume undeclared is not declared in the top level volumes")
+
+	_, err = UnmarshalStackFile(stackFile)
+	assert.True(t, errors.As(err, &validationErr))
+}
+
+func TestValidateStackFileValid(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": `version: '3.9'
+x-defaults: &defaults
+  image: query_service
+services:
+  query:
+    <<: *defaults
+    ports:
+      - target: 80
+        published: 8080
+    networks:
+      default:
+      unl_1:
+        aliases: [query]
+    environment:
+      - MODE=query
+    deploy:
+      resources:
+        limits:
+          memory: 512M
+networks:
+  unl_1:
+`,
+	})
+
+	assert.NoError(t, ValidateStackFile(filepath.Join(dir, "docker-compose.yml")))
+}
+
+func TestValidateStackFileDeploy(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": `services:
+  collector:
+    image: log_collector
+    deploy:
+      mode: global
+      replicas: 2
+      endpoint_mode: round-robin
+      placement:
+        preferences:
+          - spread: node.labels.zone
+          - zone: eu
+        max_replicas_per_node: 1
+      resources:
+        limits:
+          generic_resources:
+            - discrete_resource_spec: {kind: gpu, value: 1}
+        reservations:
+          generic_resources:
+            - discrete_resource_spec: {kind: gpu, value: -1}
+      rollback_config:
+        failure_action: rollback
+`,
+	})
+
+	err := ValidateStackFile(filepath.Join(dir, "docker-compose.yml"))
+	var validationErr *StackValidationError
+	require.True(t, errors.As(err, &validationErr))
+
+	problems := make([]string, 0, len(validationErr.Problems))
+	for _, problem := range validationErr.Problems {
+		problems = append(problems, fmt.Sprintf("%d: %s", problem.Line, problem.Message))
+	}
+	assert.Equal(t, []string{
+		"5: service collector: deploy: replicas can not be set in global mode",
+		`7: service collector: deploy: unknown endpoint_mode "round-robin", expected vip or dnsrr`,
+		`11: service collector: deploy.placement.preferences: unknown key "zone"`,
+		"11: service collector: deploy.placement.preferences: preference without spread",
+		"12: service collector: deploy.placement.max_replicas_per_node can not be used in global mode",
+		"16: service collector: deploy.resources.limits: generic_resources can only be reserved",
+		"19: service collector: deploy.resources.reservations.generic_resources: invalid generic resource gpu=-1",
+		"21: service collector: deploy.rollback_config: failure_action can not be rollback",
+	}, problems)
+}
+
+func TestValidateStackFileEndpointMode(t *testing.T) {
+	dir := writeStackFiles(t, map[string]string{
+		"docker-compose.yml": `services:
+  query:
+    image: query_service
+    ports:
+      - "8080:80"
+    deploy:
+      endpoint_mode: dnsrr
+  anonymize:
+    image: anonymize_service
+    deploy:
+      endpoint_mode: dnsrr
+    ports:
+      - target: 80
+        published: 8081
+        mode: host
+`,
+	})
+
+	err := ValidateStackFile(filepath.Join(dir, "docker-compose.yml"))
+	var validationErr *StackValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Problems, 1)
+	assert.Equal(t, 7, validationErr.Problems[0].Line)
+	assert.Equal(t, "service query: deploy: endpoint_mode dnsrr can not be used with port 8080 published in ingress mode", validationErr.Problems[0].Message)
+}
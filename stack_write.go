@@ -0,0 +1,217 @@
+package GoLib
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// composeFile is the layout of a written stack file, fields are written in this order and the
+// keys of maps sorted, so the same services always give the same file.
+type composeFile struct {
+	Version  string                      `yaml:"version"`
+	Services map[string]composeService   `yaml:"services"`
+	Networks map[string]*composeResource `yaml:"networks,omitempty"`
+	Volumes  map[string]*composeResource `yaml:"volumes,omitempty"`
+	Secrets  map[string]*composeResource `yaml:"secrets,omitempty"`
+	Configs  map[string]*composeResource `yaml:"configs,omitempty"`
+}
+
+type composeService struct {
+	Image       string                     `yaml:"image"`
+	DependsOn   interface{}                `yaml:"depends_on,omitempty"`
+	Profiles    []string                   `yaml:"profiles,omitempty"`
+	Command     ShellCommand               `yaml:"command,omitempty"`
+	Entrypoint  ShellCommand               `yaml:"entrypoint,omitempty"`
+	User        string                     `yaml:"user,omitempty"`
+	WorkingDir  string                     `yaml:"working_dir,omitempty"`
+	Hostname    string                     `yaml:"hostname,omitempty"`
+	Environment map[string]string          `yaml:"environment,omitempty"`
+	Labels      Labels                     `yaml:"labels,omitempty"`
+	Ports       []interface{}              `yaml:"ports,omitempty"`
+	Volumes     []interface{}              `yaml:"volumes,omitempty"`
+	Networks    map[string]*composeNetwork `yaml:"networks,omitempty"`
+	Secrets     []interface{}              `yaml:"secrets,omitempty"`
+	Configs     []interface{}              `yaml:"configs,omitempty"`
+	Healthcheck *Healthcheck               `yaml:"healthcheck,omitempty"`
+	Deploy      Deploy                     `yaml:"deploy,omitempty"`
+}
+
+type composeNetwork struct {
+	Aliases     []string `yaml:"aliases,omitempty"`
+	IPv4Address string   `yaml:"ipv4_address,omitempty"`
+	IPv6Address string   `yaml:"ipv6_address,omitempty"`
+}
+
+type composeResource struct {
+	External bool `yaml:"external,omitempty"`
+}
+
+// MarshalStackFile writes services as a compose file (version 3.9) that docker stack deploy and
+// UnmarshalStackFile accept. The networks, volumes and secrets of external are declared external when
+// their External flag is set, and without options otherwise. Networks and volumes the services use
+// that are not in external are declared without options, so the stack creates them. Secrets and
+// configs the services use that are not in external are declared external, as their content is not known.
+func MarshalStackFile(stack MicroServiceData, external ExternalDockerConfig) ([]byte, error) {
+	file := composeFile{
+		Version:  "3.9",
+		Services: make(map[string]composeService, len(stack.Services)),
+		Networks: declareResources(external.Networks, external.ExternalNetworks),
+		Volumes:  declareResources(external.Volumes, external.ExternalVolumes),
+		Secrets:  declareResources(external.Secrets, external.ExternalSecrets),
+		Configs:  make(map[string]*composeResource),
+	}
+
+	for name, details := range stack.Services {
+		service := composeService{
+			Image:       details.Image,
+			Profiles:    details.Profiles,
+			Command:     details.Command,
+			Entrypoint:  details.Entrypoint,
+			User:        details.User,
+			WorkingDir:  details.WorkingDir,
+			Hostname:    details.Hostname,
+			Environment: details.EnvVars,
+			Labels:      details.Labels,
+			Healthcheck: details.Healthcheck,
+			Deploy:      details.Deploy,
+		}
+		if details.Tag != "" {
+			service.Image += ":" + details.Tag
+		}
+		if details.Digest != "" {
+			service.Image += "@" + details.Digest
+		}
+
+		published := make([]string, 0, len(details.Ports))
+		for port := range details.Ports {
+			published = append(published, port)
+		}
+		sort.Slice(published, func(i, j int) bool {
+			a, _ := strconv.Atoi(published[i])
+			b, _ := strconv.Atoi(published[j])
+			return a < b
+		})
+		for _, port := range published {
+			service.Ports = append(service.Ports, port+":"+details.Ports[port])
+		}
+		for _, port := range details.PortConfigs {
+			service.Ports = append(service.Ports, port)
+		}
+
+		for _, source := range sortedKeys(details.Volumes) {
+			service.Volumes = append(service.Volumes, source+":"+details.Volumes[source])
+			declare(file.Volumes, source, false)
+		}
+		for _, mount := range details.Mounts {
+			service.Volumes = append(service.Volumes, mount)
+			if (mount.Type == "" || mount.Type == "volume") && mount.Source != "" {
+				declare(file.Volumes, mount.Source, false)
+			}
+		}
+
+		if len(details.Networks) > 0 {
+			service.Networks = make(map[string]*composeNetwork, len(details.Networks))
+		}
+		for networkName, network := range details.Networks {
+			service.Networks[networkName] = nil
+			if len(network.Aliases) > 0 || network.IPv4Address != "" || network.IPv6Address != "" {
+				service.Networks[networkName] = &composeNetwork{
+					Aliases:     network.Aliases,
+					IPv4Address: network.IPv4Address,
+					IPv6Address: network.IPv6Address,
+				}
+			}
+			declare(file.Networks, networkName, false)
+		}
+
+		for _, secret := range details.Secrets {
+			service.Secrets = append(service.Secrets, secret)
+			declare(file.Secrets, secret, true)
+		}
+		for _, secret := range details.SecretRefs {
+			service.Secrets = append(service.Secrets, secret)
+			declare(file.Secrets, secret.Source, true)
+		}
+
+		for _, config := range details.Configs {
+			if config == (FileReference{Source: config.Source}) {
+				service.Configs = append(service.Configs, config.Source)
+			} else {
+				service.Configs = append(service.Configs, config)
+			}
+			declare(file.Configs, config.Source, true)
+		}
+
+		service.DependsOn = composeDependsOn(details.DependsOn)
+		file.Services[name] = service
+	}
+
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stack file: %w", err)
+	}
+	return data, nil
+}
+
+// WriteStackFile writes services as a compose file to fileLocation, see MarshalStackFile.
+func WriteStackFile(fileLocation string, stack MicroServiceData, external ExternalDockerConfig) error {
+	data, err := MarshalStackFile(stack, external)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fileLocation, data, 0644); err != nil {
+		return fmt.Errorf("failed to write stack file %s: %w", fileLocation, err)
+	}
+	return nil
+}
+
+// composeDependsOn returns the short form of depends_on, a list of names, unless a dependency
+// has options other than the default condition.
+func composeDependsOn(dependencies map[string]Dependency) interface{} {
+	if len(dependencies) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(dependencies))
+	for name, dependency := range dependencies {
+		if dependency != (Dependency{Condition: DependencyStarted}) {
+			return dependencies
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// declareResources declares the resources of names, external when it is set in isExternal.
+func declareResources(names []string, isExternal map[string]bool) map[string]*composeResource {
+	resources := make(map[string]*composeResource, len(names))
+	for _, name := range names {
+		declare(resources, name, isExternal[name])
+	}
+	return resources
+}
+
+// declare adds a resource used by a service that is not declared yet, a nil resource has no options.
+func declare(resources map[string]*composeResource, name string, external bool) {
+	if _, ok := resources[name]; ok {
+		return
+	}
+	resources[name] = nil
+	if external {
+		resources[name] = &composeResource{External: true}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
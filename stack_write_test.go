@@ -0,0 +1,101 @@
+package GoLib
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalStackFileRoundTrip(t *testing.T) {
+	stack, external, err := LoadStackFiles([]string{"./microservices_test.yml"})
+	require.NoError(t, err)
+
+	data, err := MarshalStackFile(stack, external)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "version: \"3.9\"\nservices:\n"))
+
+	stackFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	require.NoError(t, WriteStackFile(stackFile, stack, external))
+
+	written, writtenExternal, err := LoadStackFiles([]string{stackFile})
+	require.NoError(t, err)
+	assert.Equal(t, stack, written)
+
+	for _, config := range []*ExternalDockerConfig{&external, &writtenExternal} {
+		sort.Strings(config.Networks)
+		sort.Strings(config.Volumes)
+		sort.Strings(config.Secrets)
+	}
+	assert.Equal(t, external, writtenExternal)
+	assert.Equal(t, map[string]bool{"unl_1": true}, writtenExternal.ExternalNetworks)
+	assert.Equal(t, map[string]bool{"service_logs": false}, writtenExternal.ExternalVolumes)
+	assert.Contains(t, string(data), "volumes:\n  service_logs: null\n")
+
+	// Maps are written in sorted order, so the same services give the same file
+	again, err := MarshalStackFile(written, writtenExternal)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(again))
+}
+
+func TestMarshalStackFileLongSyntax(t *testing.T) {
+	retries := uint64(3)
+	mode := uint32(0400)
+	stack := MicroServiceData{Services: map[string]MicroServiceDetails{
+		"query": {
+			Image:       "registry.local:5000/query_service",
+			Tag:         "1.2",
+			Digest:      testDigest,
+			EnvVars:     map[string]string{"ENABLED": "true", "WORKERS": "4"},
+			Ports:       map[string]string{"9090": "90", "8080": "80"},
+			PortConfigs: []PortConfig{{Target: 53, Published: 53, Protocol: "udp", Mode: "host"}},
+			Networks: map[string]Network{
+				"backend":  {Aliases: []string{"query-api"}},
+				"frontend": {},
+			},
+			Secrets:    []string{"db_password"},
+			SecretRefs: []FileReference{{Source: "api_key", Target: "key", Mode: &mode}},
+			Configs:    []FileReference{{Source: "query_config"}, {Source: "nginx_config", Target: "/etc/nginx.conf"}},
+			Volumes:    map[string]string{"service_logs": "/var/log"},
+			Mounts:     []MountConfig{{Type: "bind", Source: "/tmp", Target: "/tmp", ReadOnly: true}},
+			Deploy: Deploy{
+				Replicas:  NewReplicas(2),
+				Labels:    Labels{"tier": "backend"},
+				Resources: Resources{Limits: Resource{Memory: "512M", Cpus: "0.5"}},
+			},
+			ContainerOptions: ContainerOptions{
+				Command:     ShellCommand{"serve", "--port", "80"},
+				User:        "1000",
+				Labels:      Labels{"team": "data"},
+				Healthcheck: &Healthcheck{Test: HealthcheckTest{"CMD", "true"}, Interval: "10s", Retries: &retries},
+			},
+		},
+	}}
+
+	stackFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	frontend := ExternalDockerConfig{Networks: []string{"frontend"}, ExternalNetworks: map[string]bool{"frontend": true}}
+	require.NoError(t, WriteStackFile(stackFile, stack, frontend))
+	assert.NoError(t, ValidateStackFile(stackFile))
+
+	written, external, err := LoadStackFiles([]string{stackFile})
+	require.NoError(t, err)
+	assert.Equal(t, stack, written)
+
+	// Used resources are declared, secrets and configs as external
+	sort.Strings(external.Networks)
+	sort.Strings(external.Secrets)
+	assert.Equal(t, []string{"backend", "frontend"}, external.Networks)
+	assert.Equal(t, []string{"service_logs"}, external.Volumes)
+	assert.Equal(t, []string{"api_key", "db_password"}, external.Secrets)
+	assert.Equal(t, map[string]bool{"backend": false, "frontend": true}, external.ExternalNetworks)
+	assert.Equal(t, map[string]bool{"service_logs": false}, external.ExternalVolumes)
+	assert.Equal(t, map[string]bool{"api_key": true, "db_password": true}, external.ExternalSecrets)
+
+	data, err := MarshalStackFile(stack, frontend)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "    ports:\n    - 8080:80\n    - 9090:90\n    - target: 53\n")
+	assert.Contains(t, string(data), "networks:\n  backend: null\n  frontend:\n    external: true\n")
+}
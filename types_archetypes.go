@@ -3,11 +3,11 @@ package GoLib
 var _ NameGetter = (*ArcheType)(nil)
 
 type ArcheTypes struct {
-	Contents []ArcheType `json:"archetypes"`
+	Contents []ArcheType `json:"archetypes" jsonschema:"required"`
 }
 
 type ArcheType struct {
-	Name        string   `json:"name"`
+	Name        string   `json:"name" jsonschema:"required,nonempty"`
 	RequestType string   `json:"request_type"`
 	IoConfig    IoConfig `json:"io_config"`
 }
@@ -1,10 +1,46 @@
 package GoLib
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/volume"
 )
 
+// DockerClient is the part of the Docker API used by this library.
+// It is satisfied by *client.Client and the in-memory FakeSwarm.
+type DockerClient interface {
+	Info(ctx context.Context) (types.Info, error)
+
+	ServiceCreate(ctx context.Context, service swarm.ServiceSpec, options types.ServiceCreateOptions) (types.ServiceCreateResponse, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (types.ServiceUpdateResponse, error)
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error)
+	ServiceRemove(ctx context.Context, serviceID string) error
+	ServiceLogs(ctx context.Context, serviceID string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+	Events(ctx context.Context, options types.EventsOptions) (<-chan events.Message, <-chan error)
+
+	SecretCreate(ctx context.Context, secret swarm.SecretSpec) (types.SecretCreateResponse, error)
+	SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error)
+	SecretRemove(ctx context.Context, id string) error
+
+	ConfigCreate(ctx context.Context, config swarm.ConfigSpec) (types.ConfigCreateResponse, error)
+	ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error)
+	ConfigRemove(ctx context.Context, id string) error
+
+	NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error)
+	NetworkInspect(ctx context.Context, networkID string, options types.NetworkInspectOptions) (types.NetworkResource, error)
+
+	VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error)
+}
+
 type Service struct {
 	Services map[string]CreateServicePayload `yaml:"services"`
 }
@@ -13,40 +49,185 @@ type MicroServiceData struct {
 	Services map[string]MicroServiceDetails `yaml:"services"`
 }
 
+// Ports, Volumes and Secrets hold the short "published:target", "volume:target" and "secret" forms,
+// PortConfigs, Mounts and SecretRefs everything that needs more options. Image is the name of
+// the image as written in the stack file, like "redis", without its tag and digest.
 type MicroServiceDetails struct {
-	Tag      string
-	Image    string             `yaml:"image"`
-	Ports    map[string]string  `yaml:"ports"`
-	EnvVars  map[string]string  `yaml:"environment"`
-	Networks map[string]Network `yaml:"networks"`
-	Secrets  []string           `yaml:"secrets"`
-	Volumes  map[string]string  `yaml:"volumes"`
-	Deploy   Deploy             `yaml:"deploy,omitempty"`
+	Tag              string
+	Image            string                `yaml:"image" jsonschema:"required,nonempty"`
+	Digest           string                `json:"digest,omitempty" yaml:"-"`
+	Ports            map[string]string     `yaml:"ports"`
+	PortConfigs      []PortConfig          `json:"port_configs,omitempty" yaml:"-"`
+	EnvVars          map[string]string     `yaml:"environment" encrypt:"true"`
+	Networks         map[string]Network    `yaml:"networks"`
+	Secrets          []string              `yaml:"secrets"`
+	SecretRefs       []FileReference       `json:"secret_refs,omitempty" yaml:"-"`
+	Configs          []FileReference       `json:"configs,omitempty" yaml:"-"`
+	Volumes          map[string]string     `yaml:"volumes"`
+	Mounts           []MountConfig         `json:"mounts,omitempty" yaml:"-"`
+	DependsOn        map[string]Dependency `json:"depends_on,omitempty" yaml:"-"`
+	Profiles         []string              `json:"profiles,omitempty" yaml:"-"`
+	Deploy           Deploy                `yaml:"deploy,omitempty"`
+	ContainerOptions `yaml:",inline"`
+}
+
+// Dependency of a service on another service. Condition is DependencyStarted (default),
+// DependencyHealthy or DependencyCompleted. A dependency that is not required may be missing.
+type Dependency struct {
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Required  *bool  `json:"required,omitempty" yaml:"required,omitempty"`
 }
 
+// Network holds the options of a service on a network. Swarm assigns addresses itself, so the
+// addresses are kept from the stack file but not used in service specs.
 type Network struct {
-	Aliases []string
+	Aliases     []string
+	IPv4Address string `json:"ipv4_address,omitempty" yaml:"ipv4_address,omitempty"`
+	IPv6Address string `json:"ipv6_address,omitempty" yaml:"ipv6_address,omitempty"`
 }
 
 type CreateServicePayload struct {
 	ImageName string            `json:"image" yaml:"image"`
 	Tag       string            `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Digest    string            `json:"digest,omitempty" yaml:"-"`
 	EnvVars   map[string]string `json:"env_vars" yaml:"environment"`
 	Networks  []string          `json:"networks" yaml:"networks"`
-	Secrets   []string          `json:"secrets" yaml:"secrets"`
-	Volumes   map[string]string `json:"volumes" yaml:"-"`
-	Ports     map[string]string `json:"ports,omitempty" yaml:"-"`
-	Deploy    Deploy            `json:"deploy,omitempty" yaml:"deploy"`
+	// With a Digest the image is pinned and Tag does not default to latest.
+	// NetworkAliases are extra aliases per network, the last part of the image name is always an alias
+	NetworkAliases map[string][]string `json:"network_aliases,omitempty" yaml:"-"`
+	Secrets        []string            `json:"secrets" yaml:"secrets"`
+	Volumes        map[string]string   `json:"volumes" yaml:"-"`
+	Ports          map[string]string   `json:"ports,omitempty" yaml:"-"`
+	// PortConfigs, Mounts and SecretRefs are added to the ports, volumes and secrets above
+	PortConfigs      []PortConfig    `json:"port_configs,omitempty" yaml:"-"`
+	Mounts           []MountConfig   `json:"mounts,omitempty" yaml:"-"`
+	SecretRefs       []FileReference `json:"secret_refs,omitempty" yaml:"-"`
+	Configs          []FileReference `json:"configs,omitempty" yaml:"-"`
+	Deploy           Deploy          `json:"deploy,omitempty" yaml:"deploy"`
+	ContainerOptions `yaml:",inline"`
+}
+
+// ContainerOptions are the settings of the container of a service. Labels are set on the
+// container, service labels are set with Deploy.Labels.
+type ContainerOptions struct {
+	Labels      Labels       `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Command     ShellCommand `json:"command,omitempty" yaml:"command,omitempty"`
+	Entrypoint  ShellCommand `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	User        string       `json:"user,omitempty" yaml:"user,omitempty"`
+	WorkingDir  string       `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
+	Hostname    string       `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+}
+
+// Labels of a service or container. In YAML they can also be a list of "key=value" strings.
+type Labels map[string]string
+
+// ShellCommand is a command as a list of arguments. In YAML it can also be a single string,
+// which is split into arguments like a shell would.
+type ShellCommand []string
+
+// Healthcheck of a container. Test is either a string, run with the shell, or a list starting with
+// CMD, CMD-SHELL or NONE. Durations are strings in Go duration format.
+type Healthcheck struct {
+	Test        HealthcheckTest `json:"test,omitempty" yaml:"test,omitempty"`
+	Interval    string          `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Timeout     string          `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	StartPeriod string          `json:"start_period,omitempty" yaml:"start_period,omitempty"`
+	Retries     *uint64         `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Disable     bool            `json:"disable,omitempty" yaml:"disable,omitempty"`
+}
+
+type HealthcheckTest []string
+
+// FileReference is the compose long syntax of a secret or config. Target defaults to the source
+// name, for secrets relative to /run/secrets and for configs relative to /. UID and GID default to
+// "0" and Mode to 0444.
+type FileReference struct {
+	Source string  `json:"source" yaml:"source"`
+	Target string  `json:"target,omitempty" yaml:"target,omitempty"`
+	UID    string  `json:"uid,omitempty" yaml:"uid,omitempty"`
+	GID    string  `json:"gid,omitempty" yaml:"gid,omitempty"`
+	Mode   *uint32 `json:"mode,omitempty" yaml:"mode,omitempty"`
+}
+
+// PortConfig is the compose long syntax of a port. Protocol is tcp (default), udp or sctp,
+// Mode is ingress (default) or host.
+type PortConfig struct {
+	Target    uint32 `json:"target" yaml:"target"`
+	Published uint32 `json:"published,omitempty" yaml:"published,omitempty"`
+	Protocol  string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Mode      string `json:"mode,omitempty" yaml:"mode,omitempty"`
+}
+
+// MountConfig is the compose long syntax of a volume. Type is volume (default), bind or tmpfs.
+type MountConfig struct {
+	Type     string         `json:"type,omitempty" yaml:"type,omitempty"`
+	Source   string         `json:"source,omitempty" yaml:"source,omitempty"`
+	Target   string         `json:"target" yaml:"target"`
+	ReadOnly bool           `json:"read_only,omitempty" yaml:"read_only,omitempty"`
+	Bind     *BindOptions   `json:"bind,omitempty" yaml:"bind,omitempty"`
+	Volume   *VolumeOptions `json:"volume,omitempty" yaml:"volume,omitempty"`
+	Tmpfs    *TmpfsOptions  `json:"tmpfs,omitempty" yaml:"tmpfs,omitempty"`
+}
+
+type BindOptions struct {
+	Propagation string `json:"propagation,omitempty" yaml:"propagation,omitempty"`
+}
+
+// VolumeOptions of a mount, Driver and DriverOpts are normally taken from the top level volumes of a stack file.
+type VolumeOptions struct {
+	NoCopy     bool              `json:"nocopy,omitempty" yaml:"nocopy,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Driver     string            `json:"driver,omitempty" yaml:"driver,omitempty"`
+	DriverOpts map[string]string `json:"driver_opts,omitempty" yaml:"driver_opts,omitempty"`
+}
+
+// TmpfsOptions of a mount, Size is a memory value like "64M".
+type TmpfsOptions struct {
+	Size string `json:"size,omitempty" yaml:"size,omitempty"`
+	Mode uint32 `json:"mode,omitempty" yaml:"mode,omitempty"`
 }
 
 type Deploy struct {
-	Replicas  int       `json:"replicas,omitempty" yaml:"replicas,omitempty"`
-	Placement Placement `json:"placement,omitempty" yaml:"placement,omitempty"`
-	Resources Resources `json:"resources,omitempty" yaml:"resources,omitempty"`
+	// Mode is "replicated" (the default) or "global", global services run one task on every node
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Replicas of a replicated service, 1 when not set. 0 stops every task of the service.
+	// Breaking change: this used to be an int, which could not tell an explicit 0 from not set.
+	// Set it with NewReplicas and read it with GetReplicas.
+	Replicas      *uint64        `json:"replicas,omitempty" yaml:"replicas,omitempty"`
+	Labels        Labels         `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Placement     Placement      `json:"placement,omitempty" yaml:"placement,omitempty"`
+	Resources     Resources      `json:"resources,omitempty" yaml:"resources,omitempty"`
+	RestartPolicy *RestartPolicy `json:"restart_policy,omitempty" yaml:"restart_policy,omitempty"`
+	UpdateConfig  *UpdateConfig  `json:"update_config,omitempty" yaml:"update_config,omitempty"`
+	// RollbackConfig has the same options as UpdateConfig, its failure action can not be rollback
+	RollbackConfig *UpdateConfig `json:"rollback_config,omitempty" yaml:"rollback_config,omitempty"`
+	// EndpointMode is "vip" (the default) or "dnsrr"
+	EndpointMode string `json:"endpoint_mode,omitempty" yaml:"endpoint_mode,omitempty"`
+}
+
+// NewReplicas returns a Deploy.Replicas of n.
+func NewReplicas(n uint64) *uint64 {
+	return &n
+}
+
+// GetReplicas returns the number of replicas of a replicated service, 1 when Replicas is not set.
+func (d Deploy) GetReplicas() uint64 {
+	if d.Replicas == nil {
+		return 1
+	}
+	return *d.Replicas
 }
 
 type Placement struct {
-	Constraints []string `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+	Constraints []string              `json:"constraints,omitempty" yaml:"constraints,omitempty"`
+	Preferences []PlacementPreference `json:"preferences,omitempty" yaml:"preferences,omitempty"`
+	MaxReplicas uint64                `json:"max_replicas_per_node,omitempty" yaml:"max_replicas_per_node,omitempty"`
+}
+
+// PlacementPreference spreads tasks evenly over the values of a node label, like "node.labels.zone".
+type PlacementPreference struct {
+	Spread string `json:"spread,omitempty" yaml:"spread,omitempty"`
 }
 
 type Resources struct {
@@ -56,12 +237,48 @@ type Resources struct {
 
 type Resource struct {
 	Memory string `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Cpus   string `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	// GenericResources can only be reserved, like GPUs advertised by the nodes
+	GenericResources []GenericResource `json:"generic_resources,omitempty" yaml:"generic_resources,omitempty"`
+}
+
+type GenericResource struct {
+	DiscreteResourceSpec *DiscreteGenericResource `json:"discrete_resource_spec,omitempty" yaml:"discrete_resource_spec,omitempty"`
 }
 
+type DiscreteGenericResource struct {
+	Kind  string `json:"kind" yaml:"kind"`
+	Value int64  `json:"value" yaml:"value"`
+}
+
+// Durations are strings in Go duration format, like "5s" or "1m30s"
+type RestartPolicy struct {
+	Condition   string  `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Delay       string  `json:"delay,omitempty" yaml:"delay,omitempty"`
+	MaxAttempts *uint64 `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	Window      string  `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+type UpdateConfig struct {
+	Parallelism     *uint64 `json:"parallelism,omitempty" yaml:"parallelism,omitempty"`
+	Delay           string  `json:"delay,omitempty" yaml:"delay,omitempty"`
+	FailureAction   string  `json:"failure_action,omitempty" yaml:"failure_action,omitempty"`
+	Monitor         string  `json:"monitor,omitempty" yaml:"monitor,omitempty"`
+	MaxFailureRatio float32 `json:"max_failure_ratio,omitempty" yaml:"max_failure_ratio,omitempty"`
+	Order           string  `json:"order,omitempty" yaml:"order,omitempty"`
+}
+
+// ExternalDockerConfig holds the networks, volumes and secrets declared at the top level of a stack
+// file. The External maps record for every declared resource whether it is external, resources that
+// are not external are created by the stack.
 type ExternalDockerConfig struct {
 	Networks []string `yaml:"networks"`
 	Volumes  []string `yaml:"volumes"`
 	Secrets  []string `yaml:"secrets"`
+
+	ExternalNetworks map[string]bool `yaml:"-"`
+	ExternalVolumes  map[string]bool `yaml:"-"`
+	ExternalSecrets  map[string]bool `yaml:"-"`
 }
 
 func (c CreateServicePayload) String() string {
@@ -84,14 +301,19 @@ func (c CreateServicePayload) String() string {
 		sb.WriteString(fmt.Sprintf("  %s: %s\n", k, v))
 	}
 	sb.WriteString(fmt.Sprintf("Deploy: \n"))
-	sb.WriteString(fmt.Sprintf("  Replicas: %d\n", c.Deploy.Replicas))
+	sb.WriteString(fmt.Sprintf("  Mode: %s\n", c.Deploy.Mode))
+	if c.Deploy.Replicas != nil {
+		sb.WriteString(fmt.Sprintf("  Replicas: %d\n", *c.Deploy.Replicas))
+	}
 	sb.WriteString(fmt.Sprintf("  Placement: \n"))
 	sb.WriteString(fmt.Sprintf("    Constraints: %v\n", c.Deploy.Placement.Constraints))
 	sb.WriteString(fmt.Sprintf("  Resources: \n"))
 	sb.WriteString(fmt.Sprintf("    Reservations: \n"))
 	sb.WriteString(fmt.Sprintf("      Memory: %s\n", c.Deploy.Resources.Reservations.Memory))
+	sb.WriteString(fmt.Sprintf("      Cpus: %s\n", c.Deploy.Resources.Reservations.Cpus))
 	sb.WriteString(fmt.Sprintf("    Limits: \n"))
 	sb.WriteString(fmt.Sprintf("      Memory: %s\n", c.Deploy.Resources.Limits.Memory))
+	sb.WriteString(fmt.Sprintf("      Cpus: %s\n", c.Deploy.Resources.Limits.Cpus))
 
 	return sb.String()
 }
@@ -6,8 +6,12 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+// EtcdClient covers the KV, Lease, Watch and Txn parts of the etcd client used by this library.
+// It is satisfied by *clientv3.Client, EtcdClientWrapper and the in-memory MemoryEtcdClient.
 type EtcdClient interface {
-	Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error)
+	clientv3.KV
+	clientv3.Lease
+	clientv3.Watcher
 }
 
 type EtcdClientWrapper struct {
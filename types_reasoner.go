@@ -12,13 +12,13 @@ type NameGetter interface {
 }
 
 type Requestor struct {
-	Name             string   `json:"name"`
+	Name             string   `json:"name" jsonschema:"required,nonempty"`
 	CurrentArchetype string   `json:"current_archetype"`
 	AllowedPartners  []string `json:"allowed_partners"`
 }
 
 type RequestorConfig struct {
-	Contents []Requestor `json:"requestor_config"`
+	Contents []Requestor `json:"requestor_config" jsonschema:"required"`
 }
 
 func (c *RequestorConfig) Len() int {
@@ -4,6 +4,8 @@ import (
 	"time"
 )
 
+var _ NameGetter = (*AgentDetails)(nil)
+
 type AgentData struct {
 	Agents map[string]AgentDetails `yaml:"services"`
 }
@@ -19,3 +21,7 @@ type AgentDetails struct {
 	ServiceName      string
 	AgentDetails     MicroServiceDetails
 }
+
+func (a *AgentDetails) GetName() string {
+	return a.Name
+}
@@ -2,7 +2,6 @@ package GoLib
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
@@ -86,12 +85,24 @@ func GenerateGuid(parts int) string {
 	return strings.Join(split[:parts], "-")
 }
 
+// SplitImageAndTag splits an image into its name, including the registry, and its tag, which is
+// "latest" when it has neither a tag nor a digest. A digest stays on the name, so
+// "query:1.0@sha256:..." gives "query@sha256:..." and "1.0", and an image pinned by digest only
+// has an empty tag. An invalid image is returned as the name.
 func SplitImageAndTag(fullImageName string) (string, string) {
-	splitted := strings.Split(fullImageName, ":")
-	if len(splitted) == 1 {
-		return splitted[0], "latest"
+	ref, err := ParseImageReference(fullImageName)
+	if err != nil {
+		return fullImageName, DefaultImageTag
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = DefaultImageTag
+	}
+
+	name := ref.Name()
+	if ref.Digest != "" {
+		name += "@" + ref.Digest
 	}
-	return splitted[0], splitted[1]
+	return name, ref.Tag
 }
 
 func SliceDifferenceString(sliceA, sliceB []string) []string {
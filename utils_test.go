@@ -84,6 +84,10 @@ func TestSplitImageAndTag(t *testing.T) {
 		{"anonymize_service", "anonymize_service", "latest"},
 		{"anonymize_service:v1.0.0", "anonymize_service", "v1.0.0"},
 		{"anonymize_service:1.0", "anonymize_service", "1.0"},
+		{"registry.local:5000/anonymize:1.2", "registry.local:5000/anonymize", "1.2"},
+		{"registry.local:5000/anonymize", "registry.local:5000/anonymize", "latest"},
+		{"anonymize_service@" + testDigest, "anonymize_service@" + testDigest, ""},
+		{"registry.local:5000/anonymize:1.2@" + testDigest, "registry.local:5000/anonymize@" + testDigest, "1.2"},
 	}
 
 	for _, testCase := range testCases {
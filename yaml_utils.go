@@ -1,9 +1,9 @@
 package GoLib
 
 import (
+	"fmt"
+	"os"
 	"strings"
-
-	"github.com/cloudflare/cfssl/log"
 )
 
 // Unmarshal a docker stack file into a struct of type YamlConfig.
@@ -29,16 +29,22 @@ func (c *ExternalDockerConfig) UnmarshalYAML(unmarshal func(interface{}) error)
 	}
 
 	// Extract the names and store them in the respective fields
-	for networkName := range temp.Networks {
+	c.ExternalNetworks = make(map[string]bool, len(temp.Networks))
+	for networkName, network := range temp.Networks {
 		c.Networks = append(c.Networks, networkName)
+		c.ExternalNetworks[networkName] = network.External
 	}
 
-	for volumeName := range temp.Volumes {
+	c.ExternalVolumes = make(map[string]bool, len(temp.Volumes))
+	for volumeName, volume := range temp.Volumes {
 		c.Volumes = append(c.Volumes, volumeName)
+		c.ExternalVolumes[volumeName] = volume.External
 	}
 
-	for secretName := range temp.Secrets {
+	c.ExternalSecrets = make(map[string]bool, len(temp.Secrets))
+	for secretName, secret := range temp.Secrets {
 		c.Secrets = append(c.Secrets, secretName)
+		c.ExternalSecrets[secretName] = secret.External
 	}
 
 	return nil
@@ -47,13 +53,18 @@ func (c *ExternalDockerConfig) UnmarshalYAML(unmarshal func(interface{}) error)
 func (ms *MicroServiceData) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	temp := struct {
 		Services map[string]struct {
-			Image    string             `yaml:"image"`
-			EnvVars  map[string]string  `yaml:"environment"`
-			Networks map[string]Network `yaml:"networks"`
-			Secrets  []string           `yaml:"secrets"`
-			Volumes  []string           `yaml:"volumes"`
-			Ports    []string           `yaml:"ports,omitempty"`
-			Deploy   Deploy             `yaml:"deploy"`
+			Image     string               `yaml:"image"`
+			EnvVars   stackMapping         `yaml:"environment"`
+			Networks  stackNetworks        `yaml:"networks"`
+			Secrets   []stackFileReference `yaml:"secrets"`
+			Configs   []stackFileReference `yaml:"configs"`
+			Volumes   []stackVolume        `yaml:"volumes"`
+			Ports     []stackPort          `yaml:"ports,omitempty"`
+			DependsOn stackDependsOn       `yaml:"depends_on"`
+			Profiles  []string             `yaml:"profiles"`
+			Deploy    Deploy               `yaml:"deploy"`
+
+			ContainerOptions `yaml:",inline"`
 		} `yaml:"services"`
 	}{}
 
@@ -67,33 +78,99 @@ func (ms *MicroServiceData) UnmarshalYAML(unmarshal func(interface{}) error) err
 	ms.Services = make(map[string]MicroServiceDetails)
 
 	for serviceName, serviceDetails := range temp.Services {
-		imageName, tag := SplitImageAndTag(serviceDetails.Image)
+		image := ImageReference{Tag: DefaultImageTag}
+		if serviceDetails.Image != "" {
+			image, err = ParseImageReference(serviceDetails.Image)
+			if err != nil {
+				log.Errorf("Failed to parse image of service %s: %v", serviceName, err)
+				return err
+			}
+			// The image is stored as written, it is normalized when the service spec is built
+			if image.Tag == "" && image.Digest == "" {
+				image.Tag = DefaultImageTag
+			}
+		}
 
+		// The short forms without options are kept in the maps, as they have always been stored
 		volumes := make(map[string]string)
+		mounts := []MountConfig{}
 		for _, volume := range serviceDetails.Volumes {
-			parts := strings.Split(volume, ":")
-			if len(parts) == 2 {
-				volumes[parts[0]] = parts[1]
+			config := volume.long
+			if config == nil {
+				parsed, err := ParseVolumeSpec(volume.short)
+				if err != nil {
+					log.Errorf("Failed to parse volumes of service %s: %v", serviceName, err)
+					return err
+				}
+				config = &parsed
+			}
+
+			if config.Type == "volume" && config.Source != "" && !config.ReadOnly && config.Volume == nil {
+				volumes[config.Source] = config.Target
+			} else {
+				mounts = append(mounts, *config)
 			}
 		}
 
 		ports := make(map[string]string)
+		portConfigs := []PortConfig{}
 		for _, port := range serviceDetails.Ports {
-			parts := strings.Split(port, ":")
-			if len(parts) == 2 {
+			if port.long != nil {
+				portConfigs = append(portConfigs, *port.long)
+				continue
+			}
+
+			parts := strings.Split(port.short, ":")
+			if len(parts) == 2 && isDigits(parts[0]) && isDigits(parts[1]) {
 				ports[parts[0]] = parts[1]
+				continue
+			}
+
+			parsed, err := ParsePortSpec(port.short)
+			if err != nil {
+				log.Errorf("Failed to parse ports of service %s: %v", serviceName, err)
+				return err
+			}
+			portConfigs = append(portConfigs, parsed...)
+		}
+
+		var secrets []string
+		secretRefs := []FileReference{}
+		for _, secret := range serviceDetails.Secrets {
+			if secret.long != nil {
+				secretRefs = append(secretRefs, *secret.long)
+			} else {
+				secrets = append(secrets, secret.short)
+			}
+		}
+
+		configs := []FileReference{}
+		for _, config := range serviceDetails.Configs {
+			if config.long != nil {
+				configs = append(configs, *config.long)
+			} else {
+				configs = append(configs, FileReference{Source: config.short})
 			}
 		}
 
 		payload := MicroServiceDetails{
-			Image:    imageName,
-			Tag:      tag,
-			EnvVars:  serviceDetails.EnvVars,
-			Secrets:  serviceDetails.Secrets,
-			Networks: serviceDetails.Networks,
-			Volumes:  volumes,
-			Ports:    ports,
-			Deploy:   serviceDetails.Deploy,
+			Image:       image.Name(),
+			Tag:         image.Tag,
+			Digest:      image.Digest,
+			EnvVars:     serviceDetails.EnvVars.environment(),
+			Secrets:     secrets,
+			SecretRefs:  nilIfEmpty(secretRefs),
+			Configs:     nilIfEmpty(configs),
+			Networks:    serviceDetails.Networks,
+			Volumes:     volumes,
+			Ports:       ports,
+			Mounts:      nilIfEmpty(mounts),
+			PortConfigs: nilIfEmpty(portConfigs),
+			DependsOn:   serviceDetails.DependsOn,
+			Profiles:    serviceDetails.Profiles,
+			Deploy:      serviceDetails.Deploy,
+
+			ContainerOptions: serviceDetails.ContainerOptions,
 		}
 
 		ms.Services[serviceName] = payload
@@ -101,3 +178,185 @@ func (ms *MicroServiceData) UnmarshalYAML(unmarshal func(interface{}) error) err
 
 	return nil
 }
+
+// stackNetworks are the networks of a service, either a list of names or a map of names to options.
+type stackNetworks map[string]Network
+
+func (n *stackNetworks) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var names []string
+	if err := unmarshal(&names); err == nil {
+		*n = make(stackNetworks, len(names))
+		for _, name := range names {
+			(*n)[name] = Network{}
+		}
+		return nil
+	}
+
+	// A network without options has a null value, which unmarshals to an empty Network
+	networks := map[string]Network{}
+	if err := unmarshal(&networks); err != nil {
+		return err
+	}
+	*n = networks
+	return nil
+}
+
+// stackDependsOn is depends_on, either a list of service names or a map of names to dependencies.
+// Dependencies without a condition get DependencyStarted.
+type stackDependsOn map[string]Dependency
+
+func (d *stackDependsOn) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var names []string
+	if err := unmarshal(&names); err == nil {
+		*d = make(stackDependsOn, len(names))
+		for _, name := range names {
+			(*d)[name] = Dependency{Condition: DependencyStarted}
+		}
+		return nil
+	}
+
+	dependencies := map[string]Dependency{}
+	if err := unmarshal(&dependencies); err != nil {
+		return err
+	}
+	*d = make(stackDependsOn, len(dependencies))
+	for name, dependency := range dependencies {
+		if dependency.Condition == "" {
+			dependency.Condition = DependencyStarted
+		}
+		(*d)[name] = dependency
+	}
+	return nil
+}
+
+// stackMapping is a compose mapping, either a map or a list of "KEY=VALUE" strings.
+// Keys without a value ("KEY" in a list or "KEY:" in a map) map to nil.
+type stackMapping map[string]*string
+
+func (m *stackMapping) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*m = make(stackMapping, len(list))
+		for _, item := range list {
+			key, value, ok := strings.Cut(item, "=")
+			if ok {
+				(*m)[key] = &value
+			} else {
+				(*m)[key] = nil
+			}
+		}
+		return nil
+	}
+
+	// Values can be numbers or booleans as well, which are used as written
+	var mapping map[string]interface{}
+	if err := unmarshal(&mapping); err != nil {
+		return err
+	}
+	*m = make(stackMapping, len(mapping))
+	for key, value := range mapping {
+		if value == nil {
+			(*m)[key] = nil
+			continue
+		}
+		text := fmt.Sprint(value)
+		(*m)[key] = &text
+	}
+	return nil
+}
+
+// environment returns the variables of the mapping, like compose a variable without a value
+// gets its value from the environment, and is left out when it is not set there either.
+func (m stackMapping) environment() map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	env := make(map[string]string, len(m))
+	for key, value := range m {
+		if value != nil {
+			env[key] = *value
+		} else if fromEnv, ok := os.LookupEnv(key); ok {
+			env[key] = fromEnv
+		}
+	}
+	return env
+}
+
+func (l *Labels) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var mapping stackMapping
+	if err := unmarshal(&mapping); err != nil {
+		return err
+	}
+
+	*l = make(Labels, len(mapping))
+	for key, value := range mapping {
+		if value != nil {
+			(*l)[key] = *value
+		} else {
+			(*l)[key] = ""
+		}
+	}
+	return nil
+}
+
+// stackPort is a port in either the short ("8080:80/udp") or the long compose syntax.
+type stackPort struct {
+	short string
+	long  *PortConfig
+}
+
+func (p *stackPort) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&p.short); err == nil {
+		return nil
+	}
+	p.long = &PortConfig{}
+	return unmarshal(p.long)
+}
+
+// stackVolume is a volume in either the short ("logs:/var/log:ro") or the long compose syntax.
+type stackVolume struct {
+	short string
+	long  *MountConfig
+}
+
+func (v *stackVolume) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&v.short); err == nil {
+		return nil
+	}
+	v.long = &MountConfig{}
+	return unmarshal(v.long)
+}
+
+// stackFileReference is a secret or config in either the short ("name") or the long compose syntax.
+type stackFileReference struct {
+	short string
+	long  *FileReference
+}
+
+func (r *stackFileReference) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&r.short); err == nil {
+		return nil
+	}
+	r.long = &FileReference{}
+	return unmarshal(r.long)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func nilIfEmpty[T any](s []T) []T {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
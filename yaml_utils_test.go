@@ -0,0 +1,67 @@
+package GoLib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestUnmarshalStackFileListAndMapForms(t *testing.T) {
+	t.Setenv("GOLIB_TEST_TOKEN", "from-env")
+
+	data := `
+services:
+  listed:
+    image: listed:1.0
+    networks:
+      - core
+      - backend
+    environment:
+      - MODE=fast
+      - EMPTY=
+      - GOLIB_TEST_TOKEN
+      - GOLIB_TEST_UNSET
+    labels:
+      - component=query
+      - canary
+  mapped:
+    image: mapped:1.0
+    networks:
+      core:
+        aliases:
+          - api
+        ipv4_address: 10.0.0.10
+      backend:
+    environment:
+      PORT: 8080
+      DEBUG: true
+      GOLIB_TEST_TOKEN:
+    labels:
+      component: store
+`
+	stack := MicroServiceData{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &stack))
+
+	listed := stack.Services["listed"]
+	assert.Equal(t, map[string]Network{"core": {}, "backend": {}}, listed.Networks)
+	assert.Equal(t, map[string]string{"MODE": "fast", "EMPTY": "", "GOLIB_TEST_TOKEN": "from-env"}, listed.EnvVars)
+	assert.Equal(t, Labels{"component": "query", "canary": ""}, listed.Labels)
+
+	mapped := stack.Services["mapped"]
+	assert.Equal(t, map[string]Network{
+		"core":    {Aliases: []string{"api"}, IPv4Address: "10.0.0.10"},
+		"backend": {},
+	}, mapped.Networks)
+	assert.Equal(t, map[string]string{"PORT": "8080", "DEBUG": "true", "GOLIB_TEST_TOKEN": "from-env"}, mapped.EnvVars)
+	assert.Equal(t, Labels{"component": "store"}, mapped.Labels)
+
+	spec, err := CreateServiceSpecFromPayload(mapped.Payload(), nil)
+	require.NoError(t, err)
+	require.Len(t, spec.TaskTemplate.Networks, 2)
+	assert.Equal(t, "backend", spec.TaskTemplate.Networks[0].Target)
+	assert.Equal(t, []string{"mapped"}, spec.TaskTemplate.Networks[0].Aliases)
+	assert.Equal(t, "core", spec.TaskTemplate.Networks[1].Target)
+	assert.Equal(t, []string{"mapped", "api"}, spec.TaskTemplate.Networks[1].Aliases)
+}